@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/pflag"
+)
+
+// fraktiConfig mirrors frakti's command-line flags so nodes can be
+// configured from a YAML or JSON file instead of an ever-growing command
+// line. Values from the file only apply to flags not explicitly set on the
+// command line, so flags always win. Unknown keys fail fast at startup.
+type fraktiConfig struct {
+	Listen                 string   `json:"listen,omitempty"`
+	HyperEndpoint          string   `json:"hyperEndpoint,omitempty"`
+	StreamingServerPort    string   `json:"streamingServerPort,omitempty"`
+	StreamingServerAddress string   `json:"streamingServerAddress,omitempty"`
+	CNINetDir              string   `json:"cniNetDir,omitempty"`
+	CNIPluginDir           string   `json:"cniPluginDir,omitempty"`
+	CgroupDriver           string   `json:"cgroupDriver,omitempty"`
+	RootDirectory          string   `json:"rootDirectory,omitempty"`
+	CPU                    int32    `json:"cpu,omitempty"`
+	Memory                 int32    `json:"memory,omitempty"`
+	DefaultDNS             []string `json:"defaultDNS,omitempty"`
+	ClusterID              string   `json:"clusterID,omitempty"`
+	OnUnsupported          string   `json:"onUnsupported,omitempty"`
+	InsecureRegistries     []string `json:"insecureRegistries,omitempty"`
+	AllowedRegistries      []string `json:"allowedRegistries,omitempty"`
+	BlockedRegistries      []string `json:"blockedRegistries,omitempty"`
+}
+
+// loadConfigFile parses and validates the config file. Unknown keys and
+// malformed values are reported with the file name so the operator can fix
+// the file instead of guessing.
+func loadConfigFile(path string) (*fraktiConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	config := &fraktiConfig{}
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	if config.CgroupDriver != "" && config.CgroupDriver != "cgroupfs" && config.CgroupDriver != "systemd" {
+		return nil, fmt.Errorf("invalid config file %s: cgroupDriver must be 'cgroupfs' or 'systemd', got %q", path, config.CgroupDriver)
+	}
+	return config, nil
+}
+
+// applyConfigFile copies file values onto the flag variables that were not
+// explicitly set on the command line.
+func applyConfigFile(config *fraktiConfig) {
+	unlessFlagSet := func(name string, apply func()) {
+		if !pflag.CommandLine.Changed(name) {
+			apply()
+		}
+	}
+
+	if config.Listen != "" {
+		unlessFlagSet("listen", func() { *listen = config.Listen })
+	}
+	if config.HyperEndpoint != "" {
+		unlessFlagSet("hyper-endpoint", func() { *hyperEndpoint = config.HyperEndpoint })
+	}
+	if config.StreamingServerPort != "" {
+		unlessFlagSet("streaming-server-port", func() { *streamingServerPort = config.StreamingServerPort })
+	}
+	if config.StreamingServerAddress != "" {
+		unlessFlagSet("streaming-server-addr", func() { *streamingServerAddress = config.StreamingServerAddress })
+	}
+	if config.CNINetDir != "" {
+		unlessFlagSet("cni-net-dir", func() { *cniNetDir = config.CNINetDir })
+	}
+	if config.CNIPluginDir != "" {
+		unlessFlagSet("cni-plugin-dir", func() { *cniPluginDir = config.CNIPluginDir })
+	}
+	if config.CgroupDriver != "" {
+		unlessFlagSet("cgroup-driver", func() { *cgroupDriver = config.CgroupDriver })
+	}
+	if config.RootDirectory != "" {
+		unlessFlagSet("root-directory", func() { *rootDir = config.RootDirectory })
+	}
+	if config.CPU != 0 {
+		unlessFlagSet("cpu", func() { *defaultCPUNum = config.CPU })
+	}
+	if config.Memory != 0 {
+		unlessFlagSet("memory", func() { *defaultMemoryMB = config.Memory })
+	}
+	if config.DefaultDNS != nil {
+		unlessFlagSet("default-dns", func() { *defaultDNS = config.DefaultDNS })
+	}
+	if config.ClusterID != "" {
+		unlessFlagSet("cluster-id", func() { *clusterID = config.ClusterID })
+	}
+	if config.OnUnsupported != "" {
+		unlessFlagSet("on-unsupported", func() { *onUnsupported = config.OnUnsupported })
+	}
+	if config.InsecureRegistries != nil {
+		unlessFlagSet("insecure-registry", func() { *insecureRegistries = config.InsecureRegistries })
+	}
+	if config.AllowedRegistries != nil {
+		unlessFlagSet("allowed-registry", func() { *allowedRegistries = config.AllowedRegistries })
+	}
+	if config.BlockedRegistries != nil {
+		unlessFlagSet("blocked-registry", func() { *blockedRegistries = config.BlockedRegistries })
+	}
+}
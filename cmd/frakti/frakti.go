@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
@@ -54,15 +55,47 @@ var (
 		"The directory for putting cni configuration file")
 	cniPluginDir = pflag.String("cni-plugin-dir", "/opt/cni/bin",
 		"The directory for putting cni plugin binary file")
+	cniTimeout = pflag.Duration("cni-timeout", 2*time.Minute,
+		"The timeout for a single CNI plugin invocation, e.g. 2m")
 	privilegedRuntimeEndpoint = pflag.String("docker-endpoint", "unix:///var/run/docker.sock",
 		"The endpoint of privileged runtime to communicate with")
-	enablePrivilegedRuntime = pflag.Bool("enable-privileged-runtime", true, "Enable privileged runtime to handle OS containers, default is true")
-	enableUnikernelRuntime  = pflag.Bool("enable-unikernel-runtime", false, "Enable unikernel runtime to run containers using unikernel image, default is false. Still under development.")
-	enableUnikernelLog      = pflag.Bool("enable-unikernel-log", true, "Enable unikernel runtime's log allow print VM's log to kubelet specified file, while disable some ability when `virsh console` to VM.")
-	cgroupDriver            = pflag.String("cgroup-driver", "cgroupfs", "Driver that the frakti uses to manipulate cgroups on the host. *SHOULD BE SAME AS* kubelet cgroup driver configuration.  Possible values: 'cgroupfs', 'systemd'")
-	rootDir                 = pflag.String("root-directory", "/var/lib/frakti", "Path to the frakti root directory")
-	defaultCPUNum           = pflag.Int32("cpu", 1, "Default CPU in number for HyperVM when cpu limit is not specified for the pod")
-	defaultMemoryMB         = pflag.Int32("memory", 64, "Default memory in MB for HyperVM when memory limit is not specified for the pod")
+	enablePrivilegedRuntime   = pflag.Bool("enable-privileged-runtime", true, "Enable privileged runtime to handle OS containers, default is true")
+	enableUnikernelRuntime    = pflag.Bool("enable-unikernel-runtime", false, "Enable unikernel runtime to run containers using unikernel image, default is false. Still under development.")
+	enableUnikernelLog        = pflag.Bool("enable-unikernel-log", true, "Enable unikernel runtime's log allow print VM's log to kubelet specified file, while disable some ability when `virsh console` to VM.")
+	cgroupDriver              = pflag.String("cgroup-driver", "cgroupfs", "Driver that the frakti uses to manipulate cgroups on the host. *SHOULD BE SAME AS* kubelet cgroup driver configuration.  Possible values: 'cgroupfs', 'systemd'")
+	rootDir                   = pflag.String("root-directory", "/var/lib/frakti", "Path to the frakti root directory")
+	defaultCPUNum             = pflag.Int32("cpu", 1, "Default CPU in number for HyperVM when cpu limit is not specified for the pod")
+	defaultMemoryMB           = pflag.Int32("memory", 64, "Default memory in MB for HyperVM when memory limit is not specified for the pod")
+	debugListenAddr           = pflag.String("debug-listen", "", "The address for the debug endpoint to serve on, e.g. 127.0.0.1:22523. Read-only except for the sandbox force-remove escape hatch, which requires explicit confirmation. Disabled when empty")
+	insecureRegistries        = pflag.StringSlice("insecure-registry", nil, "Registry host allowed to be accessed over plain HTTP or with unverified certificates, e.g. myregistry.local:5000. May be specified multiple times")
+	allowedRegistries         = pflag.StringSlice("allowed-registry", nil, "Registry host images may be pulled from; pulls from any other registry are rejected with PermissionDenied. May be specified multiple times; empty allows all registries not explicitly blocked")
+	blockedRegistries         = pflag.StringSlice("blocked-registry", nil, "Registry host images must not be pulled from; such pulls are rejected with PermissionDenied. May be specified multiple times")
+	stopContainerGrace        = pflag.Int64("container-stop-grace-period", 10, "Grace period in seconds for stopping a container when kubelet requests an immediate stop, so the container still gets a SIGTERM attempt before it is killed")
+	streamingIdleTimeout      = pflag.Duration("streaming-idle-timeout", streaming.DefaultConfig.StreamIdleTimeout, "Idle timeout after which stale exec/attach/port-forward streams are closed. Zero means no timeout")
+	maxPods                   = pflag.Int32("max-pods", 0, "Soft limit on concurrent pod sandboxes; new sandboxes are rejected with ResourceExhausted once reached. Zero means no limit")
+	maxContainers             = pflag.Int32("max-containers", 0, "Soft limit on concurrent containers; new containers are rejected with ResourceExhausted once reached. Zero means no limit")
+	maxConcurrentCreates      = pflag.Int32("max-concurrent-creates", 0, "Maximum number of sandbox and container creates allowed to run against hyperd at once; excess creates queue until a slot frees up, smoothing VM-boot storms during kubelet's initial sync. Zero means no limit")
+	hyperConnPoolSize         = pflag.Int32("hyperd-conn-pool-size", 1, "Number of gRPC connections to hyperd to round-robin calls across. Values above 1 improve throughput under heavy exec/stats/relist load; streaming calls stay on the connection they were opened on")
+	verifyImagePresence       = pflag.Bool("verify-image-before-create", false, "Check that a container's image is already pulled before creating it, failing with a clear NotFound when it is not. Off by default since kubelet pulls images before creating containers")
+	imagePullStallTimeout     = pflag.Duration("image-pull-stall-timeout", time.Minute, "Abort an image pull when hyperd reports no progress for this long. Distinct from the overall pull deadline: a pull making steady progress may run longer")
+	allowedHypervisors        = pflag.StringSlice("allowed-hypervisor", nil, "Hypervisor driver pods may select via the VMType pod option annotation, e.g. qemu. May be specified multiple times; empty allows any driver hyperd supports")
+	sandboxBootTimeout        = pflag.Duration("sandbox-boot-timeout", 0, "Time allowed for a sandbox VM to boot before its creation fails with DeadlineExceeded and the half-started pod is cleaned up. Zero uses the shared hyperd call timeout")
+	defaultSeccompProfile     = pflag.String("default-seccomp-profile", "", "Seccomp profile applied to containers that request none, e.g. runtime/default. Containers requesting unconfined explicitly opt out. Empty applies no default")
+	annotationAllowPrefixes   = pflag.StringSlice("spec-annotation-allow-prefix", nil, "Annotation key prefix passed through into hyperd's pod and container specs; annotations matching no allow prefix are kept only in frakti's metadata. May be specified multiple times; empty passes all annotations not explicitly denied")
+	annotationDenyPrefixes    = pflag.StringSlice("spec-annotation-deny-prefix", nil, "Annotation key prefix withheld from hyperd's pod and container specs and kept only in frakti's metadata. May be specified multiple times")
+	enableLiveMigration       = pflag.Bool("enable-live-migration", false, "Enable live-migrating a sandbox's VM to another hyperd instance for maintenance drains. Requires hyperd support; without it migration requests fail with a clear error")
+	storageFreeThresholdMB    = pflag.Int64("storage-free-threshold-mb", 0, "Reject sandbox and container creates with ResourceExhausted when hyperd's storage filesystem reports less free space than this many MB, instead of failing deep inside the create. Zero disables the check")
+	execSyncCacheTTL          = pflag.Duration("exec-sync-cache-ttl", 0, "Experimental: cache ExecSync results for this duration so identical exec probes reuse the result instead of each entering the VM. Results may be stale up to the TTL. Zero disables the cache")
+	defaultDNS                = pflag.StringSlice("default-dns", nil, "DNS server applied to sandboxes whose pod config specifies no DNS servers, e.g. 8.8.8.8. May be specified multiple times; empty keeps the pod spec untouched")
+	enableContainerCheckpoint = pflag.Bool("enable-container-checkpoint", false, "Enable the container checkpoint/restore passthrough. Requires hyperd support; without it checkpoint requests fail with a clear error")
+	reconcileInterval         = pflag.Duration("reconcile-interval", 0, "Interval for comparing frakti's persisted state against hyperd and reporting drifted pods, e.g. 5m. Zero disables the reconciler")
+	enableImagePrePull        = pflag.Bool("enable-image-pre-pull", false, "Pre-pull the images listed in a sandbox's pre-pull annotation in the background once the sandbox is up, so the first container start does not wait for the pull")
+	sandboxDryRun             = pflag.Bool("experimental-sandbox-dry-run", false, "FOR TESTING ONLY: translate and validate sandbox specs without creating VMs in hyperd. Never enable this on a production node")
+	maxLabelMapCount          = pflag.Int("max-label-map-count", manager.DefaultMaxLabelMapCount, "Maximum number of entries accepted in one label or annotation map; oversized requests are rejected with InvalidArgument. Zero means no limit")
+	onUnsupported             = pflag.String("on-unsupported", hyper.UnsupportedPolicyFail, "How to handle pod specs requesting features the hyper runtime can not honor. 'fail' rejects the request, 'warn' creates the pod best-effort without the feature and logs a warning")
+	maxLabelMapSize           = pflag.Int("max-label-map-size", manager.DefaultMaxLabelMapSize, "Maximum total size in bytes accepted for one label or annotation map; oversized requests are rejected with InvalidArgument. Zero means no limit")
+	clusterID                 = pflag.String("cluster-id", "", "Identifier prefixed to hyperd-side pod and container names so multiple frakti instances can share one hyperd without name collisions. Must not contain '_'. Empty keeps names unprefixed")
+	statusCacheTTL            = pflag.Duration("status-cache-ttl", 0, "How long sandbox and container statuses may be served from cache between kubelet relists, e.g. 500ms. Mutations invalidate the affected entry. Zero disables the cache")
 )
 
 func main() {
@@ -75,19 +108,49 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *configFile != "" {
+		config, err := loadConfigFile(*configFile)
+		if err != nil {
+			glog.Errorf("Load config file failed: %v", err)
+			os.Exit(1)
+		}
+		applyConfigFile(config)
+	}
+
 	if *cgroupDriver != "cgroupfs" && *cgroupDriver != "systemd" {
 		glog.Error("cgroup-driver flag should only be set as 'cgroupfs' or 'systemd'")
 		os.Exit(1)
 	}
 
+	if err := hyper.SetUnsupportedPolicy(*onUnsupported); err != nil {
+		glog.Errorf("Invalid on-unsupported flag: %v", err)
+		os.Exit(1)
+	}
+
+	if err := hyper.SetClusterID(*clusterID); err != nil {
+		glog.Errorf("Invalid cluster-id flag: %v", err)
+		os.Exit(1)
+	}
+
 	// 1. Initialize hyper runtime and streaming server
 	streamingConfig := getStreamingConfig()
-	hyperRuntime, streamingServer, err := hyper.NewHyperRuntime(*hyperEndpoint, streamingConfig, *cniNetDir, *cniPluginDir, *rootDir, *defaultCPUNum, *defaultMemoryMB)
+	hyperRuntime, streamingServer, err := hyper.NewHyperRuntime(*hyperEndpoint, streamingConfig, *cniNetDir, *cniPluginDir, *rootDir, *defaultCPUNum, *defaultMemoryMB, *cniTimeout, *insecureRegistries, *allowedRegistries, *blockedRegistries, *stopContainerGrace, *maxPods, *maxContainers, *maxConcurrentCreates, *execSyncCacheTTL, *defaultDNS, *sandboxDryRun, *enableContainerCheckpoint, *enableImagePrePull, *hyperConnPoolSize, *verifyImagePresence, *imagePullStallTimeout, *allowedHypervisors, *sandboxBootTimeout, *defaultSeccompProfile, *annotationAllowPrefixes, *annotationDenyPrefixes, *enableLiveMigration, *storageFreeThresholdMB)
 	if err != nil {
 		glog.Errorf("Initialize hyper runtime failed: %v", err)
 		os.Exit(1)
 	}
 
+	hyperRuntime.StartReconciler(*reconcileInterval)
+	startConfigReloadHandler(hyperRuntime)
+
+	if *debugListenAddr != "" {
+		go func() {
+			if err := hyperRuntime.ServeDebug(*debugListenAddr); err != nil {
+				glog.Errorf("Serve debug endpoint at %s failed: %v", *debugListenAddr, err)
+			}
+		}()
+	}
+
 	// 2. Initialize privileged runtime and start its own streaming server
 	privilegedRuntime, err := docker.NewPrivilegedRuntimeService(
 		*privilegedRuntimeEndpoint,
@@ -113,7 +176,7 @@ func main() {
 	}
 
 	// 4. Initialize frakti manager with two runtimes above
-	server, err := manager.NewFraktiManager(hyperRuntime, hyperRuntime, streamingServer, privilegedRuntime, privilegedRuntime, unikernelRuntime, unikernelRuntime)
+	server, err := manager.NewFraktiManager(hyperRuntime, hyperRuntime, streamingServer, privilegedRuntime, privilegedRuntime, unikernelRuntime, unikernelRuntime, *maxLabelMapCount, *maxLabelMapSize, *statusCacheTTL)
 	if err != nil {
 		glog.Errorf("Initialize frakti server failed: %v", err)
 		os.Exit(1)
@@ -124,7 +187,7 @@ func main() {
 
 func generateStreamingConfigInternal() *streaming.Config {
 	return &streaming.Config{
-		StreamIdleTimeout:               streaming.DefaultConfig.StreamIdleTimeout,
+		StreamIdleTimeout:               *streamingIdleTimeout,
 		StreamCreationTimeout:           streaming.DefaultConfig.StreamCreationTimeout,
 		SupportedRemoteCommandProtocols: streaming.DefaultConfig.SupportedRemoteCommandProtocols,
 		SupportedPortForwardProtocols:   streaming.DefaultConfig.SupportedPortForwardProtocols,
@@ -0,0 +1,74 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"k8s.io/frakti/pkg/hyper"
+)
+
+var configFile = pflag.String("config", "", "Path to a YAML or JSON config file; flags set on the command line override file values. The file is re-read on SIGHUP to change runtime-tunable settings without a restart; settings that require a restart keep their startup values")
+
+// startConfigReloadHandler makes SIGHUP re-read the config file and apply
+// the runtime-safe subset of settings. Without a config file SIGHUP keeps
+// its default behavior.
+func startConfigReloadHandler(runtime *hyper.Runtime) {
+	if *configFile == "" {
+		return
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		for range sigCh {
+			glog.Infof("Got SIGHUP, reloading config from %s", *configFile)
+			if err := reloadConfig(runtime, *configFile); err != nil {
+				glog.Errorf("Reload config from %s failed, keeping current settings: %v", *configFile, err)
+			}
+		}
+	}()
+}
+
+// reloadConfig parses the config file and applies the subset of settings
+// that can safely change while frakti is running (the unsupported-feature
+// policy and the registry lists), logging each one that took effect. It
+// applies nothing when the file cannot be parsed.
+func reloadConfig(runtime *hyper.Runtime, path string) error {
+	config, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	if config.OnUnsupported != "" {
+		if err := hyper.SetUnsupportedPolicy(config.OnUnsupported); err != nil {
+			return err
+		}
+		glog.Infof("Reload: on-unsupported policy is now %q", config.OnUnsupported)
+	}
+	if config.InsecureRegistries != nil || config.AllowedRegistries != nil || config.BlockedRegistries != nil {
+		runtime.UpdateRegistryPolicy(config.InsecureRegistries, config.AllowedRegistries, config.BlockedRegistries)
+		glog.Infof("Reload: registry policy is now %d insecure, %d allowed, %d blocked entries",
+			len(config.InsecureRegistries), len(config.AllowedRegistries), len(config.BlockedRegistries))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strings"
+	"sync"
+)
+
+// fraktiAnnotationPrefixMarker identifies frakti's own runtime annotations
+// (runtime.*, podoptions.*, snapshot.* and the like). They are small and
+// features depend on them, so the filter always passes them regardless of
+// configuration.
+const fraktiAnnotationPrefixMarker = "frakti.alpha.kubernetes.io/"
+
+// annotationFilter decides which annotations are persisted into hyperd's
+// spec. Kubelet-injected annotations can be large or sensitive and bloat
+// the VM config without hyperd ever looking at them; the filter withholds
+// those, while CreatePodSandbox/CreateContainer keep the withheld set in
+// frakti's own metadata so statuses still round-trip the full annotations.
+// Matching is by key prefix: a deny match withholds the annotation, and a
+// non-empty allow list withholds everything that matches no allow prefix.
+// A nil filter passes everything.
+type annotationFilter struct {
+	allowPrefixes []string
+	denyPrefixes  []string
+}
+
+// newAnnotationFilter builds a filter from the configured prefix lists, or
+// nil when there is nothing to filter.
+func newAnnotationFilter(allowPrefixes, denyPrefixes []string) *annotationFilter {
+	if len(allowPrefixes) == 0 && len(denyPrefixes) == 0 {
+		return nil
+	}
+	return &annotationFilter{allowPrefixes: allowPrefixes, denyPrefixes: denyPrefixes}
+}
+
+func (f *annotationFilter) passes(key string) bool {
+	if f == nil || strings.Contains(key, fraktiAnnotationPrefixMarker) {
+		return true
+	}
+	for _, prefix := range f.denyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	if len(f.allowPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.allowPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSpecLabels re-encodes the annotations persisted in the given spec
+// labels, keeping only those the filter passes, and returns the withheld
+// annotations for frakti-side retention. A nil result means the spec
+// already carries the full set.
+func (f *annotationFilter) filterSpecLabels(labels map[string]string, annotations map[string]string) map[string]string {
+	if f == nil || len(annotations) == 0 {
+		return nil
+	}
+
+	passed := make(map[string]string)
+	withheld := make(map[string]string)
+	for key, value := range annotations {
+		if f.passes(key) {
+			passed[key] = value
+		} else {
+			withheld[key] = value
+		}
+	}
+	if len(withheld) == 0 {
+		return nil
+	}
+
+	if labels != nil {
+		delete(labels, fraktiAnnotationLabel)
+		if len(passed) > 0 {
+			buildLabelsWithAnnotations(labels, passed)
+		}
+	}
+	return withheld
+}
+
+// annotationStore keeps the annotations withheld from hyperd's specs, keyed
+// by sandbox or container ID, so statuses can merge them back in. Like the
+// label index it only knows items created by this process; after a frakti
+// restart withheld annotations of older items are gone from statuses. The
+// zero value is ready to use.
+type annotationStore struct {
+	sync.Mutex
+	annotations map[string]map[string]string
+}
+
+func (s *annotationStore) record(id string, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.annotations == nil {
+		s.annotations = make(map[string]map[string]string)
+	}
+	s.annotations[id] = annotations
+}
+
+// mergeInto adds the withheld annotations of id into dst and returns dst,
+// allocating it when necessary.
+func (s *annotationStore) mergeInto(id string, dst map[string]string) map[string]string {
+	s.Lock()
+	defer s.Unlock()
+	withheld := s.annotations[id]
+	if len(withheld) == 0 {
+		return dst
+	}
+
+	if dst == nil {
+		dst = make(map[string]string, len(withheld))
+	}
+	for key, value := range withheld {
+		dst[key] = value
+	}
+	return dst
+}
+
+func (s *annotationStore) forget(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.annotations, id)
+}
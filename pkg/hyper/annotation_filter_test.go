@@ -0,0 +1,98 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationFilterPasses(t *testing.T) {
+	// Both lists empty means no filter at all.
+	assert.Nil(t, newAnnotationFilter(nil, nil))
+	var nilFilter *annotationFilter
+	assert.True(t, nilFilter.passes("kubernetes.io/config.source"))
+
+	denyOnly := newAnnotationFilter(nil, []string{"kubernetes.io/config."})
+	assert.False(t, denyOnly.passes("kubernetes.io/config.source"))
+	assert.True(t, denyOnly.passes("example.com/team"))
+	// Frakti's own runtime annotations always pass; features depend on them.
+	assert.True(t, denyOnly.passes(stopSignalAnnotationKey))
+
+	allowOnly := newAnnotationFilter([]string{"example.com/"}, nil)
+	assert.True(t, allowOnly.passes("example.com/team"))
+	assert.False(t, allowOnly.passes("kubernetes.io/config.source"))
+	assert.True(t, allowOnly.passes(stopSignalAnnotationKey))
+}
+
+func TestAnnotationFilterRoundTrip(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.annotationFilter = newAnnotationFilter(nil, []string{"kubernetes.io/config."})
+
+	annotations := map[string]string{
+		"kubernetes.io/config.source": "api",
+		"example.com/team":            "infra",
+	}
+	sConfig := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, annotations)
+
+	// The sandbox spec built for hyperd loses the denied annotation but
+	// keeps the passed one; the withheld set goes to frakti's metadata.
+	userpod, err := r.buildUserPod(sConfig)
+	assert.NoError(t, err)
+	withheld := r.annotationFilter.filterSpecLabels(userpod.Labels, sConfig.GetAnnotations())
+	specAnnotations := getAnnotationsFromLabels(userpod.Labels)
+	assert.NotContains(t, specAnnotations, "kubernetes.io/config.source")
+	assert.Equal(t, "infra", specAnnotations["example.com/team"])
+	assert.Equal(t, map[string]string{"kubernetes.io/config.source": "api"}, withheld)
+
+	// The status merges the withheld set back in, as RunPodSandbox records
+	// it after a successful create.
+	podID := "sandboxid"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_1_0",
+		Status:  "Running",
+	}})
+	fakeClient.podInfoMap[podID].Spec.Labels = userpod.Labels
+	r.withheldAnnotations.record(podID, withheld)
+
+	podStatus, err := r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, "api", podStatus.Annotations["kubernetes.io/config.source"])
+	assert.Equal(t, "infra", podStatus.Annotations["example.com/team"])
+
+	// The container path runs end to end through CreateContainer.
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0,
+		map[string]string{}, annotations, nil)
+	containerID, err := r.CreateContainer(podID, config, sConfig)
+	assert.NoError(t, err)
+
+	specAnnotations = getAnnotationsFromLabels(fakeClient.containerInfoMap[containerID].Container.Labels)
+	assert.NotContains(t, specAnnotations, "kubernetes.io/config.source")
+	assert.Equal(t, "infra", specAnnotations["example.com/team"])
+
+	containerStatus, err := r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "api", containerStatus.Annotations["kubernetes.io/config.source"])
+	assert.Equal(t, "infra", containerStatus.Annotations["example.com/team"])
+
+	// Removal drops the retained set.
+	assert.NoError(t, r.RemoveContainer(containerID))
+	assert.NotContains(t, r.withheldAnnotations.annotations, containerID)
+}
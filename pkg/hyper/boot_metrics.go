@@ -0,0 +1,136 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Boot latency metrics complement the per-RPC metrics in metrics.go: for a
+// VM runtime the dominant cost of starting a pod is the VM boot itself, not
+// any single hyperd call, so the end-to-end create→start→ready time is
+// recorded separately.
+var (
+	// sandboxBootLatency records the time from RunPodSandbox being called
+	// until the sandbox VM is started and READY.
+	sandboxBootLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "frakti_sandbox_boot_duration_seconds",
+			Help:    "Time from RunPodSandbox until the sandbox VM is started and READY.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+	)
+	// containerStartLatency records the time from CreateContainer until
+	// the container is started, split by whether the image was already
+	// cached (warm) or had to be pulled first (cold).
+	containerStartLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "frakti_container_start_duration_seconds",
+			Help:    "Time from CreateContainer until the container is started, by cold/warm start.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		},
+		[]string{"start"},
+	)
+)
+
+const (
+	// startKindCold marks a container start whose image was pulled for it.
+	startKindCold = "cold"
+	// startKindWarm marks a container start from an already cached image.
+	startKindWarm = "warm"
+)
+
+func init() {
+	prometheus.MustRegister(sandboxBootLatency)
+	prometheus.MustRegister(containerStartLatency)
+}
+
+// bootTracker correlates container creates with their later starts and
+// remembers which image pulls were cold, so the start latency histogram can
+// be labeled without extra hyperd calls on the start path.
+type bootTracker struct {
+	sync.Mutex
+	// creates maps container ID to its create time and start kind.
+	creates map[string]createRecord
+	// coldImages holds "repo:tag" refs whose last pull found the image
+	// absent from hyperd; the first create consuming such a ref is a
+	// cold start.
+	coldImages map[string]bool
+}
+
+type createRecord struct {
+	at   time.Time
+	kind string
+}
+
+// markColdImage records that the image ref is being pulled from scratch.
+func (t *bootTracker) markColdImage(ref string) {
+	t.Lock()
+	defer t.Unlock()
+	if t.coldImages == nil {
+		t.coldImages = make(map[string]bool)
+	}
+	t.coldImages[ref] = true
+}
+
+// consumeColdImage reports whether the image ref was pulled cold, and
+// clears the mark: once pulled, the image is cached for later containers.
+func (t *bootTracker) consumeColdImage(ref string) bool {
+	t.Lock()
+	defer t.Unlock()
+	if !t.coldImages[ref] {
+		return false
+	}
+	delete(t.coldImages, ref)
+	return true
+}
+
+// recordCreate remembers when the container was created and with what kind
+// of start ahead of it.
+func (t *bootTracker) recordCreate(containerID, kind string) {
+	t.Lock()
+	defer t.Unlock()
+	if t.creates == nil {
+		t.creates = make(map[string]createRecord)
+	}
+	t.creates[containerID] = createRecord{at: time.Now(), kind: kind}
+}
+
+// observeStart records the container's create→start latency, if its create
+// was seen. Restarted containers keep their original kind; the image is
+// cached either way by then.
+func (t *bootTracker) observeStart(containerID string) {
+	t.Lock()
+	record, ok := t.creates[containerID]
+	delete(t.creates, containerID)
+	t.Unlock()
+	if !ok {
+		return
+	}
+	containerStartLatency.WithLabelValues(record.kind).Observe(time.Since(record.at).Seconds())
+}
+
+// forget drops any pending create record, so containers removed before
+// their first start do not linger in the tracker.
+func (t *bootTracker) forget(containerID string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.creates, containerID)
+}
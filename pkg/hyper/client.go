@@ -20,13 +20,18 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/frakti/pkg/hyper/types"
 	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
@@ -52,22 +57,103 @@ const (
 type Client struct {
 	client  types.PublicAPIClient
 	timeout time.Duration
+
+	// pullStallTimeout is how long an image pull may go without any
+	// progress frame from hyperd before it is aborted. This is distinct
+	// from the caller's overall deadline: a pull making steady progress
+	// may run for a long time, while a silent stream fails fast. Zero
+	// means defaultImagePullingStuckTimeout.
+	pullStallTimeout time.Duration
+
+	// versionLock guards apiVersion, the lazily detected hyperd API
+	// version used by the compatibility shims in compat.go.
+	versionLock sync.Mutex
+	apiVersion  string
+
+	// execSessions counts the active exec sessions per container so the
+	// stop path can let in-flight PreStop hooks finish first.
+	execSessions execSessionTracker
 }
 
-// NewClient creates a new hyper client
-func NewClient(server string, timeout time.Duration) (*Client, error) {
-	conn, err := grpc.Dial(server, grpc.WithInsecure(),
-		grpc.WithTimeout(timeout),
-		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
-			return net.DialTimeout("tcp", addr, timeout)
-		}))
-	if err != nil {
-		return nil, err
+// execSessionTracker counts active exec sessions by container ID.
+type execSessionTracker struct {
+	sync.Mutex
+	sessions map[string]int
+}
+
+func (t *execSessionTracker) add(containerID string) {
+	t.Lock()
+	defer t.Unlock()
+	if t.sessions == nil {
+		t.sessions = make(map[string]int)
+	}
+	t.sessions[containerID]++
+}
+
+func (t *execSessionTracker) remove(containerID string) {
+	t.Lock()
+	defer t.Unlock()
+	t.sessions[containerID]--
+	if t.sessions[containerID] <= 0 {
+		delete(t.sessions, containerID)
+	}
+}
+
+func (t *execSessionTracker) active(containerID string) int {
+	t.Lock()
+	defer t.Unlock()
+	return t.sessions[containerID]
+}
+
+// waitExecSessionsDrained waits up to timeout for all exec sessions in the
+// container to finish, and reports whether they did. It is used to keep a
+// container stop from killing kubelet's in-flight PreStop exec before the
+// hook had its grace window.
+func (c *Client) waitExecSessionsDrained(containerID string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if c.execSessions.active(containerID) == 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// NewClient creates a new hyper client. With connPoolSize greater than one
+// it opens that many connections to the same hyperd endpoint and
+// round-robins calls across them, so a single connection does not become a
+// bottleneck under heavy exec/stats/relist load.
+func NewClient(server string, timeout time.Duration, connPoolSize int32, pullStallTimeout time.Duration) (*Client, error) {
+	if connPoolSize < 1 {
+		connPoolSize = 1
+	}
+
+	clients := make([]types.PublicAPIClient, 0, connPoolSize)
+	for i := int32(0); i < connPoolSize; i++ {
+		conn, err := grpc.Dial(server, grpc.WithInsecure(),
+			grpc.WithTimeout(timeout),
+			grpc.WithUnaryInterceptor(hyperdMetricsInterceptor),
+			grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+				return net.DialTimeout("tcp", addr, timeout)
+			}))
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, types.NewPublicAPIClient(conn))
+	}
+
+	client := clients[0]
+	if len(clients) > 1 {
+		client = newPooledAPIClient(clients)
 	}
 
 	return &Client{
-		client:  types.NewPublicAPIClient(conn),
-		timeout: timeout,
+		client:           client,
+		timeout:          timeout,
+		pullStallTimeout: pullStallTimeout,
 	}, nil
 }
 
@@ -93,20 +179,71 @@ func (c *Client) CreatePod(spec *types.UserPod) (string, error) {
 		PodSpec: spec,
 	})
 	if err != nil {
+		// kubelet may retry after an ambiguous failure (e.g. a timeout)
+		// even though hyperd already created the pod. The pod name encodes
+		// the full sandbox identity including the attempt counter, so an
+		// existing pod with the same name is this very sandbox; reuse it
+		// instead of failing or creating a duplicate.
+		if podID, found := c.findPodByName(spec.Id); found {
+			glog.V(3).Infof("Pod %q already exists as %s, reusing it", spec.Id, podID)
+			return podID, nil
+		}
 		return "", err
 	}
 
 	return resp.PodID, nil
 }
 
-// StartPod starts a pod by podID.
-func (c *Client) StartPod(podID string) error {
-	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+// findPodByName returns the ID of the existing pod named name, if any.
+func (c *Client) findPodByName(name string) (string, bool) {
+	podList, err := c.GetPodList()
+	if err != nil {
+		return "", false
+	}
+	for _, p := range podList {
+		if p.PodName == name {
+			return p.PodID, true
+		}
+	}
+	return "", false
+}
+
+// hyperdRetryAttempts is how often idempotent hyperd calls are attempted
+// when they keep failing transiently.
+const hyperdRetryAttempts = 3
+
+// retryTransient runs op up to hyperdRetryAttempts times with a short
+// growing pause while it fails with transient errors (hyperd restarting,
+// timeouts). Only use it for idempotent calls.
+func retryTransient(op func() error) error {
+	var err error
+	for attempt := 0; attempt < hyperdRetryAttempts; attempt++ {
+		if err = op(); !isTransientError(err) {
+			return err
+		}
+		glog.V(3).Infof("Transient hyperd error (attempt %d): %v", attempt+1, err)
+		time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+// StartPod starts a pod by podID. The timeout bounds the VM boot; a
+// non-positive value falls back to the shared hyperd call timeout. A boot
+// that overruns it fails with DeadlineExceeded so kubelet can tell a slow
+// VM from a broken one.
+func (c *Client) StartPod(podID string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = hyperContextTimeout
+	}
+	ctx, cancel := getContextWithTimeout(timeout)
 	defer cancel()
 
 	_, err := c.client.PodStart(ctx, &types.PodStartRequest{
 		PodID: podID,
 	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return status.Errorf(codes.DeadlineExceeded, "pod %s did not boot within %v", podID, timeout)
+	}
 
 	return err
 }
@@ -164,24 +301,32 @@ func (c *Client) GetPodInfo(podID string) (*types.PodInfo, error) {
 	}
 	pod, err := c.client.PodInfo(ctx, &request)
 	if err != nil {
+		if isPodNotFoundError(err, podID) || classifyHyperdError(err) == errorNotFound {
+			return nil, wrapNotFound(ErrPodNotFound, err)
+		}
 		return nil, err
 	}
 
-	return pod.PodInfo, nil
+	return c.adaptPodInfo(pod.PodInfo), nil
 }
 
 // GetPodList get a list of Pods
 func (c *Client) GetPodList() ([]*types.PodListResult, error) {
-	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
-	defer cancel()
-
-	request := types.PodListRequest{}
-	podList, err := c.client.PodList(ctx, &request)
-	if err != nil {
-		return nil, err
-	}
+	var result []*types.PodListResult
+	err := retryTransient(func() error {
+		ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+		defer cancel()
+
+		request := types.PodListRequest{}
+		podList, err := c.client.PodList(ctx, &request)
+		if err != nil {
+			return err
+		}
 
-	return podList.PodList, nil
+		result = podList.PodList
+		return nil
+	})
+	return result, err
 }
 
 // GetContainerInfo gets container info by container name or id
@@ -194,13 +339,35 @@ func (c *Client) GetContainerInfo(container string) (*types.ContainerInfo, error
 	}
 	cinfo, err := c.client.ContainerInfo(ctx, &req)
 	if err != nil {
+		if isContainerNotFoundError(err) {
+			return nil, wrapNotFound(ErrContainerNotFound, err)
+		}
 		return nil, err
 	}
 
 	return cinfo.ContainerInfo, nil
 }
 
-// StartContainer starts a hyper container
+// ContainerExists checks if a container is still known to hyperd. It only
+// needs a single ContainerInfo call, which is much cheaper than a full
+// status request when kubelet merely reconciles container existence.
+func (c *Client) ContainerExists(containerID string) (bool, error) {
+	_, err := c.GetContainerInfo(containerID)
+	if err != nil {
+		if IsContainerNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StartContainer starts a hyper container through hyperd's native
+// single-container start. Older frakti worked around missing support by
+// restarting the whole pod, which bounced unrelated containers in
+// multi-container pods; that fallback is gone, so a failing start is
+// reported to kubelet instead of disturbing the rest of the pod.
 func (c *Client) StartContainer(containerID string) error {
 	isRunning, err := isContainerRunning(c, containerID)
 	if err != nil {
@@ -229,7 +396,7 @@ func (c *Client) RemoveContainer(containerID string) error {
 
 	_, err := c.client.ContainerRemove(ctx, &types.ContainerRemoveRequest{ContainerId: containerID})
 	if err != nil {
-		if strings.Contains(err.Error(), "cannot find container") {
+		if isContainerNotFoundError(err) {
 			return nil
 		}
 		return err
@@ -269,12 +436,6 @@ func (c *Client) GetImageInfo(image, tag string) (*types.ImageInfo, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	// check if tag is digest
-	repoSep := ":"
-	if strings.Index(tag, ":") > 0 {
-		repoSep = "@"
-	}
-
 	// TODO: use filter to get the image.
 	req := types.ImageListRequest{}
 	imageList, err := c.client.ImageList(ctx, &req)
@@ -282,6 +443,23 @@ func (c *Client) GetImageInfo(image, tag string) (*types.ImageInfo, error) {
 		return nil, err
 	}
 
+	if info := findImageInfo(imageList.ImageList, image, tag); info != nil {
+		return info, nil
+	}
+
+	return nil, wrapNotFound(ErrImageNotFound, fmt.Errorf("no %q with tag %q in hyperd", image, tag))
+}
+
+// findImageInfo looks image:tag up in an already fetched image list, using
+// the same reference matching as GetImageInfo. It returns nil when the list
+// holds no such image.
+func findImageInfo(imageList []*types.ImageInfo, image, tag string) *types.ImageInfo {
+	// check if tag is digest
+	repoSep := ":"
+	if strings.Index(tag, ":") > 0 {
+		repoSep = "@"
+	}
+
 	// change `docker.io/library/imageName` to `imageName`
 	if split := strings.Split(image, "/"); len(split) == 3 &&
 		split[0] == defaultDomain &&
@@ -290,20 +468,19 @@ func (c *Client) GetImageInfo(image, tag string) (*types.ImageInfo, error) {
 	}
 
 	fullImageName := fmt.Sprintf("%s%s%s", image, repoSep, tag)
-	for _, image := range imageList.ImageList {
-		for _, i := range image.RepoDigests {
+	for _, info := range imageList {
+		for _, i := range info.RepoDigests {
 			if i == fullImageName {
-				return image, nil
+				return info
 			}
 		}
-		for _, i := range image.RepoTags {
+		for _, i := range info.RepoTags {
 			if i == fullImageName {
-				return image, nil
+				return info
 			}
 		}
 	}
-
-	return nil, fmt.Errorf("image %q with tag %q not found", image, tag)
+	return nil
 }
 
 // GetImages gets a list of images
@@ -320,9 +497,30 @@ func (c *Client) GetImages() ([]*types.ImageInfo, error) {
 	return imageList.ImageList, nil
 }
 
-// PullImage pulls a image from registry
-func (c *Client) PullImage(image, tag string, auth *types.AuthConfig, out io.Writer) error {
-	ctx, cancel := getContextWithCancel()
+// imageDigestRegexp matches the manifest digest the registry reports in
+// the pull progress stream, e.g. "Digest: sha256:abcd...".
+var imageDigestRegexp = regexp.MustCompile(`sha256:[0-9a-f]{64}`)
+
+// PullImage pulls a image from registry. It returns the manifest digest the
+// pull resolved to when the registry reported one in the progress stream, so
+// callers can record which digest a tag pull actually fetched. Cancelling
+// ctx aborts the pull; hyperd discards the partially fetched layers.
+//
+// platform is the "os/arch[/variant]" the image is wanted for; empty means
+// the node's own platform. hyperd's pull RPC carries no platform field and
+// always resolves multi-arch manifest lists to the daemon's platform, so a
+// platform other than the node's is rejected here rather than silently
+// pulling the wrong variant.
+func (c *Client) PullImage(ctx context.Context, image, tag, platform string, auth *types.AuthConfig, out io.Writer) (string, error) {
+	if platform == "" {
+		platform = nodePlatform()
+	}
+	if err := validatePullPlatform(platform); err != nil {
+		return "", err
+	}
+	glog.V(3).Infof("Pulling image %s:%s for platform %s", image, tag, platform)
+
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	request := types.ImagePullRequest{
@@ -332,35 +530,62 @@ func (c *Client) PullImage(image, tag string, auth *types.AuthConfig, out io.Wri
 	}
 	stream, err := c.client.ImagePull(ctx, &request)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	stallTimeout := c.pullStallTimeout
+	if stallTimeout <= 0 {
+		stallTimeout = defaultImagePullingStuckTimeout
 	}
 
 	errC := make(chan error)
 	progressC := make(chan struct{})
-	ticker := time.NewTicker(defaultImagePullingStuckTimeout)
+	ticker := time.NewTicker(stallTimeout)
 	defer ticker.Stop()
 
+	// resolvedDigest is only written by the receive goroutine; the send on
+	// errC orders those writes before the reads below. All sends select on
+	// ctx.Done so the goroutine does not leak when the loop below returns
+	// early (stall or cancellation); the deferred cancel releases it.
+	resolvedDigest := ""
 	go func() {
 		for {
 			res, err := stream.Recv()
 			if err == io.EOF {
-				errC <- nil
+				select {
+				case errC <- nil:
+				case <-ctx.Done():
+				}
 				return
 			}
 			if err != nil {
-				errC <- err
+				select {
+				case errC <- err:
+				case <-ctx.Done():
+				}
+				return
+			}
+			if strings.Contains(string(res.Data), "Digest:") {
+				if digest := imageDigestRegexp.FindString(string(res.Data)); digest != "" {
+					resolvedDigest = digest
+				}
+			}
+			select {
+			case progressC <- struct{}{}:
+			case <-ctx.Done():
 				return
 			}
-			progressC <- struct{}{}
 
 			if out != nil {
 				n, err := out.Write(res.Data)
-				if err != nil {
-					errC <- err
-					return
+				if err == nil && n != len(res.Data) {
+					err = io.ErrShortWrite
 				}
-				if n != len(res.Data) {
-					errC <- io.ErrShortWrite
+				if err != nil {
+					select {
+					case errC <- err:
+					case <-ctx.Done():
+					}
 					return
 				}
 			}
@@ -369,17 +594,24 @@ func (c *Client) PullImage(image, tag string, auth *types.AuthConfig, out io.Wri
 
 	for {
 		select {
+		case <-ctx.Done():
+			// The caller gave up (kubelet retry, pod removed); abort
+			// rather than waiting out the stall window.
+			return "", ctx.Err()
 		case <-ticker.C:
 			// pulling image timeout, cancel it
-			return fmt.Errorf("Cancel pulling image %q because of no progress for %v", image, defaultImagePullingStuckTimeout)
+			return "", fmt.Errorf("Cancel pulling image %q because of no progress for %v", image, stallTimeout)
 		case err = <-errC:
 			// if nil, got EOF, session finished
 			// else return err
-			return err
+			if err != nil {
+				return "", err
+			}
+			return resolvedDigest, nil
 		case <-progressC:
 			// got progress from pulling image, reset the clock
 			ticker.Stop()
-			ticker = time.NewTicker(defaultImagePullingStuckTimeout)
+			ticker = time.NewTicker(stallTimeout)
 		}
 	}
 }
@@ -401,16 +633,21 @@ func (c *Client) RemoveImage(image, tag string) error {
 
 // GetContainerList gets a list of containers
 func (c *Client) GetContainerList() ([]*types.ContainerListResult, error) {
-	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
-	defer cancel()
-
-	req := types.ContainerListRequest{}
-	containerList, err := c.client.ContainerList(ctx, &req)
-	if err != nil {
-		return nil, err
-	}
+	var result []*types.ContainerListResult
+	err := retryTransient(func() error {
+		ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+		defer cancel()
+
+		req := types.ContainerListRequest{}
+		containerList, err := c.client.ContainerList(ctx, &req)
+		if err != nil {
+			return err
+		}
 
-	return containerList.ContainerList, nil
+		result = containerList.ContainerList
+		return nil
+	})
+	return result, err
 }
 
 // CreateContainer creates a container
@@ -472,6 +709,9 @@ func (c *Client) ExecInContainer(containerId string, cmd []string, stdin io.Read
 		return err
 	}
 
+	c.execSessions.add(containerId)
+	defer c.execSessions.remove(containerId)
+
 	req := types.ExecStartRequest{
 		ContainerID: containerId,
 		ExecID:      execID,
@@ -502,6 +742,7 @@ func (c *Client) ExecInContainer(containerId string, cmd []string, stdin io.Read
 		return err
 	}
 	if err := stream.Send(&req); err != nil {
+		c.killExecSession(containerId, execID)
 		return err
 	}
 
@@ -571,6 +812,9 @@ func (c *Client) ExecInContainer(containerId string, cmd []string, stdin io.Read
 
 	if stdout != nil || stderr != nil {
 		if err := <-recvStdoutError; err != nil {
+			// The client went away or writing to it failed, make sure the
+			// exec session inside hyperd does not outlive the stream.
+			c.killExecSession(containerId, execID)
 			return err
 		}
 	}
@@ -584,6 +828,27 @@ func (c *Client) ExecInContainer(containerId string, cmd []string, stdin io.Read
 	return utilexec.CodeExitError{Err: fmt.Errorf("Exit with code %d", exitCode), Code: int(exitCode)}
 }
 
+// ExecSignal sends a signal to an exec session in hyperd.
+func (c *Client) ExecSignal(containerID, execID string, signal int64) error {
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	_, err := c.client.ExecSignal(ctx, &types.ExecSignalRequest{
+		ContainerID: containerID,
+		ExecID:      execID,
+		Signal:      signal,
+	})
+	return err
+}
+
+// killExecSession kills the exec session in hyperd with SIGKILL. It is a
+// best-effort cleanup for aborted streams, so failures are only logged.
+func (c *Client) killExecSession(containerID, execID string) {
+	if err := c.ExecSignal(containerID, execID, int64(syscall.SIGKILL)); err != nil {
+		glog.Errorf("Kill exec session %s/%s failed: %v", containerID, execID, err)
+	}
+}
+
 // Wait gets exit code by containerID and execID
 func (c *Client) Wait(containerId, execId string, noHang bool) (int32, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
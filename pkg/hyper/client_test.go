@@ -0,0 +1,47 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestCreatePodIdempotent(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	spec := &types.UserPod{Id: "k8s_POD_foo_bar_12345_1"}
+
+	podID, err := r.client.CreatePod(spec)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, podID)
+
+	// A retried create after an ambiguous failure finds the pod hyperd
+	// already created and reuses it instead of failing or duplicating.
+	retriedID, err := r.client.CreatePod(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, podID, retriedID)
+	assert.Len(t, fakeClient.podInfoMap, 1)
+
+	// A different sandbox identity still creates a fresh pod.
+	otherID, err := r.client.CreatePod(&types.UserPod{Id: "k8s_POD_foo_bar_12345_2"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, podID, otherID)
+	assert.Len(t, fakeClient.podInfoMap, 2)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// hyperd API versions at which request or response shapes changed. frakti
+// supports a range of hyperd releases by adapting the differences here in
+// Client, so the rest of the code only deals with the current shape.
+const (
+	// apiVersionBarePodIP is the first hyperd API version that reports
+	// pod IPs as bare addresses; older versions append the CIDR prefix
+	// length to each entry.
+	apiVersionBarePodIP = "0.2.0"
+)
+
+// detectAPIVersion returns hyperd's API version from the Version RPC,
+// caching the answer for subsequent calls. It returns an empty string when
+// the version cannot be determined.
+func (c *Client) detectAPIVersion() string {
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	if c.apiVersion != "" {
+		return c.apiVersion
+	}
+
+	_, apiVersion, err := c.GetVersion()
+	if err != nil {
+		glog.V(3).Infof("Detect hyperd API version failed: %v", err)
+		return ""
+	}
+
+	c.apiVersion = apiVersion
+	return c.apiVersion
+}
+
+// apiVersionBefore reports whether the hyperd API version is older than
+// boundary. The version carried in the response is preferred, falling back
+// to the detected daemon version. When no version can be determined or
+// parsed, responses are assumed to already have the current shape.
+func (c *Client) apiVersionBefore(responseVersion, boundary string) bool {
+	apiVersion := responseVersion
+	if apiVersion == "" {
+		apiVersion = c.detectAPIVersion()
+	}
+	if apiVersion == "" {
+		return false
+	}
+
+	detected, err := semver.NewVersion(apiVersion)
+	if err != nil {
+		glog.V(3).Infof("Parse hyperd API version %q failed: %v", apiVersion, err)
+		return false
+	}
+	boundaryVersion, err := semver.NewVersion(boundary)
+	if err != nil {
+		glog.V(3).Infof("Parse hyperd API version %q failed: %v", boundary, err)
+		return false
+	}
+	return detected.LessThan(*boundaryVersion)
+}
+
+// adaptPodInfo translates version-specific PodInfo shapes into the current
+// one. hyperd older than apiVersionBarePodIP reports pod IPs with a CIDR
+// prefix length appended, which is stripped here so callers always see bare
+// addresses.
+func (c *Client) adaptPodInfo(podInfo *types.PodInfo) *types.PodInfo {
+	if podInfo == nil || podInfo.Status == nil {
+		return podInfo
+	}
+
+	if c.apiVersionBefore(podInfo.ApiVersion, apiVersionBarePodIP) {
+		for i, ip := range podInfo.Status.PodIP {
+			if idx := strings.Index(ip, "/"); idx >= 0 {
+				podInfo.Status.PodIP[i] = ip[:idx]
+			}
+		}
+	}
+	return podInfo
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiVersionBefore(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.SetVersion("1.0.0", "0.1.0")
+
+	// The version from the response wins over the detected daemon version.
+	assert.False(t, r.client.apiVersionBefore("0.2.0", apiVersionBarePodIP))
+	assert.True(t, r.client.apiVersionBefore("0.1.0", apiVersionBarePodIP))
+
+	// Without a response version the daemon version is detected and cached.
+	assert.True(t, r.client.apiVersionBefore("", apiVersionBarePodIP))
+	assert.Equal(t, "0.1.0", r.client.apiVersion)
+
+	// An unparsable version assumes the current shape.
+	assert.False(t, r.client.apiVersionBefore("bogus", apiVersionBarePodIP))
+}
+
+func TestGetPodInfoAdaptsOldPodIP(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+
+	// hyperd before apiVersionBarePodIP appends the CIDR prefix length
+	// to pod IPs; the shim strips it.
+	fakeClient.SetVersion("1.0.0", "0.1.0")
+	fakeClient.podInfoMap[podID].Status.PodIP = []string{"10.244.1.2/24"}
+	podInfo, err := r.client.GetPodInfo(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.244.1.2"}, podInfo.Status.PodIP)
+
+	// Newer hyperd already reports bare addresses, nothing to adapt.
+	r.client.apiVersion = ""
+	fakeClient.SetVersion("1.1.0", "0.2.0")
+	fakeClient.podInfoMap[podID].Status.PodIP = []string{"10.244.1.3"}
+	podInfo, err = r.client.GetPodInfo(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.244.1.3"}, podInfo.Status.PodIP)
+}
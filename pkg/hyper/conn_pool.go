@@ -0,0 +1,205 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// pooledAPIClient fans hyperd API calls out over a pool of gRPC
+// connections in round-robin order, so heavy exec/stats/relist traffic is
+// not serialized onto a single connection. Every call picks the next
+// connection; a streaming call therefore stays pinned to the connection it
+// was opened on for the lifetime of its stream.
+type pooledAPIClient struct {
+	clients []types.PublicAPIClient
+
+	// next is the round-robin cursor, advanced atomically.
+	next uint64
+}
+
+// newPooledAPIClient builds a PublicAPIClient that round-robins over the
+// given per-connection clients.
+func newPooledAPIClient(clients []types.PublicAPIClient) types.PublicAPIClient {
+	return &pooledAPIClient{clients: clients}
+}
+
+func (p *pooledAPIClient) pick() types.PublicAPIClient {
+	next := atomic.AddUint64(&p.next, 1)
+	return p.clients[next%uint64(len(p.clients))]
+}
+
+func (p *pooledAPIClient) PodList(ctx context.Context, in *types.PodListRequest, opts ...grpc.CallOption) (*types.PodListResponse, error) {
+	return p.pick().PodList(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodCreate(ctx context.Context, in *types.PodCreateRequest, opts ...grpc.CallOption) (*types.PodCreateResponse, error) {
+	return p.pick().PodCreate(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodInfo(ctx context.Context, in *types.PodInfoRequest, opts ...grpc.CallOption) (*types.PodInfoResponse, error) {
+	return p.pick().PodInfo(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodRemove(ctx context.Context, in *types.PodRemoveRequest, opts ...grpc.CallOption) (*types.PodRemoveResponse, error) {
+	return p.pick().PodRemove(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodStart(ctx context.Context, in *types.PodStartRequest, opts ...grpc.CallOption) (*types.PodStartResponse, error) {
+	return p.pick().PodStart(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodStop(ctx context.Context, in *types.PodStopRequest, opts ...grpc.CallOption) (*types.PodStopResponse, error) {
+	return p.pick().PodStop(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodSignal(ctx context.Context, in *types.PodSignalRequest, opts ...grpc.CallOption) (*types.PodSignalResponse, error) {
+	return p.pick().PodSignal(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodPause(ctx context.Context, in *types.PodPauseRequest, opts ...grpc.CallOption) (*types.PodPauseResponse, error) {
+	return p.pick().PodPause(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodUnpause(ctx context.Context, in *types.PodUnpauseRequest, opts ...grpc.CallOption) (*types.PodUnpauseResponse, error) {
+	return p.pick().PodUnpause(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ExecVM(ctx context.Context, opts ...grpc.CallOption) (types.PublicAPI_ExecVMClient, error) {
+	return p.pick().ExecVM(ctx, opts...)
+}
+
+func (p *pooledAPIClient) ContainerList(ctx context.Context, in *types.ContainerListRequest, opts ...grpc.CallOption) (*types.ContainerListResponse, error) {
+	return p.pick().ContainerList(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerInfo(ctx context.Context, in *types.ContainerInfoRequest, opts ...grpc.CallOption) (*types.ContainerInfoResponse, error) {
+	return p.pick().ContainerInfo(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ImageList(ctx context.Context, in *types.ImageListRequest, opts ...grpc.CallOption) (*types.ImageListResponse, error) {
+	return p.pick().ImageList(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) VMList(ctx context.Context, in *types.VMListRequest, opts ...grpc.CallOption) (*types.VMListResponse, error) {
+	return p.pick().VMList(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) SetPodLabels(ctx context.Context, in *types.PodLabelsRequest, opts ...grpc.CallOption) (*types.PodLabelsResponse, error) {
+	return p.pick().SetPodLabels(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) PodStats(ctx context.Context, in *types.PodStatsRequest, opts ...grpc.CallOption) (*types.PodStatsResponse, error) {
+	return p.pick().PodStats(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerLogs(ctx context.Context, in *types.ContainerLogsRequest, opts ...grpc.CallOption) (types.PublicAPI_ContainerLogsClient, error) {
+	return p.pick().ContainerLogs(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerCreate(ctx context.Context, in *types.ContainerCreateRequest, opts ...grpc.CallOption) (*types.ContainerCreateResponse, error) {
+	return p.pick().ContainerCreate(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerStart(ctx context.Context, in *types.ContainerStartRequest, opts ...grpc.CallOption) (*types.ContainerStartResponse, error) {
+	return p.pick().ContainerStart(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerRename(ctx context.Context, in *types.ContainerRenameRequest, opts ...grpc.CallOption) (*types.ContainerRenameResponse, error) {
+	return p.pick().ContainerRename(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerSignal(ctx context.Context, in *types.ContainerSignalRequest, opts ...grpc.CallOption) (*types.ContainerSignalResponse, error) {
+	return p.pick().ContainerSignal(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerStop(ctx context.Context, in *types.ContainerStopRequest, opts ...grpc.CallOption) (*types.ContainerStopResponse, error) {
+	return p.pick().ContainerStop(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ContainerRemove(ctx context.Context, in *types.ContainerRemoveRequest, opts ...grpc.CallOption) (*types.ContainerRemoveResponse, error) {
+	return p.pick().ContainerRemove(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ExecCreate(ctx context.Context, in *types.ExecCreateRequest, opts ...grpc.CallOption) (*types.ExecCreateResponse, error) {
+	return p.pick().ExecCreate(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ExecStart(ctx context.Context, opts ...grpc.CallOption) (types.PublicAPI_ExecStartClient, error) {
+	return p.pick().ExecStart(ctx, opts...)
+}
+
+func (p *pooledAPIClient) ExecSignal(ctx context.Context, in *types.ExecSignalRequest, opts ...grpc.CallOption) (*types.ExecSignalResponse, error) {
+	return p.pick().ExecSignal(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) Attach(ctx context.Context, opts ...grpc.CallOption) (types.PublicAPI_AttachClient, error) {
+	return p.pick().Attach(ctx, opts...)
+}
+
+func (p *pooledAPIClient) Wait(ctx context.Context, in *types.WaitRequest, opts ...grpc.CallOption) (*types.WaitResponse, error) {
+	return p.pick().Wait(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) TTYResize(ctx context.Context, in *types.TTYResizeRequest, opts ...grpc.CallOption) (*types.TTYResizeResponse, error) {
+	return p.pick().TTYResize(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ServiceList(ctx context.Context, in *types.ServiceListRequest, opts ...grpc.CallOption) (*types.ServiceListResponse, error) {
+	return p.pick().ServiceList(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ServiceAdd(ctx context.Context, in *types.ServiceAddRequest, opts ...grpc.CallOption) (*types.ServiceAddResponse, error) {
+	return p.pick().ServiceAdd(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ServiceDelete(ctx context.Context, in *types.ServiceDelRequest, opts ...grpc.CallOption) (*types.ServiceDelResponse, error) {
+	return p.pick().ServiceDelete(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ServiceUpdate(ctx context.Context, in *types.ServiceUpdateRequest, opts ...grpc.CallOption) (*types.ServiceUpdateResponse, error) {
+	return p.pick().ServiceUpdate(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ImagePull(ctx context.Context, in *types.ImagePullRequest, opts ...grpc.CallOption) (types.PublicAPI_ImagePullClient, error) {
+	return p.pick().ImagePull(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ImagePush(ctx context.Context, in *types.ImagePushRequest, opts ...grpc.CallOption) (types.PublicAPI_ImagePushClient, error) {
+	return p.pick().ImagePush(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) ImageRemove(ctx context.Context, in *types.ImageRemoveRequest, opts ...grpc.CallOption) (*types.ImageRemoveResponse, error) {
+	return p.pick().ImageRemove(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) Ping(ctx context.Context, in *types.PingRequest, opts ...grpc.CallOption) (*types.PingResponse, error) {
+	return p.pick().Ping(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) Info(ctx context.Context, in *types.InfoRequest, opts ...grpc.CallOption) (*types.InfoResponse, error) {
+	return p.pick().Info(ctx, in, opts...)
+}
+
+func (p *pooledAPIClient) Version(ctx context.Context, in *types.VersionRequest, opts ...grpc.CallOption) (*types.VersionResponse, error) {
+	return p.pick().Version(ctx, in, opts...)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestPooledClientRoundRobin(t *testing.T) {
+	fakes := []*fakeClientInterface{
+		newFakeClientInterface(nil),
+		newFakeClientInterface(nil),
+		newFakeClientInterface(nil),
+	}
+	clients := make([]types.PublicAPIClient, 0, len(fakes))
+	for _, fake := range fakes {
+		clients = append(clients, fake)
+	}
+	pooled := newPooledAPIClient(clients)
+
+	for i := 0; i < 6; i++ {
+		_, err := pooled.PodList(context.Background(), &types.PodListRequest{})
+		assert.NoError(t, err)
+	}
+
+	// The calls are spread evenly over the pool.
+	for i, fake := range fakes {
+		fake.Lock()
+		assert.Len(t, fake.called, 2, "connection %d", i)
+		fake.Unlock()
+	}
+}
+
+// benchmarkRelist measures a kubelet-style container relist against fake
+// connections, so the single-connection and pooled configurations can be
+// compared with `go test -bench Relist`.
+func benchmarkRelist(b *testing.B, connPoolSize int) {
+	clients := make([]types.PublicAPIClient, 0, connPoolSize)
+	for i := 0; i < connPoolSize; i++ {
+		fake := newFakeClientInterface(nil)
+		containers := make([]*FakeContainer, 0, 10)
+		for j := 0; j < 10; j++ {
+			containers = append(containers, &FakeContainer{
+				ID:     fmt.Sprintf("c*%d", j),
+				Name:   fmt.Sprintf("k8s_sidecar%d_foo_bar_p*0_1", j),
+				Status: "running",
+				PodID:  "p*0",
+			})
+		}
+		fake.SetFakeContainers(containers)
+		clients = append(clients, fake)
+	}
+
+	apiClient := clients[0]
+	if len(clients) > 1 {
+		apiClient = newPooledAPIClient(clients)
+	}
+	r := &Runtime{
+		client:          &Client{client: apiClient},
+		sandboxLabels:   newLabelIndex(),
+		containerLabels: newLabelIndex(),
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := r.ListContainers(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRelistSingleConn(b *testing.B) { benchmarkRelist(b, 1) }
+
+func BenchmarkRelistPooled(b *testing.B) { benchmarkRelist(b, 4) }
@@ -18,12 +18,19 @@ package hyper
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/selinux/go-selinux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"k8s.io/frakti/pkg/hyper/types"
 	"k8s.io/frakti/pkg/util/knownflags"
@@ -33,22 +40,124 @@ import (
 
 const (
 	volDriver = "vfs"
+
+	// Security profile names understood by kubelet.
+	securityProfileRuntimeDefault = "runtime/default"
+	securityProfileDockerDefault  = "docker/default"
+	securityProfileUnconfined     = "unconfined"
 )
 
 // CreateContainer creates a new container in specified PodSandbox
 func (h *Runtime) CreateContainer(podSandboxID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
+	if err := h.checkContainerCapacity(); err != nil {
+		glog.Errorf("Create container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
+		return "", err
+	}
+	if err := h.checkStorageFreeSpace(); err != nil {
+		glog.Errorf("Create container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
+		return "", err
+	}
+
+	// Fail early with a clear error when the sandbox is not ready (still
+	// starting or already dead); hyperd would otherwise reject the create
+	// with a confusing internal error.
+	running, err := isPodSandboxRunning(h.client, podSandboxID)
+	if err != nil {
+		glog.Errorf("Get sandbox %s state for creating container %s failed: %v", podSandboxID, config.Metadata.Name, err)
+		return "", err
+	}
+	if !running {
+		err := status.Errorf(codes.FailedPrecondition, "cannot create container %s: sandbox %s is not ready", config.Metadata.Name, podSandboxID)
+		glog.Errorf("Create container failed: %v", err)
+		return "", err
+	}
+
+	// Optionally verify the image has been pulled, so a missing image
+	// surfaces as a clear error telling kubelet to pull first instead of
+	// a confusing hyperd create failure.
+	if h.verifyImagePresence {
+		image, err := h.ImageStatus(config.GetImage())
+		if err != nil {
+			glog.Errorf("Check presence of image %q for container %s failed: %v", config.GetImage().GetImage(), config.Metadata.Name, err)
+			return "", err
+		}
+		if image == nil {
+			err := status.Errorf(codes.NotFound, "image %q not present: pull it before creating container %s", config.GetImage().GetImage(), config.Metadata.Name)
+			glog.Errorf("Create container failed: %v", err)
+			return "", err
+		}
+	}
+
+	// Likewise fail early when the image declares hypervisor requirements
+	// the sandbox's VM driver does not meet.
+	if err := checkHandlerCompatibility(config, sandboxConfig); err != nil {
+		glog.Errorf("Create container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
+		return "", err
+	}
+
+	// A command of empty or whitespace strings cannot be exec'ed and would
+	// produce a broken spec; reject it here and let a genuinely absent
+	// command fall back to the image default.
+	if err := normalizeContainerCommand(config); err != nil {
+		glog.Errorf("Create container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
+		return "", err
+	}
+
+	applyDefaultSeccompProfile(config, h.defaultSeccompProfile)
+
 	containerSpec, err := buildUserContainer(config, sandboxConfig)
 	if err != nil {
 		glog.Errorf("Build UserContainer for container %q failed: %v", config.String(), err)
 		return "", err
 	}
 
+	// Queue behind other in-flight creates when VM-boot concurrency is
+	// bounded. The CRI call carries no caller context here, so the wait
+	// is capped by the same timeout as hyperd calls.
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+	if err := h.createLimiter.acquire(ctx); err != nil {
+		glog.Errorf("Waiting for a create slot for container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
+		return "", err
+	}
+	defer h.createLimiter.release()
+
+	// Withhold bulky or irrelevant annotations from the container spec;
+	// the status path merges them back from frakti's own metadata.
+	withheldAnnotations := h.annotationFilter.filterSpecLabels(containerSpec.Labels, config.GetAnnotations())
+
+	// Grow the VM first when this container pushes the sandbox's
+	// aggregate requirement past its current sizing, so the container
+	// does not start into a VM that cannot hold it.
+	rollbackResize, err := h.ensureSandboxCapacity(podSandboxID, config)
+	if err != nil {
+		glog.Errorf("Ensure capacity of sandbox %s for container %s failed: %v", podSandboxID, config.Metadata.Name, err)
+		return "", err
+	}
+
 	containerID, err := h.client.CreateContainer(podSandboxID, containerSpec)
 	if err != nil {
+		rollbackResize()
 		glog.Errorf("Create container %s in pod %s failed: %v", config.Metadata.Name, podSandboxID, err)
 		return "", err
 	}
 
+	h.containerLabels.Add(containerID, config.GetLabels())
+	h.specSnapshots.record(containerID, redactUserContainer(containerSpec))
+	h.withheldAnnotations.record(containerID, withheldAnnotations)
+	if vcpu, memoryMB := containerVMResources(config); vcpu > 0 || memoryMB > 0 {
+		h.reservations.record(containerID, podSandboxID, vcpu, memoryMB)
+	}
+
+	// Classify the upcoming start for the boot latency metrics: the first
+	// container created from a freshly pulled image is a cold start.
+	kind := startKindWarm
+	repo, tag := parseRepositoryTag(config.GetImage().GetImage())
+	if h.bootTimes.consumeColdImage(repo + ":" + tag) {
+		kind = startKindCold
+	}
+	h.bootTimes.recordCreate(containerID, kind)
+
 	return containerID, nil
 }
 
@@ -71,16 +180,55 @@ type VolumeOptsData struct {
 }
 
 // buildUserContainer builds hyperd's UserContainer based kubelet ContainerConfig.
+// normalizeContainerCommand validates the container's command and args
+// before they reach the spec. An absent command legitimately falls back to
+// the image's default entrypoint, but a command whose executable is an empty
+// or whitespace string is clearly broken and is rejected with
+// InvalidArgument before hyperd fails it obscurely inside the VM. Args that
+// are all empty strings are dropped for the same image-default fallback;
+// mixed args keep their empty entries, since "" can be a meaningful
+// argument.
+func normalizeContainerCommand(config *kubeapi.ContainerConfig) error {
+	if len(config.Command) > 0 && strings.TrimSpace(config.Command[0]) == "" {
+		return status.Errorf(codes.InvalidArgument, "container %s has an empty or whitespace command; omit the command to use the image default", config.Metadata.Name)
+	}
+
+	allEmpty := len(config.Args) > 0
+	for _, arg := range config.Args {
+		if arg != "" {
+			allEmpty = false
+			break
+		}
+	}
+	if allEmpty {
+		config.Args = nil
+	}
+	return nil
+}
+
 func buildUserContainer(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (*types.UserContainer, error) {
+	// Privileged implies the full capability set and relaxed restrictions;
+	// expand it before translating the security context, so the rest of
+	// the translation sees the effective settings.
+	if sc := config.GetLinux().GetSecurityContext(); sc.GetPrivileged() {
+		config.Linux.SecurityContext = expandPrivileged(sc)
+	}
+
 	privilege := false
 	readonlyRootfs := false
 	if securityContext := config.GetLinux().GetSecurityContext(); securityContext != nil {
 		privilege = securityContext.Privileged
 		readonlyRootfs = securityContext.ReadonlyRootfs
+
+		if err := verifySecurityProfiles(securityContext); err != nil {
+			return nil, err
+		}
 	}
 
 	if privilege {
-		return nil, fmt.Errorf("Privileged containers are not supported in hyper")
+		if err := unsupportedFeature("Privileged containers are not supported in hyper"); err != nil {
+			return nil, err
+		}
 	}
 
 	logPath := filepath.Join(sandboxConfig.LogDirectory, config.LogPath)
@@ -88,6 +236,36 @@ func buildUserContainer(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.
 		config.Labels = make(map[string]string)
 	}
 	config.Labels[containerLogPathLabelKey] = logPath
+	recordContainerVMResources(config)
+
+	// OOM score adjustment can not be enforced inside the VM by hyperd, so
+	// record the clamped value in container labels and warn about it instead
+	// of silently dropping the request.
+	if oomScoreAdj := config.GetLinux().GetResources().GetOomScoreAdj(); oomScoreAdj != 0 {
+		clampedOomScoreAdj := clampOomScoreAdj(oomScoreAdj)
+		if clampedOomScoreAdj != oomScoreAdj {
+			glog.Warningf("OOM score adjustment %d of container %q is out of range, clamped to %d", oomScoreAdj, config.GetMetadata().Name, clampedOomScoreAdj)
+		}
+		glog.Warningf("OOM score adjustment %d of container %q can not be honored by hyperd", clampedOomScoreAdj, config.GetMetadata().Name)
+		config.Labels[oomScoreAdjLabelKey] = strconv.FormatInt(clampedOomScoreAdj, 10)
+	}
+
+	// The effective seccomp profile travels to hyperd as a label, since
+	// the container spec has no seccomp field.
+	if profile := config.GetLinux().GetSecurityContext().GetSeccompProfilePath(); profile != "" {
+		config.Labels[seccompProfileLabelKey] = profile
+	}
+
+	// hyperd keeps an attachable stdin for every container, but its spec
+	// has no Stdin/StdinOnce fields, so record the requested semantics in
+	// labels for the attach path to honor (see streamingRuntime.Attach).
+	if config.Stdin {
+		config.Labels[stdinLabelKey] = "true"
+		if config.StdinOnce {
+			config.Labels[stdinOnceLabelKey] = "true"
+		}
+	}
+
 	containerSpec := &types.UserContainer{
 		Name:       buildContainerName(sandboxConfig, config),
 		Image:      config.GetImage().Image,
@@ -107,17 +285,217 @@ func buildUserContainer(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.
 	}
 	containerSpec.Volumes = volumes
 
+	// inject the pod's hosts, hostname and resolv.conf files, kept
+	// consistent with the sandbox config across all of its containers
+	files, err := makePodFiles(sandboxConfig)
+	if err != nil {
+		return nil, err
+	}
+	containerSpec.Files = files
+
 	// make environments
-	environments := make([]*types.EnvironmentVar, len(config.Envs))
-	for idx, env := range config.Envs {
-		environments[idx] = &types.EnvironmentVar{
+	environments, err := makeContainerEnvs(config)
+	if err != nil {
+		return nil, err
+	}
+	containerSpec.Envs = environments
+
+	// The stop signal reaches hyperd through the container spec; the
+	// grace period is handled at stop time via the stop call's timeout.
+	stopSignal, err := resolveStopSignal(config, sandboxConfig)
+	if err != nil {
+		return nil, err
+	}
+	containerSpec.StopSignal = stopSignal
+
+	// cgroup v2 "unified" resources, carried as container annotations
+	// until the CRI has them first-class.
+	if err := applyUnifiedResources(containerSpec, unifiedResources(config)); err != nil {
+		return nil, err
+	}
+
+	return containerSpec, nil
+}
+
+// makeContainerEnvs builds the env slice for the container spec. Keys are
+// de-duplicated with the last value winning, matching how Kubernetes
+// resolves repeated env entries, since hyperd's behavior for duplicates is
+// undefined. Empty keys are rejected.
+func makeContainerEnvs(config *kubeapi.ContainerConfig) ([]*types.EnvironmentVar, error) {
+	environments := make([]*types.EnvironmentVar, 0, len(config.Envs))
+	seen := make(map[string]int, len(config.Envs))
+	for _, env := range config.Envs {
+		if env.Key == "" {
+			return nil, fmt.Errorf("environment variable with empty key in container %q", config.Metadata.Name)
+		}
+		if idx, ok := seen[env.Key]; ok {
+			environments[idx].Value = env.Value
+			continue
+		}
+		seen[env.Key] = len(environments)
+		environments = append(environments, &types.EnvironmentVar{
 			Env:   env.Key,
 			Value: env.Value,
+		})
+	}
+	return environments, nil
+}
+
+// expandPrivileged returns a copy of the security context with Privileged
+// expanded the way Kubernetes defines it: every capability added and none
+// dropped, a writable rootfs, and seccomp unconfined. The input is left
+// unmodified. Privileged containers are still subject to the
+// unsupported-feature policy; the expansion only determines what a
+// permitted privileged container runs with.
+func expandPrivileged(sc *kubeapi.LinuxContainerSecurityContext) *kubeapi.LinuxContainerSecurityContext {
+	if sc == nil || !sc.Privileged {
+		return sc
+	}
+	expanded := *sc
+	expanded.ReadonlyRootfs = false
+	expanded.SeccompProfilePath = securityProfileUnconfined
+	expanded.Capabilities = &kubeapi.Capability{
+		AddCapabilities: []string{"ALL"},
+	}
+	return &expanded
+}
+
+// applyDefaultSeccompProfile fills in the node's default seccomp profile
+// when the container config requests none, so operators can harden every
+// container without touching pod specs. An explicit unconfined request
+// opts out of the default.
+func applyDefaultSeccompProfile(config *kubeapi.ContainerConfig, defaultProfile string) {
+	if defaultProfile == "" {
+		return
+	}
+	if config.GetLinux().GetSecurityContext().GetSeccompProfilePath() != "" {
+		// An explicit profile, including unconfined, wins over the
+		// node default.
+		return
+	}
+	if config.Linux == nil {
+		config.Linux = &kubeapi.LinuxContainerConfig{}
+	}
+	if config.Linux.SecurityContext == nil {
+		config.Linux.SecurityContext = &kubeapi.LinuxContainerSecurityContext{}
+	}
+	config.Linux.SecurityContext.SeccompProfilePath = defaultProfile
+}
+
+// verifySecurityProfiles checks the apparmor and seccomp profiles requested
+// in the container security context. hyperd can not load custom profiles into
+// the VM, so only the default and unconfined profiles are accepted; anything
+// else is handled according to the unsupported-feature policy instead of
+// silently running unconfined.
+func verifySecurityProfiles(securityContext *kubeapi.LinuxContainerSecurityContext) error {
+	switch profile := securityContext.ApparmorProfile; profile {
+	case "", securityProfileRuntimeDefault, securityProfileUnconfined:
+		// The VM boundary provides the default confinement.
+	default:
+		if err := unsupportedFeature("apparmor profile %q is not supported in hyper", profile); err != nil {
+			return err
 		}
 	}
-	containerSpec.Envs = environments
 
-	return containerSpec, nil
+	switch profile := securityContext.SeccompProfilePath; profile {
+	case "", securityProfileRuntimeDefault, securityProfileDockerDefault, securityProfileUnconfined:
+		// The VM boundary provides the default confinement.
+	default:
+		if err := unsupportedFeature("seccomp profile %q is not supported in hyper", profile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hooks into the SELinux runtime state, replaceable in tests.
+var (
+	selinuxEnabled = selinux.GetEnabled
+	selinuxChcon   = selinux.Chcon
+)
+
+// relabelVolume applies the SELinux relabel requested for a mount to its
+// host path, so the volume content is readable under the container's label
+// when it is shared into the VM. The label comes from the container's
+// SELinux options; without them the kernel default applies and there is
+// nothing to do, whatever the host's SELinux state. Only when a relabel is
+// actually requested on a host without SELinux does the request go through
+// the unsupported-feature policy instead of being silently dropped.
+func relabelVolume(m *kubeapi.Mount, securityContext *kubeapi.LinuxContainerSecurityContext) error {
+	opts := securityContext.GetSelinuxOptions()
+	if opts == nil {
+		return nil
+	}
+	if !selinuxEnabled() {
+		return unsupportedFeature("SELinux relabeling of %q requested but SELinux is not enabled on this host", m.HostPath)
+	}
+
+	// A partially filled options struct would join into a malformed
+	// context like "u:r:t:"; the kernel rejects those with a cryptic
+	// error, so catch it here with the offending field spelled out.
+	fields := []string{opts.User, opts.Role, opts.Type, opts.Level}
+	for i, name := range []string{"user", "role", "type", "level"} {
+		if fields[i] == "" {
+			return fmt.Errorf("cannot relabel %q: SELinux option %q must not be empty", m.HostPath, name)
+		}
+	}
+	return selinuxChcon(m.HostPath, strings.Join(fields, ":"), true)
+}
+
+// tmpfsMagic is the tmpfs filesystem magic from statfs(2).
+const tmpfsMagic = 0x01021994
+
+// emptyDirHostPathMarker is the directory kubelet materializes emptyDir
+// volumes under within a pod's volumes dir.
+const emptyDirHostPathMarker = "kubernetes.io~empty-dir"
+
+// statfs is syscall.Statfs, replaceable in tests.
+var statfs = syscall.Statfs
+
+// getMemoryBackedVolume reports whether hostPath is a medium-Memory
+// emptyDir volume and its size in bytes. kubelet materializes such volumes
+// as tmpfs mounts sized to the emptyDir's sizeLimit, so this is how they
+// are recognized at the CRI level. Only emptyDir host paths qualify:
+// secret, projected and downward-API volumes are tmpfs mounts on the host
+// too, but carry content kubelet wrote there and must stay shared
+// directories instead of becoming a fresh tmpfs inside the VM.
+func getMemoryBackedVolume(hostPath string) (bool, int64) {
+	if !strings.Contains(hostPath, emptyDirHostPathMarker) {
+		return false, 0
+	}
+
+	var st syscall.Statfs_t
+	if err := statfs(hostPath, &st); err != nil {
+		return false, 0
+	}
+	if st.Type != tmpfsMagic {
+		return false, 0
+	}
+	return true, int64(st.Blocks) * st.Bsize
+}
+
+// makeTmpfsVolume maps a memory-backed emptyDir mount onto a tmpfs
+// UserVolume, so the volume lives in the VM's memory instead of being a
+// disk-backed shared directory. The size limit rides along as a mount
+// option in Fstype; hyperd versions without tmpfs volume support ignore it.
+func makeTmpfsVolume(volName string, m *kubeapi.Mount, sizeLimit int64) *types.UserVolumeReference {
+	fstype := "tmpfs"
+	if sizeLimit > 0 {
+		fstype = fmt.Sprintf("tmpfs,size=%d", sizeLimit)
+	}
+	volDetail := &types.UserVolume{
+		Name:   volName + fmt.Sprintf("_%08x", rand.Uint32()),
+		Source: "tmpfs",
+		Format: "tmpfs",
+		Fstype: fstype,
+	}
+	return &types.UserVolumeReference{
+		Volume:   volDetail.Name,
+		Path:     m.ContainerPath,
+		ReadOnly: m.Readonly,
+		Detail:   volDetail,
+	}
 }
 
 func makeContainerVolumes(config *kubeapi.ContainerConfig) ([]*types.UserVolumeReference, error) {
@@ -127,6 +505,20 @@ func makeContainerVolumes(config *kubeapi.ContainerConfig) ([]*types.UserVolumeR
 
 		_, volName := filepath.Split(hostPath)
 
+		// Honor SELinux relabel requests (e.g. the :Z mount option) before
+		// the volume is handed to hyperd.
+		if m.SelinuxRelabel {
+			if err := relabelVolume(m, config.GetLinux().GetSecurityContext()); err != nil {
+				return nil, err
+			}
+		}
+
+		// Memory-backed emptyDir volumes become tmpfs inside the VM.
+		if memoryBacked, sizeLimit := getMemoryBackedVolume(hostPath); memoryBacked {
+			volumes[i] = makeTmpfsVolume(volName, m, sizeLimit)
+			continue
+		}
+
 		// In frakti, we can both use normal container volumes (-v host:path), and also cinder-flexvolume
 		isCinderFlexvolume := false
 		volumeOptsFile := filepath.Join(hostPath, knownflags.FlexvolumeDataFile)
@@ -198,18 +590,57 @@ func makeContainerVolumes(config *kubeapi.ContainerConfig) ([]*types.UserVolumeR
 
 // StartContainer starts the container.
 func (h *Runtime) StartContainer(rawContainerID string) error {
-	err := h.client.StartContainer(rawContainerID)
+	containerID, err := h.resolveContainerID(rawContainerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	err = h.client.StartContainer(containerID)
 	if err != nil {
+		// Surface hyperd's own view of why the start failed, so kubelet
+		// events show the real reason instead of a bare RPC error.
+		err = withStartFailureCause(err, h.containerStartFailureCause(containerID))
 		glog.Errorf("Start container %q failed: %v", rawContainerID, err)
 		return err
 	}
 
+	h.bootTimes.observeStart(containerID)
 	return nil
 }
 
 // StopContainer stops a running container with a grace period (i.e. timeout).
+// Kubelet folds the pod-level termination grace period into timeout already;
+// a non-positive value is raised to the configured default so the container
+// still gets its stop signal (SIGTERM unless overridden at create time)
+// before hyperd escalates to SIGKILL.
 func (h *Runtime) StopContainer(rawContainerID string, timeout int64) error {
-	err := h.client.StopContainer(rawContainerID, timeout)
+	rawContainerID, err := h.resolveContainerID(rawContainerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	if timeout <= 0 {
+		timeout = h.stopContainerGracePeriod
+	}
+
+	// Kubelet runs exec-based PreStop hooks before asking for the stop,
+	// but a hook may still be in flight; give it the grace window before
+	// the stop kills its exec session. The drain shares the grace budget
+	// with hyperd's own SIGTERM wait, so the time spent here is deducted
+	// from the timeout handed to hyperd and a stop never takes more than
+	// one grace period in total.
+	drainStart := time.Now()
+	if !h.client.waitExecSessionsDrained(rawContainerID, time.Duration(timeout)*time.Second) {
+		glog.V(3).Infof("Active exec sessions in container %s did not finish within the %ds grace period", rawContainerID, timeout)
+	}
+	remaining := timeout - int64(time.Since(drainStart).Seconds())
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	err = h.client.StopContainer(rawContainerID, remaining)
 	if err != nil {
 		glog.Errorf("Stop container %s failed: %v", rawContainerID, err)
 		return err
@@ -221,15 +652,64 @@ func (h *Runtime) StopContainer(rawContainerID string, timeout int64) error {
 // RemoveContainer removes the container. If the container is running, the container
 // should be force removed.
 func (h *Runtime) RemoveContainer(rawContainerID string) error {
-	err := h.client.RemoveContainer(rawContainerID)
+	containerID, err := h.resolveContainerID(rawContainerID)
+	if err != nil {
+		if isContainerNotFoundError(err) {
+			// Removing an unknown container is already done.
+			h.containerLabels.Remove(rawContainerID)
+			return nil
+		}
+		glog.Errorf("Resolve container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	err = h.client.RemoveContainer(containerID)
 	if err != nil {
 		glog.Errorf("Remove container %q failed: %v", rawContainerID, err)
 		return err
 	}
 
+	h.forgetContainerRefs(containerID)
+	h.containerLabels.Remove(containerID)
+	h.bootTimes.forget(containerID)
+	h.specSnapshots.forget(containerID)
+	h.withheldAnnotations.forget(containerID)
+	h.reservations.forgetContainer(containerID)
 	return nil
 }
 
+// RecreateContainer replaces a container whose config changed: the old
+// container is stopped and removed, and a new one is created from config
+// in the same sandbox. Sibling containers and the sandbox VM itself are
+// left untouched, unlike the historical whole-pod restart. The new
+// container is created but not started, mirroring CreateContainer.
+func (h *Runtime) RecreateContainer(rawContainerID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
+	containerID, err := h.resolveContainerID(rawContainerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", rawContainerID, err)
+		return "", err
+	}
+
+	// The sandbox to recreate into is the one the old container runs in.
+	info, err := h.client.GetContainerInfo(containerID)
+	if err != nil {
+		glog.Errorf("Get container info for %s failed: %v", containerID, err)
+		return "", err
+	}
+	podSandboxID := info.PodID
+
+	if err := h.StopContainer(containerID, 0); err != nil {
+		glog.Errorf("Stop container %s for recreate failed: %v", containerID, err)
+		return "", err
+	}
+	if err := h.RemoveContainer(containerID); err != nil {
+		glog.Errorf("Remove container %s for recreate failed: %v", containerID, err)
+		return "", err
+	}
+
+	return h.CreateContainer(podSandboxID, config, sandboxConfig)
+}
+
 // ListContainers lists all containers by filters.
 func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Container, error) {
 	containerList, err := h.client.GetContainerList()
@@ -242,8 +722,7 @@ func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Co
 
 	for _, c := range containerList {
 		state := toKubeContainerState(c.Status)
-		_, _, _, containerName, attempt, err := parseContainerName(strings.Replace(c.ContainerName, "/", "", -1))
-
+		containerMetadata, err := toKubeContainerMetadata(c.ContainerName)
 		if err != nil {
 			glog.V(3).Infof("ParseContainerName for %q failed (%v), assuming it is not managed by frakti", c.ContainerName, err)
 			continue
@@ -261,6 +740,16 @@ func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Co
 			if filter.State != nil && state != filter.GetState().State {
 				continue
 			}
+
+			// Rule out non-matching containers through the label index
+			// before the per-container info round trip. Containers the
+			// index does not know about (e.g. created before a frakti
+			// restart) still go through the label scan below.
+			if filter.LabelSelector != nil {
+				if match, known := h.containerLabels.Matches(c.ContainerID, filter.LabelSelector); known && !match {
+					continue
+				}
+			}
 		}
 
 		info, err := h.client.GetContainerInfo(c.ContainerID)
@@ -270,6 +759,7 @@ func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Co
 		}
 
 		annotations := getAnnotationsFromLabels(info.Container.Labels)
+		annotations = h.withheldAnnotations.mergeInto(c.ContainerID, annotations)
 		kubeletLabels := getKubeletLabels(info.Container.Labels)
 
 		if filter != nil {
@@ -278,11 +768,6 @@ func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Co
 			}
 		}
 
-		containerMetadata := &kubeapi.ContainerMetadata{
-			Name:    containerName,
-			Attempt: attempt,
-		}
-
 		createdAtNano := info.CreatedAt * secondToNano
 		containers = append(containers, &kubeapi.Container{
 			Id:           c.ContainerID,
@@ -302,6 +787,12 @@ func (h *Runtime) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Co
 
 // ContainerStatus returns the container status.
 func (h *Runtime) ContainerStatus(containerID string) (*kubeapi.ContainerStatus, error) {
+	containerID, err := h.resolveContainerID(containerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", containerID, err)
+		return nil, err
+	}
+
 	status, err := h.client.GetContainerInfo(containerID)
 	if err != nil {
 		glog.Errorf("Get container info for %s failed: %v", containerID, err)
@@ -317,19 +808,15 @@ func (h *Runtime) ContainerStatus(containerID string) (*kubeapi.ContainerStatus,
 	logPath := status.Container.Labels[containerLogPathLabelKey]
 	state := toKubeContainerState(status.Status.Phase)
 	annotations := getAnnotationsFromLabels(status.Container.Labels)
+	annotations = h.withheldAnnotations.mergeInto(containerID, annotations)
 	kubeletLabels := getKubeletLabels(status.Container.Labels)
 
-	_, _, _, containerName, attempt, err := parseContainerName(strings.Replace(status.Container.Name, "/", "", -1))
+	containerMetadata, err := toKubeContainerMetadata(status.Container.Name)
 	if err != nil {
 		glog.Errorf("ParseContainerName for %s failed: %v", status.Container.Name, err)
 		return nil, err
 	}
 
-	containerMetadata := &kubeapi.ContainerMetadata{
-		Name:    containerName,
-		Attempt: attempt,
-	}
-
 	createdAtNano := status.CreatedAt * secondToNano
 	kubeStatus := &kubeapi.ContainerStatus{
 		Id:          status.Container.ContainerID,
@@ -380,15 +867,49 @@ func (h *Runtime) ContainerStatus(containerID string) (*kubeapi.ContainerStatus,
 
 		kubeStatus.StartedAt = startedAt
 		kubeStatus.FinishedAt = finishedAt
-		kubeStatus.Reason = status.Status.Terminated.Reason
+		kubeStatus.Reason = toKubeTerminatedReason(status.Status.Terminated)
 		kubeStatus.ExitCode = status.Status.Terminated.ExitCode
+		kubeStatus.Message = getTerminationMessage(status.Status.Terminated, logPath, annotations)
 	default:
-		kubeStatus.Reason = status.Status.Waiting.Reason
+		if status.Status.Waiting != nil && status.Status.Waiting.Reason != "" {
+			kubeStatus.Reason = status.Status.Waiting.Reason
+		} else {
+			kubeStatus.Reason = defaultWaitingReason
+		}
 	}
 
 	return kubeStatus, nil
 }
 
+// getTerminationMessage builds the terminated container's message following
+// the pod's termination message policy. The message file configured by
+// terminationMessagePath lives inside the VM and hyperd has no API to read
+// files back from a stopped container, so the file based policy only works
+// when hyperd itself reports the message; with FallbackToLogsOnError the
+// tail of the container log on the host is used for failed containers.
+func getTerminationMessage(terminated *types.TermStatus, logPath string, annotations map[string]string) string {
+	if terminated.Message != "" {
+		return terminated.Message
+	}
+
+	if annotations[terminationMessagePolicyKey] != terminationMessageFallbackPolicy {
+		return ""
+	}
+	if terminated.ExitCode == 0 || logPath == "" {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		glog.Errorf("Read log file %q for termination message failed: %v", logPath, err)
+		return ""
+	}
+	if len(data) > maxTerminationMessageLength {
+		data = data[len(data)-maxTerminationMessageLength:]
+	}
+	return string(data)
+}
+
 //  UpdateContainerResources updates the resource constraints for the container.
 func (h *Runtime) UpdateContainerResources(
 	rawContainerID string,
@@ -401,15 +922,3 @@ func (h *Runtime) UpdateContainerResources(
 	// Will talk with @connor to see if this can be fixed.
 	return nil
 }
-
-// ContainerStats returns stats of the container. If the container does not
-// exist, the call returns an error.
-func (h *Runtime) ContainerStats(containerID string) (*kubeapi.ContainerStats, error) {
-	return nil, fmt.Errorf("ContainerStats is not implemented for hyper runtime yet.")
-}
-
-// ListContainerStats returns stats of all running containers.
-func (h *Runtime) ListContainerStats(filter *kubeapi.ContainerStatsFilter) (
-	[]*kubeapi.ContainerStats, error) {
-	return nil, fmt.Errorf("ContainerStats is not implemented for hyper runtime yet.")
-}
@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// apiVersionContainerCheckpoint is the first hyperd API version expected to
+// expose container checkpoint/restore. No released hyperd implements it
+// yet, so the passthrough below mostly reports a clear "unsupported" error;
+// once hyperd gains the RPCs, only the client call here needs filling in.
+const apiVersionContainerCheckpoint = "0.3.0"
+
+// CheckpointContainer checkpoints a running container into the state dir so
+// it can be restored on next start. The capability is feature gated and
+// requires hyperd support; without either, a clear error is returned
+// instead of a silent no-op. CRI v1alpha1 has no corresponding RPC, so this
+// is only reachable through out-of-band tooling for now.
+func (h *Runtime) CheckpointContainer(rawContainerID string) error {
+	if !h.enableContainerCheckpoint {
+		return fmt.Errorf("container checkpoint is disabled, enable it with --enable-container-checkpoint")
+	}
+
+	checkpointPath := filepath.Join(h.containerCheckpointDir, rawContainerID)
+	if err := os.MkdirAll(checkpointPath, 0700); err != nil {
+		return err
+	}
+
+	if err := h.client.CheckpointContainer(rawContainerID, checkpointPath); err != nil {
+		glog.Errorf("Checkpoint container %s failed: %v", rawContainerID, err)
+		return err
+	}
+	return nil
+}
+
+// CheckpointContainer asks hyperd to checkpoint the container into
+// checkpointPath. hyperd's public API does not expose checkpoint/restore
+// below apiVersionContainerCheckpoint, in which case an unsupported error
+// is returned.
+func (c *Client) CheckpointContainer(containerID, checkpointPath string) error {
+	if c.apiVersionBefore("", apiVersionContainerCheckpoint) {
+		return fmt.Errorf("container checkpoint is not supported by hyperd API version %q", c.detectAPIVersion())
+	}
+
+	// The generated hyperd bindings do not carry the checkpoint RPC yet;
+	// report that clearly rather than pretending the call happened.
+	return fmt.Errorf("container checkpoint requires hyperd API %s or newer bindings, which this build does not include", apiVersionContainerCheckpoint)
+}
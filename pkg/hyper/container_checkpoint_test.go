@@ -0,0 +1,46 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointContainer(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.SetVersion("1.0.0", "0.1.0")
+
+	// Disabled by default.
+	err := r.CheckpointContainer("c*12345")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "disabled")
+
+	tmpDir, err := ioutil.TempDir("", "frakti-checkpoint-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Enabled, but the connected hyperd is too old to support it.
+	r.enableContainerCheckpoint = true
+	r.containerCheckpointDir = tmpDir
+	err = r.CheckpointContainer("c*12345")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not supported by hyperd API version")
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+// resolveContainerID maps a container reference — the hyperd container ID
+// that CRI normally passes, or a hyperd container name — to the container's
+// ID, so every container operation behaves the same regardless of which
+// form it got. Successful resolutions are cached; cached entries are
+// dropped when the container is removed.
+func (h *Runtime) resolveContainerID(ref string) (string, error) {
+	h.containerRefsLock.Lock()
+	id, ok := h.containerRefs[ref]
+	h.containerRefsLock.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	// The common case: hyperd resolves the reference directly.
+	info, err := h.client.GetContainerInfo(ref)
+	if err == nil {
+		h.cacheContainerRef(ref, info.Container.ContainerID)
+		return info.Container.ContainerID, nil
+	}
+	if !isContainerNotFoundError(err) {
+		return "", err
+	}
+
+	// Fall back to scanning the container list for a name match; not
+	// every hyperd version resolves names in ContainerInfo.
+	containers, listErr := h.client.GetContainerList()
+	if listErr != nil {
+		return "", listErr
+	}
+	for _, c := range containers {
+		if c.ContainerID == ref || c.ContainerName == ref {
+			h.cacheContainerRef(ref, c.ContainerID)
+			return c.ContainerID, nil
+		}
+	}
+	return "", err
+}
+
+// cacheContainerRef records that ref resolves to containerID.
+func (h *Runtime) cacheContainerRef(ref, containerID string) {
+	h.containerRefsLock.Lock()
+	defer h.containerRefsLock.Unlock()
+	if h.containerRefs == nil {
+		h.containerRefs = make(map[string]string)
+	}
+	h.containerRefs[ref] = containerID
+}
+
+// forgetContainerRefs drops every cached reference resolving to
+// containerID. Called when the container is removed, so a reused name does
+// not resolve to a dead container.
+func (h *Runtime) forgetContainerRefs(containerID string) {
+	h.containerRefsLock.Lock()
+	defer h.containerRefsLock.Unlock()
+	for ref, id := range h.containerRefs {
+		if id == containerID {
+			delete(h.containerRefs, ref)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveContainerID(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	containerName := fakeClient.containerInfoMap[containerID].Container.Name
+
+	// The ID resolves to itself.
+	id, err := r.resolveContainerID(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, id)
+
+	// The hyperd container name resolves to the same container.
+	id, err = r.resolveContainerID(containerName)
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, id)
+
+	// The second name lookup is served from the cache without listing
+	// containers again.
+	lists := 0
+	for _, call := range fakeClient.called {
+		if call == "ContainerList" {
+			lists++
+		}
+	}
+	_, err = r.resolveContainerID(containerName)
+	assert.NoError(t, err)
+	listsAfter := 0
+	for _, call := range fakeClient.called {
+		if call == "ContainerList" {
+			listsAfter++
+		}
+	}
+	assert.Equal(t, lists, listsAfter)
+
+	// Unknown references still fail.
+	_, err = r.resolveContainerID("no-such-container")
+	assert.Error(t, err)
+
+	// Container operations accept the name as well as the ID.
+	status, err := r.ContainerStatus(containerName)
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, status.Id)
+
+	// Removing the container drops the cached references.
+	err = r.RemoveContainer(containerID)
+	assert.NoError(t, err)
+	r.containerRefsLock.Lock()
+	assert.Len(t, r.containerRefs, 0)
+	r.containerRefsLock.Unlock()
+}
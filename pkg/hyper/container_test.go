@@ -18,9 +18,17 @@ package hyper
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/selinux/go-selinux"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"k8s.io/frakti/pkg/hyper/types"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
@@ -68,6 +76,7 @@ func TestCreateContainer(t *testing.T) {
 		configs = append(configs, c)
 	}
 
+	setFakeRunningPods(fakeClient, "sandboxid0", "sandboxid1", "sandboxid2")
 	createdAt := dockerTimestampToString(fakeClock.Now())
 	for i := range configs {
 		sandboxID := fmt.Sprintf("%s%d", sandbox, i)
@@ -113,6 +122,189 @@ func TestCreateContainer(t *testing.T) {
 
 }
 
+func TestCreateContainerWithOomScoreAdj(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		Resources: &kubeapi.LinuxContainerResources{
+			// Out of the valid kernel range, should be clamped to 1000.
+			OomScoreAdj: 1500,
+		},
+	}
+
+	setFakeRunningPods(fakeClient, "sandboxid")
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", fakeClient.containerInfoMap[containerID].Container.Labels[oomScoreAdjLabelKey])
+}
+
+func TestRecreateContainer(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// A two-container pod, as kubelet would build it.
+	appConfig := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	appID, err := r.CreateContainer("sandboxid", appConfig, sConfig)
+	assert.NoError(t, err)
+	sidecarConfig := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	sidecarID, err := r.CreateContainer("sandboxid", sidecarConfig, sConfig)
+	assert.NoError(t, err)
+
+	// Recreate the app container with a changed config (new attempt, new
+	// image), as kubelet does on a config hash change.
+	newConfig := makeContainerConfig(sConfig, "app", "app:v2", 1, map[string]string{}, map[string]string{}, nil)
+	newID, err := r.RecreateContainer(appID, newConfig, sConfig)
+	assert.NoError(t, err)
+	assert.NotEqual(t, appID, newID)
+
+	// The old container is gone, the new one and the untouched sibling
+	// are present.
+	assert.NotContains(t, fakeClient.containerInfoMap, appID)
+	assert.Contains(t, fakeClient.containerInfoMap, newID)
+	assert.Contains(t, fakeClient.containerInfoMap, sidecarID)
+	assert.Equal(t, "sandboxid", fakeClient.containerInfoMap[newID].PodID)
+
+	// The sandbox VM itself was never bounced.
+	assert.NotContains(t, fakeClient.called, "PodStop")
+	assert.NotContains(t, fakeClient.called, "PodStart")
+}
+
+func TestBuildUserContainerPrivilegedExpansion(t *testing.T) {
+	defer func() { unsupportedPolicy = UnsupportedPolicyFail }()
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "priv", "admin:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		SecurityContext: &kubeapi.LinuxContainerSecurityContext{
+			Privileged:         true,
+			ReadonlyRootfs:     true,
+			SeccompProfilePath: securityProfileRuntimeDefault,
+		},
+	}
+
+	// Under the fail policy privileged containers are still rejected.
+	_, err := buildUserContainer(config, sConfig)
+	assert.Error(t, err)
+
+	// Under the warn policy the container is created with privileged
+	// expanded: full capability set, writable rootfs, seccomp unconfined.
+	assert.NoError(t, SetUnsupportedPolicy(UnsupportedPolicyWarn))
+	spec, err := buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.False(t, spec.ReadOnly)
+	assert.Equal(t, securityProfileUnconfined, spec.Labels[seccompProfileLabelKey])
+	sc := config.Linux.SecurityContext
+	assert.Equal(t, []string{"ALL"}, sc.Capabilities.GetAddCapabilities())
+	assert.Empty(t, sc.Capabilities.GetDropCapabilities())
+}
+
+func TestCreateContainerDefaultSeccompProfile(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.defaultSeccompProfile = securityProfileRuntimeDefault
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// A container requesting no profile gets the node default.
+	config := makeContainerConfig(sConfig, "plain", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	labels := fakeClient.containerInfoMap[containerID].Container.Labels
+	assert.Equal(t, securityProfileRuntimeDefault, labels[seccompProfileLabelKey])
+
+	// An explicit unconfined request opts out of the default.
+	config = makeContainerConfig(sConfig, "optout", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		SecurityContext: &kubeapi.LinuxContainerSecurityContext{
+			SeccompProfilePath: securityProfileUnconfined,
+		},
+	}
+	containerID, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	labels = fakeClient.containerInfoMap[containerID].Container.Labels
+	assert.Equal(t, securityProfileUnconfined, labels[seccompProfileLabelKey])
+}
+
+func TestCreateContainerStdinFlags(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// Stdin and StdinOnce reach the container spec as labels, so the
+	// attach path can honor them.
+	config := makeContainerConfig(sConfig, "shell", "busybox:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Stdin = true
+	config.StdinOnce = true
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	labels := fakeClient.containerInfoMap[containerID].Container.Labels
+	assert.Equal(t, "true", labels[stdinLabelKey])
+	assert.Equal(t, "true", labels[stdinOnceLabelKey])
+
+	// A container without stdin records neither flag.
+	config = makeContainerConfig(sConfig, "batch", "busybox:v1", 1, map[string]string{}, map[string]string{}, nil)
+	containerID, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	labels = fakeClient.containerInfoMap[containerID].Container.Labels
+	assert.NotContains(t, labels, stdinLabelKey)
+	assert.NotContains(t, labels, stdinOnceLabelKey)
+
+	// Only the first attach of a StdinOnce container wins the stdin
+	// stream.
+	sr := &streamingRuntime{client: r.client}
+	assert.True(t, sr.stdinOnce.claim("c*1"))
+	assert.False(t, sr.stdinOnce.claim("c*1"))
+}
+
+func TestCreateContainerWithSecurityProfiles(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// Default and unconfined profiles are accepted.
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		SecurityContext: &kubeapi.LinuxContainerSecurityContext{
+			ApparmorProfile:    securityProfileRuntimeDefault,
+			SeccompProfilePath: securityProfileUnconfined,
+		},
+	}
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// Custom localhost profiles can not be loaded by hyperd and are rejected.
+	config = makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		SecurityContext: &kubeapi.LinuxContainerSecurityContext{
+			SeccompProfilePath: "localhost/audit.json",
+		},
+	}
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.Error(t, err)
+}
+
+func TestContainerExists(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	containers := []*FakeContainer{
+		{
+			ID:     "c*0",
+			Name:   "k8s_sidecar0_foo_bar_c*0_1",
+			Status: "running",
+			PodID:  "sandboxid",
+		},
+	}
+	fakeClient.SetFakeContainers(containers)
+
+	exists, err := r.client.ContainerExists("c*0")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = r.client.ContainerExists("no-such-container")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestListContainer(t *testing.T) {
 	r, fakeClient, _ := newTestRuntime()
 	podName, namespace := "foo", "bar"
@@ -142,6 +334,7 @@ func TestListContainer(t *testing.T) {
 		sConfigs = append(sConfigs, s)
 		configs = append(configs, c)
 	}
+	setFakeRunningPods(fakeClient, "sandboxid0", "sandboxid1", "sandboxid2")
 	containerIDs := []string{}
 	for i := range configs {
 		sandboxID := fmt.Sprintf("%s%d", sandbox, i)
@@ -226,6 +419,7 @@ func TestContainerStatus(t *testing.T) {
 		fmt.Sprintf("%s:v%d", image, 0), uint32(0), labels, annotations, mounts)
 
 	sandboxID := fmt.Sprintf("%s%d", sandbox, 0)
+	setFakeRunningPods(fakeClient, sandboxID)
 	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
 	assert.NoError(t, err)
 	//We don't know the Name until it's created
@@ -273,3 +467,393 @@ func TestContainerStatus(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, &expected, containerStatusReturn)
 }
+
+func TestCreateContainerVerifiesImagePresence(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.verifyImagePresence = true
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+
+	// The image has not been pulled: the create fails with a clear error
+	// before anything reaches hyperd.
+	_, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not present")
+	assert.NotContains(t, fakeClient.called, "ContainerCreate")
+
+	// Once the image is present the create goes through.
+	_, err = r.PullImage(&kubeapi.ImageSpec{Image: "logger:v1"}, nil)
+	assert.NoError(t, err)
+	_, err = r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	assert.Contains(t, fakeClient.called, "ContainerCreate")
+}
+
+func TestContainerStatusTerminatedReason(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	fakeClient.SetFakePod([]*FakePod{{PodID: sandboxID}})
+	err = r.StopContainer(containerID, 0)
+	assert.NoError(t, err)
+
+	// hyperd leaves the terminated reason empty, a clean exit should
+	// still be reported as "Completed".
+	fakeClient.containerInfoMap[containerID].Status.Phase = "succeeded"
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 0
+	status, err := r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, kubeapi.ContainerState_CONTAINER_EXITED, status.State)
+	assert.Equal(t, reasonCompleted, status.Reason)
+	assert.Equal(t, int32(0), status.ExitCode)
+
+	// A non-zero exit code without a reason is reported as "Error".
+	fakeClient.containerInfoMap[containerID].Status.Phase = "failed"
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 1
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, reasonError, status.Reason)
+	assert.Equal(t, int32(1), status.ExitCode)
+
+	// Exit code 137 without a reason means the kernel OOM killer fired.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 137
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, reasonOOMKilled, status.Reason)
+	assert.Equal(t, int32(137), status.ExitCode)
+
+	// However hyperd spells a memory kill, it is normalized to the
+	// reason kubelet understands.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 1
+	fakeClient.containerInfoMap[containerID].Status.Terminated.Reason = "oom killed"
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, reasonOOMKilled, status.Reason)
+
+	// Other explicit reasons from hyperd win over the derived one.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.Reason = "Evicted"
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Evicted", status.Reason)
+}
+
+func TestStopContainerGracePeriod(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.stopContainerGracePeriod = defaultStopContainerGracePeriod
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// An immediate stop request still gets the default grace period.
+	err = r.StopContainer(containerID, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultStopContainerGracePeriod, fakeClient.stopTimeout)
+
+	// A positive timeout from kubelet is passed through unchanged.
+	err = r.StartContainer(containerID)
+	assert.NoError(t, err)
+	err = r.StopContainer(containerID, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), fakeClient.stopTimeout)
+}
+
+func TestMakeContainerEnvs(t *testing.T) {
+	config := &kubeapi.ContainerConfig{
+		Metadata: &kubeapi.ContainerMetadata{Name: "sidecar"},
+		Envs: []*kubeapi.KeyValue{
+			{Key: "PATH", Value: "/bin"},
+			{Key: "HOME", Value: "/root"},
+			{Key: "PATH", Value: "/usr/bin:/bin"},
+		},
+	}
+
+	// Duplicate keys collapse into one entry with the last value winning.
+	envs, err := makeContainerEnvs(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.EnvironmentVar{
+		{Env: "PATH", Value: "/usr/bin:/bin"},
+		{Env: "HOME", Value: "/root"},
+	}, envs)
+
+	// Empty keys are rejected.
+	config.Envs = append(config.Envs, &kubeapi.KeyValue{Key: "", Value: "oops"})
+	_, err = makeContainerEnvs(config)
+	assert.Error(t, err)
+}
+
+func TestMakeContainerVolumesMemoryBackedEmptyDir(t *testing.T) {
+	// Pretend the mount's host path is a 64Mi tmpfs, as kubelet sets up
+	// for an emptyDir with medium Memory and a sizeLimit.
+	defer func() { statfs = syscall.Statfs }()
+	statfs = func(path string, st *syscall.Statfs_t) error {
+		st.Type = tmpfsMagic
+		st.Bsize = 4096
+		st.Blocks = 16384
+		return nil
+	}
+
+	config := &kubeapi.ContainerConfig{
+		Metadata: &kubeapi.ContainerMetadata{Name: "sidecar"},
+		Mounts: []*kubeapi.Mount{{
+			HostPath:      "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/cache",
+			ContainerPath: "/cache",
+		}},
+	}
+
+	volumes, err := makeContainerVolumes(config)
+	assert.NoError(t, err)
+	assert.Len(t, volumes, 1)
+	assert.Equal(t, "/cache", volumes[0].Path)
+	assert.Equal(t, "tmpfs", volumes[0].Detail.Format)
+	assert.Equal(t, "tmpfs", volumes[0].Detail.Source)
+	assert.Equal(t, "tmpfs,size=67108864", volumes[0].Detail.Fstype)
+
+	// A secret volume is also a tmpfs mount on the host, but carries
+	// content kubelet wrote there; it must stay a plain shared directory
+	// instead of becoming a fresh, empty tmpfs inside the VM.
+	tmpDir, err := ioutil.TempDir("", "frakti-volume-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	secretPath := filepath.Join(tmpDir, "volumes", "kubernetes.io~secret", "token")
+	assert.NoError(t, os.MkdirAll(secretPath, 0700))
+	config.Mounts[0].HostPath = secretPath
+
+	volumes, err = makeContainerVolumes(config)
+	assert.NoError(t, err)
+	assert.Len(t, volumes, 1)
+	assert.Equal(t, secretPath, volumes[0].Detail.Source)
+	assert.Equal(t, volDriver, volumes[0].Detail.Format)
+}
+
+func TestMakeContainerVolumesSelinuxRelabel(t *testing.T) {
+	defer func() {
+		selinuxEnabled = selinux.GetEnabled
+		selinuxChcon = selinux.Chcon
+		unsupportedPolicy = UnsupportedPolicyFail
+	}()
+	selinuxEnabled = func() bool { return true }
+	var relabeledPath, relabeledLabel string
+	selinuxChcon = func(fpath string, label string, recurse bool) error {
+		relabeledPath, relabeledLabel = fpath, label
+		assert.True(t, recurse)
+		return nil
+	}
+
+	hostPath, err := ioutil.TempDir("", "frakti-selinux-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(hostPath)
+
+	config := &kubeapi.ContainerConfig{
+		Metadata: &kubeapi.ContainerMetadata{Name: "sidecar"},
+		Mounts: []*kubeapi.Mount{{
+			HostPath:       hostPath,
+			ContainerPath:  "/shared",
+			SelinuxRelabel: true,
+		}},
+		Linux: &kubeapi.LinuxContainerConfig{
+			SecurityContext: &kubeapi.LinuxContainerSecurityContext{
+				SelinuxOptions: &kubeapi.SELinuxOption{
+					User:  "system_u",
+					Role:  "object_r",
+					Type:  "svirt_sandbox_file_t",
+					Level: "s0:c1,c2",
+				},
+			},
+		},
+	}
+
+	_, err = makeContainerVolumes(config)
+	assert.NoError(t, err)
+	assert.Equal(t, hostPath, relabeledPath)
+	assert.Equal(t, "system_u:object_r:svirt_sandbox_file_t:s0:c1,c2", relabeledLabel)
+
+	// A partially filled SELinux options struct would produce a malformed
+	// context; the create fails with the offending field named instead.
+	config.Linux.SecurityContext.SelinuxOptions.Level = ""
+	_, err = makeContainerVolumes(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "level")
+	config.Linux.SecurityContext.SelinuxOptions.Level = "s0:c1,c2"
+
+	// Without SELinux on the host a requested relabel follows the
+	// unsupported-feature policy.
+	selinuxEnabled = func() bool { return false }
+	_, err = makeContainerVolumes(config)
+	assert.Error(t, err)
+	assert.NoError(t, SetUnsupportedPolicy(UnsupportedPolicyWarn))
+	_, err = makeContainerVolumes(config)
+	assert.NoError(t, err)
+	assert.NoError(t, SetUnsupportedPolicy(UnsupportedPolicyFail))
+
+	// Without SELinux options there is nothing to relabel, so a flagged
+	// mount is not an unsupported feature even on a non-SELinux host.
+	config.Linux.SecurityContext.SelinuxOptions = nil
+	_, err = makeContainerVolumes(config)
+	assert.NoError(t, err)
+}
+
+func TestStopContainerWaitsForExecSessions(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// An in-flight exec session, e.g. kubelet's PreStop hook, holds the
+	// stop back until it finishes.
+	r.client.execSessions.add(containerID)
+	assert.False(t, r.client.waitExecSessionsDrained(containerID, 50*time.Millisecond))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := r.StopContainer(containerID, 30)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	assert.NotContains(t, fakeClient.called, "ContainerStop")
+
+	r.client.execSessions.remove(containerID)
+	<-done
+	assert.Contains(t, fakeClient.called, "ContainerStop")
+
+	// The drain shares the grace budget with hyperd's stop: a hook that
+	// never finishes eats the whole period and hyperd gets no further
+	// wait, so the stop cannot take two grace periods in total.
+	err = r.StartContainer(containerID)
+	assert.NoError(t, err)
+	r.client.execSessions.add(containerID)
+	defer r.client.execSessions.remove(containerID)
+	err = r.StopContainer(containerID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), fakeClient.stopTimeout)
+}
+
+func TestContainerStatusTerminationMessage(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	logDir, err := ioutil.TempDir("", "frakti-termination-message")
+	assert.NoError(t, err)
+	defer os.RemoveAll(logDir)
+	logContent := "panic: something went wrong\n"
+	err = ioutil.WriteFile(filepath.Join(logDir, "sidecar.log"), []byte(logContent), 0644)
+	assert.NoError(t, err)
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	sConfig.LogDirectory = logDir
+	annotations := map[string]string{terminationMessagePolicyKey: terminationMessageFallbackPolicy}
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, annotations, nil)
+	config.LogPath = "sidecar.log"
+
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	fakeClient.SetFakePod([]*FakePod{{PodID: sandboxID}})
+	err = r.StopContainer(containerID, 0)
+	assert.NoError(t, err)
+
+	// A failed container without a message from hyperd falls back to the
+	// log tail.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 1
+	status, err := r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, logContent, status.Message)
+
+	// A clean exit reports no message.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 0
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", status.Message)
+
+	// An explicit message from hyperd wins over the log tail.
+	fakeClient.containerInfoMap[containerID].Status.Terminated.ExitCode = 1
+	fakeClient.containerInfoMap[containerID].Status.Terminated.Message = "killed"
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "killed", status.Message)
+}
+
+func TestContainerStatusWaitingReason(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	fakeClient.SetFakePod([]*FakePod{{PodID: sandboxID}})
+
+	// A pending container without a populated Waiting status gets a
+	// sensible default reason instead of a blank one.
+	fakeClient.containerInfoMap[containerID].Status.Phase = "pending"
+	fakeClient.containerInfoMap[containerID].Status.Waiting = nil
+	status, err := r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, kubeapi.ContainerState_CONTAINER_CREATED, status.State)
+	assert.Equal(t, defaultWaitingReason, status.Reason)
+
+	// An explicit waiting reason from hyperd is kept as is.
+	fakeClient.containerInfoMap[containerID].Status.Waiting = &types.WaitingStatus{Reason: "PullingImage"}
+	status, err = r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "PullingImage", status.Reason)
+}
+
+func TestCreateContainerSandboxNotReady(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+
+	// A sandbox that is still starting is not a valid creation target.
+	fakeClient.SetFakePod([]*FakePod{{PodID: "sandboxid", Status: "pending"}})
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	if assert.Error(t, err) {
+		assert.Equal(t, codes.FailedPrecondition, grpc.Code(err))
+		assert.Contains(t, err.Error(), "not ready")
+	}
+	assert.NotContains(t, fakeClient.called, "ContainerCreate")
+}
+
+func TestCreateContainerCommandValidation(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// A whitespace-only command cannot be exec'ed.
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Command = []string{"   "}
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	if assert.Error(t, err) {
+		assert.Equal(t, codes.InvalidArgument, grpc.Code(err))
+		assert.Contains(t, err.Error(), "empty or whitespace command")
+	}
+	assert.NotContains(t, fakeClient.called, "ContainerCreate")
+
+	// Args that are all empty strings fall back to the image default.
+	config = makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Args = []string{""}
+	assert.NoError(t, normalizeContainerCommand(config))
+	assert.Empty(t, config.Args)
+
+	// An empty string among real args is a meaningful argument and stays.
+	config.Command = []string{"sh", "-c"}
+	config.Args = []string{"echo", ""}
+	assert.NoError(t, normalizeContainerCommand(config))
+	assert.Equal(t, []string{"echo", ""}, config.Args)
+
+	// No command at all uses the image default and passes through.
+	config = makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UpdateContainerLabels updates the labels of a container in hyperd in
+// place. hyperd's public API has no container-label RPC yet (it is still a
+// TODO upstream, unlike the pod-level SetPodLabels), so this reports
+// Unimplemented; the method exists so the capability lights up here once
+// the daemon grows the RPC, without touching any caller.
+func (c *Client) UpdateContainerLabels(containerID string, labels map[string]string) error {
+	return status.Errorf(codes.Unimplemented, "hyperd cannot update labels of container %s in place; recreate the container to change them", containerID)
+}
+
+// UpdateContainerMetadata updates a container's mutable metadata (labels
+// and annotations) in place, so metadata-only changes such as a new
+// pod-template-hash do not force a disruptive recreation. It fails with
+// Unimplemented while hyperd cannot persist the change, rather than
+// pretending the update happened.
+func (h *Runtime) UpdateContainerMetadata(containerID string, labels, annotations map[string]string) error {
+	containerID, err := h.resolveContainerID(containerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", containerID, err)
+		return err
+	}
+
+	if err := h.client.UpdateContainerLabels(containerID, buildLabelsWithAnnotations(labels, annotations)); err != nil {
+		glog.Errorf("Update labels of container %s failed: %v", containerID, err)
+		return err
+	}
+
+	// Keep the label index in step with hyperd, so label selector filters
+	// see the new metadata immediately.
+	h.containerLabels.Add(containerID, labels)
+	return nil
+}
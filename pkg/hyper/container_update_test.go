@@ -0,0 +1,51 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestUpdateContainerMetadataUnimplemented(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	podID := "p*0"
+	setFakeRunningPods(fakeClient, podID)
+
+	config := &kubeapi.ContainerConfig{
+		Metadata: &kubeapi.ContainerMetadata{Name: "c*1", Attempt: 1},
+		Image:    &kubeapi.ImageSpec{Image: "logger:v1"},
+		Labels:   map[string]string{"app": "web"},
+	}
+	containerID, err := r.CreateContainer(podID, config, makeSandboxConfig("foo", "bar", "1", 1))
+	assert.NoError(t, err)
+
+	// hyperd has no RPC to change container labels in place yet, so the
+	// update must fail loudly rather than report false success.
+	err = r.UpdateContainerMetadata(containerID, map[string]string{"app": "web2"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, codes.Unimplemented, grpc.Code(err))
+
+	// The label index must not drift from what hyperd actually stores.
+	match, known := r.containerLabels.Matches(containerID, map[string]string{"app": "web2"})
+	assert.True(t, known)
+	assert.False(t, match)
+}
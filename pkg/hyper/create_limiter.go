@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"golang.org/x/net/context"
+)
+
+// createLimiter bounds the number of concurrent heavyweight create
+// operations. During a node's initial sync kubelet can fire many
+// RunPodSandbox and CreateContainer calls at once, and each boots or
+// enters a VM; bounding them keeps the storm from overwhelming hyperd
+// while excess creates simply queue.
+//
+// A nil limiter is valid and admits everything immediately.
+type createLimiter struct {
+	// slots is a counting semaphore; a create holds one slot for the
+	// duration of its hyperd work.
+	slots chan struct{}
+}
+
+// newCreateLimiter creates a limiter admitting at most limit concurrent
+// creates. A non-positive limit disables the limiter.
+func newCreateLimiter(limit int32) *createLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &createLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire takes a slot, blocking while the limit is reached. It returns
+// the context error when ctx is done before a slot frees up, so a queued
+// create gives up together with its caller instead of piling on.
+func (l *createLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire.
+func (l *createLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
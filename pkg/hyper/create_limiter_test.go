@@ -0,0 +1,100 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func countContainerCreates(fakeClient *fakeClientInterface) int {
+	fakeClient.Lock()
+	defer fakeClient.Unlock()
+	creates := 0
+	for _, call := range fakeClient.called {
+		if call == "ContainerCreate" {
+			creates++
+		}
+	}
+	return creates
+}
+
+func TestCreateLimiterRespectsCancellation(t *testing.T) {
+	l := newCreateLimiter(1)
+	assert.NoError(t, l.acquire(context.Background()))
+
+	// With the only slot taken, a cancelled waiter gives up instead of
+	// queuing forever.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.acquire(ctx))
+
+	// Releasing the slot admits the next create.
+	l.release()
+	assert.NoError(t, l.acquire(context.Background()))
+	l.release()
+
+	// A nil limiter admits everything, even with a cancelled context.
+	var unlimited *createLimiter
+	assert.NoError(t, unlimited.acquire(ctx))
+	unlimited.release()
+}
+
+func TestCreateContainerQueuesWhenLimited(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.createLimiter = newCreateLimiter(1)
+	fakeClient.createHold = make(chan struct{})
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		config := makeContainerConfig(sConfig, fmt.Sprintf("sidecar%d", i), "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+		go func(config *kubeapi.ContainerConfig) {
+			_, err := r.CreateContainer(sandboxID, config, sConfig)
+			done <- err
+		}(config)
+	}
+
+	// Only one create reaches hyperd while the first one is held; the
+	// other queues at the limiter.
+	for i := 0; i < 100 && countContainerCreates(fakeClient) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, countContainerCreates(fakeClient))
+
+	// Finishing the slow create lets the queued one through.
+	close(fakeClient.createHold)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("create did not finish after the hold was released")
+		}
+	}
+	assert.Equal(t, 2, countContainerCreates(fakeClient))
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ContainerDebugInfo is the read-only view of one container used by the
+// debug endpoint.
+type ContainerDebugInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Attempt uint32 `json:"attempt"`
+}
+
+// SandboxDebugInfo is the read-only view of one sandbox and its containers
+// used by the debug endpoint.
+type SandboxDebugInfo struct {
+	ID         string                    `json:"id"`
+	Name       string                    `json:"name"`
+	Status     string                    `json:"status"`
+	Attempt    uint32                    `json:"attempt"`
+	NetNsPath  string                    `json:"netNsPath,omitempty"`
+	HostBridge string                    `json:"hostBridge,omitempty"`
+	Interfaces []*ContainerInterfaceInfo `json:"interfaces,omitempty"`
+	Containers []*ContainerDebugInfo     `json:"containers"`
+}
+
+// DebugInfo dumps frakti's internal view of which containers belong to which
+// VM/pod, together with the networking state recorded in the checkpoints.
+// It only issues read calls and is safe to run concurrently with CRI traffic.
+func (h *Runtime) DebugInfo() ([]*SandboxDebugInfo, error) {
+	pods, err := h.client.GetPodList()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := h.client.GetContainerList()
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxes := make(map[string]*SandboxDebugInfo, len(pods))
+	results := make([]*SandboxDebugInfo, 0, len(pods))
+	for _, pod := range pods {
+		info := &SandboxDebugInfo{
+			ID:         pod.PodID,
+			Name:       pod.PodName,
+			Status:     pod.Status,
+			Containers: []*ContainerDebugInfo{},
+		}
+		if _, _, _, attempt, err := parseSandboxName(pod.PodName); err == nil {
+			info.Attempt = attempt
+		}
+
+		if checkpoint, err := h.checkpointHandler.GetCheckpoint(pod.PodID); err == nil {
+			info.NetNsPath = checkpoint.NetNsPath
+			info.HostBridge = checkpoint.HostBridge
+			info.Interfaces = checkpoint.Data.Interfaces
+		}
+
+		sandboxes[pod.PodID] = info
+		results = append(results, info)
+	}
+
+	for _, c := range containers {
+		sandbox, ok := sandboxes[c.PodID]
+		if !ok {
+			continue
+		}
+
+		containerInfo := &ContainerDebugInfo{
+			ID:     c.ContainerID,
+			Name:   c.ContainerName,
+			Status: c.Status,
+		}
+		if _, _, _, _, attempt, err := parseContainerName(strings.Replace(c.ContainerName, "/", "", -1)); err == nil {
+			containerInfo.Attempt = attempt
+		}
+		sandbox.Containers = append(sandbox.Containers, containerInfo)
+	}
+
+	return results, nil
+}
+
+// ServeDebug serves the debug endpoint at addr, e.g. 127.0.0.1:22523. All
+// handlers are read-only except the force-remove escape hatch, which
+// demands an explicit confirmation.
+func (h *Runtime) ServeDebug(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/sandboxes", func(w http.ResponseWriter, req *http.Request) {
+		info, err := h.DebugInfo()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			glog.Errorf("Write debug info failed: %v", err)
+		}
+	})
+
+	// Combined view of a sandbox's container logs, interleaved by
+	// timestamp, so a multi-container pod can be debugged without chasing
+	// each log file individually. Read-only.
+	mux.HandleFunc("/debug/sandboxes/logs", func(w http.ResponseWriter, req *http.Request) {
+		podSandboxID := req.FormValue("id")
+		if podSandboxID == "" {
+			http.Error(w, "missing sandbox id", http.StatusBadRequest)
+			return
+		}
+		tail := 0
+		if value := req.FormValue("tail"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "tail must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			tail = parsed
+		}
+
+		lines, err := h.MergedSandboxLogs(podSandboxID, tail)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				glog.Errorf("Write merged sandbox logs failed: %v", err)
+				return
+			}
+		}
+	})
+
+	// Redacted JSON of the spec frakti last sent to hyperd for a sandbox
+	// or container, so the CRI-to-hyperd translation can be inspected
+	// without polluting the status kubelet consumes. Read-only.
+	mux.HandleFunc("/debug/sandboxes/spec", func(w http.ResponseWriter, req *http.Request) {
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(w, "missing sandbox or container id", http.StatusBadRequest)
+			return
+		}
+
+		snapshot := h.specSnapshots.get(id)
+		if snapshot == "" {
+			http.Error(w, fmt.Sprintf("no spec snapshot recorded for %s; it may predate the current frakti process", id), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := fmt.Fprintln(w, snapshot); err != nil {
+			glog.Errorf("Write spec snapshot failed: %v", err)
+		}
+	})
+
+	// Operator escape hatch for a sandbox whose graceful teardown is
+	// stuck. This kills the VM and purges all of the sandbox's state, so
+	// it requires POST and an explicit confirm=force parameter; anything
+	// else is rejected with an explanation.
+	mux.HandleFunc("/debug/sandboxes/force-remove", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "force-remove must be requested with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		podSandboxID := req.FormValue("id")
+		if podSandboxID == "" {
+			http.Error(w, "missing sandbox id", http.StatusBadRequest)
+			return
+		}
+		if req.FormValue("confirm") != "force" {
+			http.Error(w, "force-removing a sandbox kills its VM and purges its state without any graceful shutdown; repeat the request with confirm=force if that is really what you want", http.StatusBadRequest)
+			return
+		}
+
+		failures := h.ForceRemoveSandbox(podSandboxID)
+		result := struct {
+			ID       string   `json:"id"`
+			Failures []string `json:"failures"`
+		}{ID: podSandboxID, Failures: []string{}}
+		for _, failure := range failures {
+			result.Failures = append(result.Failures, failure.Error())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			glog.Errorf("Write force-remove result failed: %v", err)
+		}
+	})
+
+	// Trigger for live-migrating a sandbox's VM to another hyperd
+	// instance during a maintenance drain. Gated behind
+	// --enable-live-migration and requires POST; while hyperd lacks the
+	// migration RPC this reports a clear unsupported error.
+	mux.HandleFunc("/debug/sandboxes/migrate", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "migrate must be requested with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		podSandboxID := req.FormValue("id")
+		if podSandboxID == "" {
+			http.Error(w, "missing sandbox id", http.StatusBadRequest)
+			return
+		}
+		targetEndpoint := req.FormValue("target")
+		if targetEndpoint == "" {
+			http.Error(w, "missing target hyperd endpoint", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.MigratePodSandbox(podSandboxID, targetEndpoint); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "sandbox %s migrated to %s\n", podSandboxID, targetEndpoint)
+	})
+
+	// Prometheus metrics, including the per-method hyperd call metrics
+	// recorded by the client interceptor.
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return http.ListenAndServe(addr, mux)
+}
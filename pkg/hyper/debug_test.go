@@ -0,0 +1,63 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugInfo(t *testing.T) {
+	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	pods := []*FakePod{
+		{
+			PodID:   podID,
+			PodName: "k8s_POD.1_foo_bar_p*0_1",
+			Status:  "running",
+		},
+	}
+	fakeClient.SetFakePod(pods)
+
+	containers := []*FakeContainer{
+		{
+			ID:     "c*0",
+			Name:   "k8s_sidecar.2_foo_bar_p*0_1",
+			Status: "running",
+			PodID:  podID,
+		},
+	}
+	fakeClient.SetFakeContainers(containers)
+
+	checkpoint := NewPodSandboxCheckpoint("bar", "foo")
+	checkpoint.NetNsPath = "/var/run/netns/test"
+	checkpoint.HostBridge = "br0"
+	err := checkpointHandler.CreateCheckpoint(podID, checkpoint)
+	assert.NoError(t, err)
+
+	info, err := r.DebugInfo()
+	assert.NoError(t, err)
+	assert.Len(t, info, 1)
+	assert.Equal(t, podID, info[0].ID)
+	assert.Equal(t, uint32(1), info[0].Attempt)
+	assert.Equal(t, "/var/run/netns/test", info[0].NetNsPath)
+	assert.Equal(t, "br0", info[0].HostBridge)
+	assert.Len(t, info[0].Containers, 1)
+	assert.Equal(t, "c*0", info[0].Containers[0].ID)
+	assert.Equal(t, uint32(2), info[0].Containers[0].Attempt)
+}
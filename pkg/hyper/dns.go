@@ -0,0 +1,97 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// dnsPolicyAnnotationKey conveys the pod's effective DNS policy, so
+	// the VM's resolver config can follow it instead of blindly copying
+	// whatever servers the sandbox config carries.
+	dnsPolicyAnnotationKey = "runtime.frakti.alpha.kubernetes.io/DNSPolicy"
+
+	// dnsPolicyClusterFirst resolves through the cluster DNS;
+	// dnsPolicyDefault inherits the node's own resolver configuration.
+	dnsPolicyClusterFirst = "ClusterFirst"
+	dnsPolicyDefault      = "Default"
+)
+
+// nodeResolvConf is the node resolver configuration consulted for the
+// Default DNS policy. Overridable for testing.
+var nodeResolvConf = "/etc/resolv.conf"
+
+// applyDNSPolicy adjusts the pod's resolver configuration per the DNS
+// policy annotation. Pods without the annotation keep the sandbox config's
+// servers as-is.
+func (h *Runtime) applyDNSPolicy(spec *types.UserPod, config *kubeapi.PodSandboxConfig) error {
+	policy, ok := config.GetAnnotations()[dnsPolicyAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	switch policy {
+	case dnsPolicyClusterFirst:
+		// The cluster DNS servers from the sandbox config take
+		// precedence; fall back to the node-level default servers.
+		if len(spec.Dns) == 0 {
+			spec.Dns = h.defaultDNS
+		}
+		if len(spec.Dns) == 0 {
+			return fmt.Errorf("DNS policy %q requires cluster DNS servers in the sandbox dnsConfig or --default-dns", policy)
+		}
+	case dnsPolicyDefault:
+		servers, searches, err := parseResolvConf(nodeResolvConf)
+		if err != nil {
+			return fmt.Errorf("DNS policy %q: read node resolver config: %v", policy, err)
+		}
+		spec.Dns = servers
+		spec.DnsSearch = searches
+	default:
+		return fmt.Errorf("unknown DNS policy %q", policy)
+	}
+	return nil
+}
+
+// parseResolvConf extracts the nameservers and search domains from a
+// resolv.conf style file.
+func parseResolvConf(path string) (servers, searches []string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			servers = append(servers, fields[1])
+		case "search":
+			searches = append(searches, fields[1:]...)
+		}
+	}
+	return servers, searches, nil
+}
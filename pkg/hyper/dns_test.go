@@ -0,0 +1,75 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildUserPodDNSPolicy(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	r.defaultDNS = []string{"10.0.0.10"}
+
+	resolvConf, err := ioutil.TempFile("", "resolv.conf")
+	assert.NoError(t, err)
+	defer os.Remove(resolvConf.Name())
+	_, err = resolvConf.WriteString("# node resolver\nnameserver 192.168.1.1\nsearch corp.example.com example.com\n")
+	assert.NoError(t, err)
+	resolvConf.Close()
+	defer func(old string) { nodeResolvConf = old }(nodeResolvConf)
+	nodeResolvConf = resolvConf.Name()
+
+	// ClusterFirst keeps the sandbox config's cluster DNS servers.
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{dnsPolicyAnnotationKey: dnsPolicyClusterFirst},
+	)
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.10"}, spec.Dns)
+
+	// Default inherits the node's own resolver configuration instead.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{dnsPolicyAnnotationKey: dnsPolicyDefault},
+	)
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.1"}, spec.Dns)
+	assert.Equal(t, []string{"corp.example.com", "example.com"}, spec.DnsSearch)
+
+	// An unknown policy is rejected instead of silently ignored.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{dnsPolicyAnnotationKey: "ClusterFirstWithHostNet"},
+	)
+	_, err = r.buildUserPod(config)
+	assert.Error(t, err)
+
+	// ClusterFirst without any cluster DNS configured cannot be honored.
+	r.defaultDNS = nil
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{dnsPolicyAnnotationKey: dnsPolicyClusterFirst},
+	)
+	_, err = r.buildUserPod(config)
+	assert.Error(t, err)
+}
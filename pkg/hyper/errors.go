@@ -0,0 +1,160 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Sentinel errors returned by Client methods when hyperd reports the
+// resource is missing. Client wraps the raw hyperd error with one of
+// these, so callers can distinguish a genuine not-found from other
+// failures with the Is* helpers below instead of sniffing messages.
+var (
+	// ErrPodNotFound means hyperd does not know the requested pod.
+	ErrPodNotFound = errors.New("pod not found")
+	// ErrContainerNotFound means hyperd does not know the requested
+	// container.
+	ErrContainerNotFound = errors.New("container not found")
+	// ErrImageNotFound means hyperd does not have the requested image.
+	ErrImageNotFound = errors.New("image not found")
+)
+
+// notFoundError couples a not-found sentinel with the raw hyperd error
+// that triggered it, so the sentinel stays matchable while the original
+// message is kept for logs.
+type notFoundError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("%v: %v", e.sentinel, e.cause)
+}
+
+// wrapNotFound attaches a not-found sentinel to a raw hyperd error.
+func wrapNotFound(sentinel, cause error) error {
+	if cause == nil {
+		return sentinel
+	}
+	return &notFoundError{sentinel: sentinel, cause: cause}
+}
+
+// isSentinel reports whether err is, or wraps, the given sentinel.
+func isSentinel(err, sentinel error) bool {
+	if err == sentinel {
+		return true
+	}
+	if wrapped, ok := err.(*notFoundError); ok {
+		return wrapped.sentinel == sentinel
+	}
+	return false
+}
+
+// IsPodNotFound reports whether err means the pod is unknown to hyperd.
+func IsPodNotFound(err error) bool { return isSentinel(err, ErrPodNotFound) }
+
+// IsContainerNotFound reports whether err means the container is unknown
+// to hyperd.
+func IsContainerNotFound(err error) bool { return isSentinel(err, ErrContainerNotFound) }
+
+// IsImageNotFound reports whether err means the image is unknown to hyperd.
+func IsImageNotFound(err error) bool { return isSentinel(err, ErrImageNotFound) }
+
+// errorCategory classifies failures returned by hyperd so callers can
+// decide retry vs fail policies without sniffing message strings all over
+// the code. hyperd mostly returns code Unknown with a free-form message, so
+// the classifier inspects both the gRPC code and known message shapes.
+type errorCategory int
+
+const (
+	// errorTransient covers failures worth retrying: hyperd unreachable,
+	// timeouts, or temporary resource pressure.
+	errorTransient errorCategory = iota
+	// errorNotFound covers operations on pods or containers hyperd does
+	// not know, which are usually fine to treat as already-done for
+	// deletes and stops.
+	errorNotFound
+	// errorInvalid covers requests hyperd rejected as malformed or
+	// conflicting; retrying the same request will not help.
+	errorInvalid
+	// errorFatal covers everything else; the failure is real and should
+	// surface to the caller as-is.
+	errorFatal
+)
+
+// classifyHyperdError maps an error from hyperd's gRPC API onto an
+// errorCategory.
+func classifyHyperdError(err error) errorCategory {
+	if err == nil {
+		return errorFatal
+	}
+
+	switch grpc.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return errorTransient
+	case codes.NotFound:
+		return errorNotFound
+	case codes.InvalidArgument, codes.AlreadyExists, codes.FailedPrecondition:
+		return errorInvalid
+	}
+
+	// hyperd predates rich status codes and reports most failures as
+	// Unknown; fall back to the known message shapes.
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found") ||
+		strings.Contains(msg, "cannot find") ||
+		strings.Contains(msg, "can not find") ||
+		strings.Contains(msg, "can not get pod info") ||
+		strings.Contains(msg, "doesn't existed"):
+		return errorNotFound
+	case strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "transport is closing") ||
+		strings.Contains(msg, "deadline exceeded"):
+		return errorTransient
+	case strings.Contains(msg, "invalid") ||
+		strings.Contains(msg, "already in use") ||
+		strings.Contains(msg, "already exist"):
+		return errorInvalid
+	}
+	return errorFatal
+}
+
+// isTransientError reports whether the hyperd failure is worth retrying.
+func isTransientError(err error) bool {
+	return err != nil && classifyHyperdError(err) == errorTransient
+}
+
+// toGRPCCode maps an errorCategory onto the gRPC code reported to kubelet.
+func (c errorCategory) toGRPCCode() codes.Code {
+	switch c {
+	case errorTransient:
+		return codes.Unavailable
+	case errorNotFound:
+		return codes.NotFound
+	case errorInvalid:
+		return codes.InvalidArgument
+	default:
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestClassifyHyperdError(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		expected errorCategory
+	}{
+		// Real status codes take precedence.
+		{grpc.Errorf(codes.Unavailable, "hyperd is restarting"), errorTransient},
+		{grpc.Errorf(codes.DeadlineExceeded, "context deadline exceeded"), errorTransient},
+		{grpc.Errorf(codes.NotFound, "no such container"), errorNotFound},
+		{grpc.Errorf(codes.InvalidArgument, "bad spec"), errorInvalid},
+		// hyperd mostly reports code Unknown with a free-form message.
+		{fmt.Errorf("cannot find container c*1"), errorNotFound},
+		{fmt.Errorf("container doesn't existed"), errorNotFound},
+		{fmt.Errorf("Can not get Pod info with pod ID(p*0)"), errorNotFound},
+		{fmt.Errorf("dial tcp 127.0.0.1:22318: connection refused"), errorTransient},
+		{fmt.Errorf("pod name k8s_POD_foo_bar_1_1 is already in use"), errorInvalid},
+		{fmt.Errorf("qemu exited unexpectedly"), errorFatal},
+	} {
+		assert.Equal(t, test.expected, classifyHyperdError(test.err), "error: %v", test.err)
+	}
+
+	assert.False(t, isTransientError(nil))
+	assert.True(t, isTransientError(fmt.Errorf("transport is closing")))
+}
+
+func TestNotFoundSentinels(t *testing.T) {
+	// A wrapped sentinel keeps its identity and the original message.
+	cause := fmt.Errorf("Can not get Pod info with pod ID(p*0)")
+	err := wrapNotFound(ErrPodNotFound, cause)
+	assert.True(t, IsPodNotFound(err))
+	assert.False(t, IsContainerNotFound(err))
+	assert.Contains(t, err.Error(), "pod not found")
+	assert.Contains(t, err.Error(), cause.Error())
+
+	// The bare sentinels match themselves.
+	assert.True(t, IsPodNotFound(ErrPodNotFound))
+	assert.True(t, IsContainerNotFound(wrapNotFound(ErrContainerNotFound, fmt.Errorf("container doesn't existed"))))
+	assert.True(t, IsImageNotFound(wrapNotFound(ErrImageNotFound, nil)))
+
+	// Unrelated errors match nothing.
+	assert.False(t, IsPodNotFound(nil))
+	assert.False(t, IsImageNotFound(fmt.Errorf("image %q not found", "busybox")))
+
+	// The wrapped form still classifies as not-found, so the existing
+	// string-based helpers keep working on it.
+	assert.True(t, isContainerNotFoundError(wrapNotFound(ErrContainerNotFound, cause)))
+}
+
+func TestClientReturnsNotFoundSentinels(t *testing.T) {
+	r, _, _ := newTestRuntime()
+
+	_, err := r.client.GetPodInfo("no-such-pod")
+	assert.True(t, IsPodNotFound(err), "got: %v", err)
+
+	_, err = r.client.GetContainerInfo("no-such-container")
+	assert.True(t, IsContainerNotFound(err), "got: %v", err)
+
+	_, err = r.client.GetImageInfo("no-such-image", "latest")
+	assert.True(t, IsImageNotFound(err), "got: %v", err)
+}
+
+func TestErrorCategoryToGRPCCode(t *testing.T) {
+	assert.Equal(t, codes.Unavailable, errorTransient.toGRPCCode())
+	assert.Equal(t, codes.NotFound, errorNotFound.toGRPCCode())
+	assert.Equal(t, codes.InvalidArgument, errorInvalid.toGRPCCode())
+	assert.Equal(t, codes.Unknown, errorFatal.toGRPCCode())
+}
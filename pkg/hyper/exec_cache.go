@@ -0,0 +1,108 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// execResult is a cached outcome of one ExecSync invocation.
+type execResult struct {
+	stdout []byte
+	stderr []byte
+	err    error
+
+	// generation identifies the container incarnation the result was
+	// produced against; a restarted container invalidates the entry.
+	generation string
+	expiresAt  time.Time
+}
+
+// execResultCache caches ExecSync results for a short TTL, keyed by
+// container and command. Kubelet runs exec probes at a high frequency and
+// each exec is expensive with a VM-based runtime, so identical probes
+// within the TTL reuse the previous result. The tradeoff is that a probe
+// may report a result up to the TTL stale, which is why the TTL should be
+// kept well below the probe period and the cache defaults to disabled.
+//
+// A nil cache is valid and caches nothing.
+type execResultCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	results map[string]*execResult
+
+	// now is overridable for testing.
+	now func() time.Time
+}
+
+// newExecResultCache creates an ExecSync result cache with the given TTL.
+// A non-positive TTL disables caching.
+func newExecResultCache(ttl time.Duration) *execResultCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &execResultCache{
+		ttl:     ttl,
+		results: make(map[string]*execResult),
+		now:     time.Now,
+	}
+}
+
+// key builds the cache key for a command in a container. Command words are
+// joined with NUL so distinct argument vectors cannot collide.
+func (c *execResultCache) key(containerID string, cmd []string) string {
+	return containerID + "\x00" + strings.Join(cmd, "\x00")
+}
+
+// Get returns the cached result of cmd in the given container incarnation,
+// if there is one and it has not expired.
+func (c *execResultCache) Get(containerID string, cmd []string, generation string) (*execResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	result, ok := c.results[c.key(containerID, cmd)]
+	if !ok {
+		return nil, false
+	}
+	if result.generation != generation || c.now().After(result.expiresAt) {
+		delete(c.results, c.key(containerID, cmd))
+		return nil, false
+	}
+	return result, true
+}
+
+// Put stores the result of cmd for the given container incarnation.
+func (c *execResultCache) Put(containerID string, cmd []string, generation string, stdout, stderr []byte, err error) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.results[c.key(containerID, cmd)] = &execResult{
+		stdout:     stdout,
+		stderr:     stderr,
+		err:        err,
+		generation: generation,
+		expiresAt:  c.now().Add(c.ttl),
+	}
+}
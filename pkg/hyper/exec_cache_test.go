@@ -0,0 +1,99 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	utilexec "k8s.io/utils/exec"
+)
+
+func TestExecResultCache(t *testing.T) {
+	now := time.Now()
+	cache := newExecResultCache(time.Second)
+	cache.now = func() time.Time { return now }
+	cmd := []string{"cat", "/tmp/healthy"}
+
+	cache.Put("c1", cmd, "gen1", []byte("out"), []byte("err"), nil)
+	result, ok := cache.Get("c1", cmd, "gen1")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("out"), result.stdout)
+	assert.Equal(t, []byte("err"), result.stderr)
+
+	// A different command or container misses.
+	_, ok = cache.Get("c1", []string{"cat", "/tmp/other"}, "gen1")
+	assert.False(t, ok)
+	_, ok = cache.Get("c2", cmd, "gen1")
+	assert.False(t, ok)
+
+	// A restarted container invalidates its entries.
+	_, ok = cache.Get("c1", cmd, "gen2")
+	assert.False(t, ok)
+
+	// Entries expire after the TTL.
+	cache.Put("c1", cmd, "gen1", []byte("out"), nil, nil)
+	now = now.Add(2 * time.Second)
+	_, ok = cache.Get("c1", cmd, "gen1")
+	assert.False(t, ok)
+
+	// A zero TTL disables caching, and the resulting nil cache is safe.
+	disabled := newExecResultCache(0)
+	assert.Nil(t, disabled)
+	disabled.Put("c1", cmd, "gen1", nil, nil, nil)
+	_, ok = disabled.Get("c1", cmd, "gen1")
+	assert.False(t, ok)
+}
+
+func TestExecSyncCaching(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.execCache = newExecResultCache(time.Minute)
+	containers := []*FakeContainer{
+		{
+			ID:     "c*0",
+			Name:   "sidecar0",
+			Status: "running",
+			PodID:  "p*0",
+		},
+	}
+	fakeClient.SetFakeContainers(containers)
+	// A multiplexed stdout frame carrying "ok\n".
+	fakeClient.execStdout = append([]byte{1, 0, 0, 0, 0, 0, 0, 3}, []byte("ok\n")...)
+
+	// ExecInContainer reports the command's completion as a CodeExitError
+	// even for exit code zero.
+	stdout, _, err := r.ExecSync("c*0", []string{"ls"}, 0)
+	exitErr, ok := err.(utilexec.CodeExitError)
+	assert.True(t, ok)
+	assert.Equal(t, 0, exitErr.Code)
+	assert.Equal(t, []byte("ok\n"), stdout)
+	assert.Contains(t, fakeClient.called, "ExecCreate")
+
+	// An identical probe within the TTL is served from the cache without
+	// entering the VM again.
+	fakeClient.CleanCalls()
+	stdout, _, err = r.ExecSync("c*0", []string{"ls"}, 0)
+	assert.Equal(t, exitErr, err)
+	assert.Equal(t, []byte("ok\n"), stdout)
+	assert.NotContains(t, fakeClient.called, "ExecCreate")
+
+	// A different command is not served from the cache.
+	_, _, err = r.ExecSync("c*0", []string{"ls", "-l"}, 0)
+	assert.IsType(t, utilexec.CodeExitError{}, err)
+	assert.Contains(t, fakeClient.called, "ExecCreate")
+}
@@ -41,6 +41,30 @@ type fakeClientInterface struct {
 	version          string
 	apiVersion       string
 	execCmd          map[string]*[]string
+	stopTimeout      int64
+	execStdout       []byte
+	// removeContainerErrors makes ContainerRemove fail for specific
+	// container IDs, simulating wedged containers.
+	removeContainerErrors map[string]error
+	// startContainerErrors makes ContainerStart fail for specific
+	// container IDs, simulating containers that do not come up.
+	startContainerErrors map[string]error
+	// pullData is streamed as progress frames by ImagePull before EOF.
+	pullData [][]byte
+	// When pullHold is set, ImagePull streams block after the data
+	// frames until the channel is closed or the pull is cancelled.
+	pullHold chan struct{}
+	// When createHold is set, ContainerCreate blocks until the channel
+	// is closed, simulating a slow create so tests can observe queuing.
+	createHold chan struct{}
+	// When startHold is set, PodStart blocks until the channel is closed
+	// or the caller's deadline expires, simulating a slow VM boot.
+	startHold chan struct{}
+	// podStatsMap provides the PodStats response per pod ID.
+	podStatsMap map[string]*types.PodStats
+	// daemonInfo is returned by Info when set; unset keeps the RPC
+	// unimplemented.
+	daemonInfo *types.InfoResponse
 }
 
 func newFakeClientInterface(c clock.Clock) *fakeClientInterface {
@@ -49,6 +73,7 @@ func newFakeClientInterface(c clock.Clock) *fakeClientInterface {
 		containerInfoMap: make(map[string]*types.ContainerInfo),
 		podInfoMap:       make(map[string]*types.PodInfo),
 		execCmd:          make(map[string]*[]string),
+		podStatsMap:      make(map[string]*types.PodStats),
 	}
 }
 
@@ -71,6 +96,7 @@ func (f *fakeClientInterface) SetFakePod(pods []*FakePod) {
 			Phase: p.Status,
 		}
 		podInfo := types.PodInfo{
+			PodID:   p.PodID,
 			Spec:    &podSpec,
 			Status:  &podStatus,
 			PodName: p.PodName,
@@ -140,7 +166,22 @@ func (f *fakeClientInterface) PodList(ctx context.Context, in *types.PodListRequ
 }
 
 func (f *fakeClientInterface) PodCreate(ctx context.Context, in *types.PodCreateRequest, opts ...grpc.CallOption) (*types.PodCreateResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	defer f.Unlock()
+	f.called = append(f.called, "PodCreate")
+	for _, p := range f.podInfoMap {
+		if p.PodName == in.PodSpec.Id {
+			return nil, fmt.Errorf("pod name %s is already in use", in.PodSpec.Id)
+		}
+	}
+	podID := in.PodSpec.Id
+	f.podInfoMap[podID] = &types.PodInfo{
+		PodID:   podID,
+		PodName: in.PodSpec.Id,
+		Status:  &types.PodStatus{Phase: "Pending"},
+		Spec:    &types.PodSpec{Labels: in.PodSpec.Labels},
+	}
+	return &types.PodCreateResponse{PodID: podID}, f.err
 }
 
 func (f *fakeClientInterface) PodInfo(ctx context.Context, in *types.PodInfoRequest, opts ...grpc.CallOption) (*types.PodInfoResponse, error) {
@@ -164,11 +205,37 @@ func (f *fakeClientInterface) PodRemove(ctx context.Context, in *types.PodRemove
 }
 
 func (f *fakeClientInterface) PodStart(ctx context.Context, in *types.PodStartRequest, opts ...grpc.CallOption) (*types.PodStartResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	f.called = append(f.called, "PodStart")
+	hold := f.startHold
+	f.Unlock()
+	// Simulate a slow VM boot: block until the test releases the start or
+	// the caller's deadline expires.
+	if hold != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-hold:
+		}
+	}
+	f.Lock()
+	defer f.Unlock()
+	if podInfo, ok := f.podInfoMap[in.PodID]; ok {
+		podInfo.Status.Phase = "Running"
+	}
+	return &types.PodStartResponse{}, nil
 }
 
 func (f *fakeClientInterface) PodStop(ctx context.Context, in *types.PodStopRequest, opts ...grpc.CallOption) (*types.PodStopResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	defer f.Unlock()
+	f.called = append(f.called, "PodStop")
+	podInfo, ok := f.podInfoMap[in.PodID]
+	if !ok {
+		return nil, fmt.Errorf("pod doesn't existed")
+	}
+	podInfo.Status.Phase = "Succeeded"
+	return &types.PodStopResponse{}, f.err
 }
 
 func (f *fakeClientInterface) PodSignal(ctx context.Context, in *types.PodSignalRequest, opts ...grpc.CallOption) (*types.PodSignalResponse, error) {
@@ -256,7 +323,14 @@ func (f *fakeClientInterface) SetPodLabels(ctx context.Context, in *types.PodLab
 }
 
 func (f *fakeClientInterface) PodStats(ctx context.Context, in *types.PodStatsRequest, opts ...grpc.CallOption) (*types.PodStatsResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	defer f.Unlock()
+	f.called = append(f.called, "PodStats")
+	podStats, ok := f.podStatsMap[in.PodID]
+	if !ok {
+		return nil, fmt.Errorf("pod doesn't existed")
+	}
+	return &types.PodStatsResponse{PodStats: podStats}, nil
 }
 
 func (f *fakeClientInterface) ContainerLogs(ctx context.Context, in *types.ContainerLogsRequest, opts ...grpc.CallOption) (types.PublicAPI_ContainerLogsClient, error) {
@@ -265,8 +339,15 @@ func (f *fakeClientInterface) ContainerLogs(ctx context.Context, in *types.Conta
 
 func (f *fakeClientInterface) ContainerCreate(ctx context.Context, in *types.ContainerCreateRequest, opts ...grpc.CallOption) (*types.ContainerCreateResponse, error) {
 	f.Lock()
-	defer f.Unlock()
 	f.called = append(f.called, "ContainerCreate")
+	hold := f.createHold
+	f.Unlock()
+	if hold != nil {
+		<-hold
+	}
+
+	f.Lock()
+	defer f.Unlock()
 	timestamp := f.Clock.Now()
 
 	volumeMounts := []*types.VolumeMount{}
@@ -316,6 +397,9 @@ func (f *fakeClientInterface) ContainerStart(ctx context.Context, in *types.Cont
 	if !ok {
 		return nil, fmt.Errorf("container doesn't existed")
 	}
+	if err := f.startContainerErrors[containerID]; err != nil {
+		return nil, err
+	}
 	containerInfo.Status.Phase = "running"
 	return &types.ContainerStartResponse{}, f.err
 }
@@ -332,6 +416,7 @@ func (f *fakeClientInterface) ContainerStop(ctx context.Context, in *types.Conta
 	f.Lock()
 	defer f.Unlock()
 	f.called = append(f.called, "ContainerStop")
+	f.stopTimeout = in.Timeout
 	containerID := in.ContainerID
 	containerInfo, ok := f.containerInfoMap[containerID]
 	if !ok {
@@ -352,6 +437,9 @@ func (f *fakeClientInterface) ContainerRemove(ctx context.Context, in *types.Con
 	f.Lock()
 	defer f.Unlock()
 	f.called = append(f.called, "ContainerRemove")
+	if err := f.removeContainerErrors[in.ContainerId]; err != nil {
+		return nil, err
+	}
 	delete(f.containerInfoMap, in.ContainerId)
 	return &types.ContainerRemoveResponse{}, f.err
 }
@@ -372,6 +460,8 @@ func (f *fakeClientInterface) ExecCreate(ctx context.Context, in *types.ExecCrea
 
 type fakePublicAPI_ExecStartClient struct {
 	grpc.ClientStream
+	stdout []byte
+	sent   bool
 }
 
 func (x *fakePublicAPI_ExecStartClient) Send(m *types.ExecStartRequest) error {
@@ -379,6 +469,10 @@ func (x *fakePublicAPI_ExecStartClient) Send(m *types.ExecStartRequest) error {
 }
 
 func (x *fakePublicAPI_ExecStartClient) Recv() (*types.ExecStartResponse, error) {
+	if len(x.stdout) > 0 && !x.sent {
+		x.sent = true
+		return &types.ExecStartResponse{Stdout: x.stdout}, nil
+	}
 	m := &types.ExecStartResponse{}
 	return m, io.EOF
 }
@@ -391,11 +485,14 @@ func (f *fakeClientInterface) ExecStart(ctx context.Context, opts ...grpc.CallOp
 	f.Lock()
 	defer f.Unlock()
 	f.called = append(f.called, "ExecStart")
-	return &fakePublicAPI_ExecStartClient{}, f.err
+	return &fakePublicAPI_ExecStartClient{stdout: f.execStdout}, f.err
 }
 
 func (f *fakeClientInterface) ExecSignal(ctx context.Context, in *types.ExecSignalRequest, opts ...grpc.CallOption) (*types.ExecSignalResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	defer f.Unlock()
+	f.called = append(f.called, "ExecSignal")
+	return &types.ExecSignalResponse{}, f.err
 }
 
 type fakePublicAPI_AttachClient struct {
@@ -454,9 +551,27 @@ func (f *fakeClientInterface) ServiceUpdate(ctx context.Context, in *types.Servi
 
 type fakeAPIImagePullClient struct {
 	grpc.ClientStream
+	ctx  context.Context
+	hold chan struct{}
+	data [][]byte
+	next int
 }
 
 func (x *fakeAPIImagePullClient) Recv() (*types.ImagePullResponse, error) {
+	if x.next < len(x.data) {
+		m := &types.ImagePullResponse{Data: x.data[x.next]}
+		x.next++
+		return m, nil
+	}
+	// Simulate a long-running pull: block until the test releases the
+	// stream or the caller's context is cancelled.
+	if x.hold != nil {
+		select {
+		case <-x.ctx.Done():
+			return nil, x.ctx.Err()
+		case <-x.hold:
+		}
+	}
 	m := &types.ImagePullResponse{}
 	//Return "the image data has been read"
 	return m, io.EOF
@@ -482,7 +597,7 @@ func (f *fakeClientInterface) ImagePull(ctx context.Context, in *types.ImagePull
 		VirtualSize: 0,
 	}
 	f.imageInfoList = append(f.imageInfoList, imageInfo)
-	return &fakeAPIImagePullClient{}, f.err
+	return &fakeAPIImagePullClient{ctx: ctx, hold: f.pullHold, data: f.pullData}, f.err
 }
 
 func (f *fakeClientInterface) ImagePush(ctx context.Context, in *types.ImagePushRequest, opts ...grpc.CallOption) (types.PublicAPI_ImagePushClient, error) {
@@ -518,7 +633,13 @@ func (f *fakeClientInterface) Ping(ctx context.Context, in *types.PingRequest, o
 }
 
 func (f *fakeClientInterface) Info(ctx context.Context, in *types.InfoRequest, opts ...grpc.CallOption) (*types.InfoResponse, error) {
-	return nil, fmt.Errorf("Not implemented")
+	f.Lock()
+	defer f.Unlock()
+	f.called = append(f.called, "Info")
+	if f.daemonInfo == nil {
+		return nil, fmt.Errorf("Not implemented")
+	}
+	return f.daemonInfo, f.err
 }
 
 func (f *fakeClientInterface) Version(ctx context.Context, in *types.VersionRequest, opts ...grpc.CallOption) (*types.VersionResponse, error) {
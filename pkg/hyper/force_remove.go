@@ -0,0 +1,119 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+)
+
+// ForceRemoveSandbox is the operator escape hatch for a wedged sandbox.
+// Unlike the graceful StopPodSandbox/RemovePodSandbox path it never gives
+// up on a failing step: containers are killed with a zero grace period,
+// the VM is stopped and removed, the network is torn down from the
+// checkpoint and frakti's own state for the sandbox is purged, each step
+// proceeding regardless of earlier failures. The failures are returned so
+// the operator can see what was left behind.
+//
+// This bypasses every safety of the normal teardown and must only be used
+// when the graceful path is stuck; running containers are killed without
+// warning.
+func (h *Runtime) ForceRemoveSandbox(podSandboxID string) []error {
+	glog.Warningf("Force-removing sandbox %s, bypassing the graceful teardown", podSandboxID)
+
+	var failures []error
+	fail := func(format string, args ...interface{}) {
+		err := fmt.Errorf(format, args...)
+		glog.Errorf("Force-remove sandbox %s: %v", podSandboxID, err)
+		failures = append(failures, err)
+	}
+
+	h.cancelPodPulls(podSandboxID)
+
+	// Kill and remove the pod's containers with no grace period.
+	if containers, err := h.client.GetContainerList(); err != nil {
+		fail("list containers: %v", err)
+	} else {
+		for _, c := range containers {
+			if c.PodID != podSandboxID {
+				continue
+			}
+			if err := h.client.StopContainer(c.ContainerID, 0); err != nil {
+				fail("kill container %s: %v", c.ContainerID, err)
+			}
+			if err := h.client.RemoveContainer(c.ContainerID); err != nil {
+				fail("remove container %s: %v", c.ContainerID, err)
+			}
+			h.forgetContainerRefs(c.ContainerID)
+			h.containerLabels.Remove(c.ContainerID)
+		}
+	}
+
+	// Kill the VM.
+	if code, cause, err := h.client.StopPod(podSandboxID); err != nil && !isPodNotFoundError(err, podSandboxID) {
+		fail("stop pod (code %d, cause %q): %v", code, cause, err)
+	}
+	if err := h.client.RemovePod(podSandboxID); err != nil && !isPodNotFoundError(err, podSandboxID) {
+		fail("remove pod: %v", err)
+	}
+
+	// Tear down the network from the checkpoint. Without a checkpoint the
+	// network state is unknown and is left for the operator.
+	checkpoint, err := h.checkpointHandler.GetCheckpoint(podSandboxID)
+	if err != nil {
+		glog.Warningf("Force-remove sandbox %s: no checkpoint, skipping network teardown: %v", podSandboxID, err)
+	}
+	if checkpoint != nil && checkpoint.NetNsPath != "" {
+		netNsPath := checkpoint.NetNsPath
+		if checkpoint.Data != nil && len(checkpoint.Data.Interfaces) > 0 {
+			if err := teardownRelayBridgeInNetns(netNsPath, checkpoint.Data.Interfaces); err != nil {
+				fail("teardown relay bridge inside netns %q: %v", netNsPath, err)
+			}
+		}
+		if err := teardownRelayBridgeInHost(checkpoint.HostBridge); err != nil {
+			fail("teardown host relay bridge %q: %v", checkpoint.HostBridge, err)
+		}
+
+		portMappingsParam := checkpointCNIPortMappings(checkpoint)
+		capabilities := map[string]interface{}{
+			"portMappings": portMappingsParam,
+		}
+		sandboxID := podSandboxID
+		// workaroud for weave network plugin because it creates a veth pair based on a truncated sandboxID.
+		if h.netPlugin.Name() == "weave" {
+			sandboxID = getMD5Hash(podSandboxID)
+		}
+		if err := h.netPlugin.TearDownPod(netNsPath, sandboxID, nil, nil, capabilities); err != nil {
+			fail("teardown CNI network: %v", err)
+		}
+
+		unix.Unmount(netNsPath, unix.MNT_DETACH)
+		os.Remove(netNsPath)
+	}
+
+	// Purge frakti's own state even when earlier steps failed, so kubelet
+	// stops seeing the sandbox.
+	if err := h.checkpointHandler.RemoveCheckpoint(podSandboxID); err != nil {
+		fail("remove checkpoint: %v", err)
+	}
+	h.sandboxLabels.Remove(podSandboxID)
+
+	return failures
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceRemoveSandbox(t *testing.T) {
+	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+	fakeClient.SetFakeContainers([]*FakeContainer{
+		{ID: "c*1", Name: "k8s_one_foo_bar_p*0_1", PodID: podID, Status: "failed"},
+		{ID: "c*2", Name: "k8s_two_foo_bar_p*0_1", PodID: podID, Status: "failed"},
+	})
+	// One container is wedged and refuses to be removed; the force
+	// removal reports it but still takes everything else down.
+	fakeClient.removeContainerErrors = map[string]error{"c*1": fmt.Errorf("device busy")}
+
+	checkpoint := NewPodSandboxCheckpoint("bar", "foo")
+	err := checkpointHandler.CreateCheckpoint(podID, checkpoint)
+	assert.NoError(t, err)
+
+	failures := r.ForceRemoveSandbox(podID)
+	assert.Len(t, failures, 1)
+	assert.Contains(t, failures[0].Error(), "c*1")
+
+	assert.Contains(t, fakeClient.called, "PodRemove")
+	_, podThere := fakeClient.podInfoMap[podID]
+	assert.False(t, podThere)
+	_, stillThere := fakeClient.containerInfoMap["c*2"]
+	assert.False(t, stillThere)
+	_, err = checkpointHandler.GetCheckpoint(podID)
+	assert.Error(t, err)
+
+	// Force-removing an unknown sandbox never panics, it just reports
+	// whatever it could not clean.
+	assert.NotPanics(t, func() { r.ForceRemoveSandbox("no-such-pod") })
+}
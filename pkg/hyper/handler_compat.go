@@ -0,0 +1,59 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// supportedHypervisorsAnnotationKey declares, comma-separated on a
+// container, which hypervisor drivers its image works on, e.g. an image
+// carrying driver-specific guest tooling. hyperd's image metadata has no
+// place for such requirements, so they travel as a container annotation.
+const supportedHypervisorsAnnotationKey = "runtime.frakti.alpha.kubernetes.io/SupportedHypervisors"
+
+// checkHandlerCompatibility rejects a container whose image declares
+// hypervisor requirements the sandbox's chosen VM driver does not meet, so
+// the mismatch surfaces as a descriptive error at create time instead of an
+// obscure hyperd failure inside the VM. When the sandbox selected no driver
+// the node default applies, which frakti does not know; the check is
+// skipped rather than guessed.
+func checkHandlerCompatibility(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) error {
+	value := config.GetAnnotations()[supportedHypervisorsAnnotationKey]
+	if value == "" {
+		return nil
+	}
+	supported := splitPodOptionList(value)
+	if len(supported) == 0 {
+		return fmt.Errorf("annotation %q of container %q must list at least one hypervisor driver", supportedHypervisorsAnnotationKey, config.Metadata.Name)
+	}
+
+	driver := sandboxConfig.GetAnnotations()[podOptionVMType]
+	if driver == "" {
+		return nil
+	}
+
+	for _, s := range supported {
+		if strings.EqualFold(driver, s) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %q of container %q supports hypervisor drivers %s, but its sandbox runs on %q", config.GetImage().GetImage(), config.Metadata.Name, strings.Join(supported, ", "), driver)
+}
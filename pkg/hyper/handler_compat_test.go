@@ -0,0 +1,54 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateContainerHandlerCompatibility(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+
+	// The sandbox runs on libvirt, the image only works on qemu.
+	sConfig := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{podOptionVMType: "libvirt"})
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{},
+		map[string]string{supportedHypervisorsAnnotationKey: "qemu"}, nil)
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "supports hypervisor drivers qemu")
+	assert.Contains(t, err.Error(), `"libvirt"`)
+	assert.NotContains(t, fakeClient.called, "ContainerCreate")
+
+	// A matching driver passes, case-insensitively.
+	config = makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{},
+		map[string]string{supportedHypervisorsAnnotationKey: "kvm, QEMU"}, nil)
+	sConfig.Annotations[podOptionVMType] = "qemu"
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// Without an explicit driver the node default applies, which frakti
+	// cannot check against; the container is not rejected on a guess.
+	delete(sConfig.Annotations, podOptionVMType)
+	config = makeContainerConfig(sConfig, "app2", "app:v1", 0, map[string]string{},
+		map[string]string{supportedHypervisorsAnnotationKey: "qemu"}, nil)
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+}
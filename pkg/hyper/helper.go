@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"net"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -33,6 +34,8 @@ import (
 	"github.com/golang/glog"
 	libcontainercgroups "github.com/opencontainers/runc/libcontainer/cgroups"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/frakti/pkg/hyper/types"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
@@ -47,6 +50,80 @@ const (
 
 	containerLogPathLabelKey = "io.kubernetes.container.logpath"
 
+	// oomScoreAdjLabelKey keeps the requested OOM score adjustment in container
+	// labels since hyperd has no spec field to enforce it inside the VM.
+	oomScoreAdjLabelKey = "io.kubernetes.frakti.oom-score-adj"
+
+	// seccompProfileLabelKey keeps the container's effective seccomp
+	// profile in labels, since hyperd's container spec has no seccomp
+	// field to carry it.
+	seccompProfileLabelKey = "io.kubernetes.frakti.seccomp-profile"
+
+	// stdinLabelKey and stdinOnceLabelKey keep the container's requested
+	// stdin semantics in labels, since hyperd's container spec has no
+	// stdin fields; the attach path reads them back to decide whether
+	// (and how often) to wire up a stdin stream.
+	stdinLabelKey     = "io.kubernetes.frakti.stdin"
+	stdinOnceLabelKey = "io.kubernetes.frakti.stdin-once"
+
+	// cgroupParentLabelKey keeps the cgroup parent requested by kubelet in pod
+	// labels, since the VM itself is not placed under the QoS cgroup hierarchy.
+	cgroupParentLabelKey = "io.kubernetes.frakti.cgroup-parent"
+
+	// qosClassLabelKey keeps the pod's QoS class in pod labels. hyperd has no
+	// scheduling priority concept yet, so the class only rides along as a
+	// hint; once hyperd grows one, this is what Guaranteed pods would map
+	// onto a firmer reservation from.
+	qosClassLabelKey = "io.kubernetes.frakti.qos-class"
+
+	// podSubdomainAnnotationKey is the annotation carrying the pod's subdomain,
+	// used to build the FQDN hostname for the sandbox VM.
+	podSubdomainAnnotationKey = "runtime.frakti.alpha.kubernetes.io/Subdomain"
+
+	// containerSummaryAnnotationKey carries a "<running>/<total> containers
+	// running" summary in the sandbox status, since a sandbox stays READY
+	// even when all of its containers have failed.
+	containerSummaryAnnotationKey = "runtime.frakti.alpha.kubernetes.io/ContainerSummary"
+
+	// hyperdPodIDAnnotationKey and hyperdVMIDAnnotationKey expose the
+	// hyperd pod ID and its VM ID in the sandbox status annotations, so a
+	// Kubernetes pod can be traced to its VM without a manual lookup.
+	hyperdPodIDAnnotationKey = "runtime.frakti.alpha.kubernetes.io/HyperdPodID"
+	hyperdVMIDAnnotationKey  = "runtime.frakti.alpha.kubernetes.io/HyperdVMID"
+
+	// defaultRegistryHost names the default registry for images without an
+	// explicit registry host, used when matching registry policy lists.
+	defaultRegistryHost = "docker.io"
+
+	// Valid kernel range of /proc/<pid>/oom_score_adj.
+	minOomScoreAdj = -1000
+	maxOomScoreAdj = 1000
+
+	// Default terminated reasons reported to kubelet when hyperd does
+	// not populate one.
+	reasonCompleted = "Completed"
+	reasonError     = "Error"
+	reasonOOMKilled = "OOMKilled"
+
+	// sigkillExitCode is 128 + SIGKILL; the kernel OOM killer terminates
+	// processes with SIGKILL.
+	sigkillExitCode = 137
+
+	// defaultWaitingReason is reported for containers that are neither
+	// running nor terminated when hyperd gives no waiting reason.
+	defaultWaitingReason = "ContainerCreating"
+
+	// Annotation keys set by kubelet carrying the container's termination
+	// message configuration.
+	terminationMessagePathKey   = "io.kubernetes.container.terminationMessagePath"
+	terminationMessagePolicyKey = "io.kubernetes.container.terminationMessagePolicy"
+	// terminationMessageFallbackPolicy reads the tail of the container log
+	// when no message file content is available and the container failed.
+	terminationMessageFallbackPolicy = "FallbackToLogsOnError"
+	// maxTerminationMessageLength bounds the reported termination message,
+	// matching the limit kubelet applies.
+	maxTerminationMessageLength = 4096
+
 	// More details about these: http://kubernetes.io/docs/user-guide/compute-resources/
 	// cpuQuotaCgroupFile is the `cfs_quota_us` value set by kubelet pod qos
 	cpuQuotaCgroupFile = "cpu.cfs_quota_us"
@@ -92,19 +169,60 @@ func getHyperAuthConfig(auth *kubeapi.AuthConfig) *types.AuthConfig {
 func parseRepositoryTag(repos string) (string, string) {
 	n := strings.Index(repos, "@")
 	if n >= 0 {
-		parts := strings.Split(repos, "@")
-		return parts[0], parts[1]
+		// Split on the first "@" only, so a malformed reference with
+		// several of them keeps the full digest part.
+		return repos[:n], repos[n+1:]
 	}
 	n = strings.LastIndex(repos, ":")
 	if n < 0 {
 		return repos, "latest"
 	}
-	if tag := repos[n+1:]; !strings.Contains(tag, "/") {
+	if tag := repos[n+1:]; tag != "" && !strings.Contains(tag, "/") {
 		return repos[:n], tag
+	} else if tag == "" {
+		// A trailing colon is treated like no tag at all.
+		return repos[:n], "latest"
 	}
 	return repos, "latest"
 }
 
+// canonicalizeImageName expands the implicit parts of an image reference
+// so two spellings of the same image compare equal: bare library images
+// get the implicit "docker.io/library/" prefix, unqualified user images
+// the "docker.io/" registry, and a missing tag defaults to "latest".
+// Digest references keep their "@" separator.
+func canonicalizeImageName(image string) string {
+	repo, tag := parseRepositoryTag(image)
+	if firstSlash := strings.Index(repo, "/"); firstSlash < 0 {
+		repo = defaultRegistryHost + "/library/" + repo
+	} else if host := repo[:firstSlash]; !strings.ContainsAny(host, ".:") && host != "localhost" {
+		repo = defaultRegistryHost + "/" + repo
+	}
+	if strings.Contains(tag, ":") {
+		// parseRepositoryTag reports digests as the tag.
+		return repo + "@" + tag
+	}
+	return repo + ":" + tag
+}
+
+// sameImageRef reports whether two image references point at the same
+// image once both are canonicalized.
+func sameImageRef(a, b string) bool {
+	return canonicalizeImageName(a) == canonicalizeImageName(b)
+}
+
+// inRefList checks whether ref matches any entry of list under image name
+// canonicalization.
+func inRefList(ref string, list []string) bool {
+	for _, str := range list {
+		if sameImageRef(ref, str) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // inList checks if a string is in a list
 func inList(in string, list []string) bool {
 	for _, str := range list {
@@ -116,11 +234,32 @@ func inList(in string, list []string) bool {
 	return false
 }
 
+// nameClusterID, when set, namespaces every hyperd-side pod and container
+// name so multiple frakti instances can share one hyperd without name
+// collisions. Built names get "<clusterID>_" prepended and read-back
+// parsing strips it again, so kubelet only ever sees the original names
+// and names carrying another instance's ID fail to parse as ours.
+var nameClusterID string
+
+// SetClusterID configures the hyperd-side name namespace. An empty ID
+// keeps names unprefixed.
+func SetClusterID(id string) error {
+	if strings.Contains(id, "_") {
+		return fmt.Errorf("cluster ID %q must not contain the name separator %q", id, "_")
+	}
+	nameClusterID = id
+	return nil
+}
+
 // buildKubeGenericName creates a name which can be reversed to identify container/sandbox name.
 // This function returns the unique name.
 func buildKubeGenericName(sandboxConfig *kubeapi.PodSandboxConfig, containerName string) string {
+	prefix := kubePrefix
+	if nameClusterID != "" {
+		prefix = nameClusterID + "_" + kubePrefix
+	}
 	stableName := fmt.Sprintf("%s_%s_%s_%s_%s",
-		kubePrefix,
+		prefix,
 		containerName,
 		sandboxConfig.GetMetadata().Name,
 		sandboxConfig.GetMetadata().Namespace,
@@ -157,6 +296,13 @@ func buildContainerName(sandboxConfig *kubeapi.PodSandboxConfig, containerConfig
 // container name and attempt.
 func parseContainerName(name string) (podName, podNamespace, podUID, containerName string, attempt uint32, err error) {
 	parts := strings.Split(name, "_")
+	if nameClusterID != "" {
+		if len(parts) < 2 || parts[0] != nameClusterID {
+			err = fmt.Errorf("container name %q does not carry cluster ID %q", name, nameClusterID)
+			return "", "", "", "", 0, err
+		}
+		parts = parts[1:]
+	}
 	if len(parts) == 0 || parts[0] != kubePrefix {
 		err = fmt.Errorf("failed to parse container name %q into parts", name)
 		return "", "", "", "", 0, err
@@ -215,6 +361,11 @@ func getAnnotationsFromLabels(labels map[string]string) map[string]string {
 }
 
 // toPodSandboxState transfers state to kubelet sandbox state.
+// toPodSandboxState maps hyperd's pod phase to the CRI sandbox state. By
+// CRI semantics a sandbox is READY as long as the pod VM itself runs, even
+// when every container inside it has crashed; container level state is
+// surfaced separately (see containerSummaryAnnotationKey) so tooling can
+// tell the two situations apart.
 func toPodSandboxState(state string) kubeapi.PodSandboxState {
 	if state == "running" || state == "Running" {
 		return kubeapi.PodSandboxState_SANDBOX_READY
@@ -227,9 +378,29 @@ func toPodSandboxState(state string) kubeapi.PodSandboxState {
 func getKubeletLabels(lables map[string]string) map[string]string {
 	delete(lables, fraktiAnnotationLabel)
 	delete(lables, containerLogPathLabelKey)
+	delete(lables, oomScoreAdjLabelKey)
+	delete(lables, cgroupParentLabelKey)
+	delete(lables, stdinLabelKey)
+	delete(lables, stdinOnceLabelKey)
+	delete(lables, seccompProfileLabelKey)
+	delete(lables, qosClassLabelKey)
+	delete(lables, podPriorityLabelKey)
+	delete(lables, containerVcpuLabelKey)
+	delete(lables, containerMemoryMBLabelKey)
 	return lables
 }
 
+// clampOomScoreAdj clamps the OOM score adjustment into the valid kernel range.
+func clampOomScoreAdj(value int64) int64 {
+	if value < minOomScoreAdj {
+		return minOomScoreAdj
+	}
+	if value > maxOomScoreAdj {
+		return maxOomScoreAdj
+	}
+	return value
+}
+
 // inMap checks if a map is in dest map.
 func inMap(in, dest map[string]string) bool {
 	for k, v := range in {
@@ -282,6 +453,44 @@ func parseTimeString(str string) (int64, error) {
 }
 
 // toKubeContainerState transfers state to kubelet container state.
+// toKubePodIP picks the pod IP reported to kubelet from hyperd's address
+// list. CRI v1alpha1 only carries a single IP, so prefer the first IPv4
+// address and fall back to the first IPv6 one instead of blindly taking the
+// first entry. hyperd may report addresses with a CIDR suffix, strip it.
+func toKubePodIP(podIPs []string) string {
+	fallback := ""
+	for _, addr := range podIPs {
+		ipStr := strings.Split(addr, "/")[0]
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			continue
+		}
+
+		if ip.To4() != nil {
+			return ipStr
+		}
+		if fallback == "" {
+			fallback = ipStr
+		}
+	}
+	return fallback
+}
+
+// toKubeContainerMetadata translates a hyperd container name into CRI
+// container metadata. Both ListContainers and ContainerStatus go through it,
+// so the name scheme is interpreted in exactly one place.
+func toKubeContainerMetadata(containerName string) (*kubeapi.ContainerMetadata, error) {
+	_, _, _, name, attempt, err := parseContainerName(strings.Replace(containerName, "/", "", -1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubeapi.ContainerMetadata{
+		Name:    name,
+		Attempt: attempt,
+	}, nil
+}
+
 func toKubeContainerState(state string) kubeapi.ContainerState {
 	switch state {
 	case "running":
@@ -295,6 +504,133 @@ func toKubeContainerState(state string) kubeapi.ContainerState {
 	}
 }
 
+// parseRegistryHost returns the registry host of repos, or "" when repos
+// refers to the default registry (e.g. "busybox" or "library/busybox").
+func parseRegistryHost(repos string) string {
+	parts := strings.SplitN(repos, "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	// Only the first component containing a '.', a ':' or being
+	// "localhost" names a registry host, everything else is a repository
+	// path on the default registry.
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return parts[0]
+	}
+	return ""
+}
+
+// isInsecureRegistry checks whether registry is explicitly allowed to be
+// accessed over plain HTTP or with an unverified certificate. Registries
+// are secure unless opted-in.
+func (h *Runtime) isInsecureRegistry(registry string) bool {
+	if registry == "" {
+		return false
+	}
+
+	h.registryPolicyLock.RLock()
+	defer h.registryPolicyLock.RUnlock()
+	for _, insecure := range h.insecureRegistries {
+		if registry == insecure {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRegistryPolicy enforces the node-level registry policy on a pull.
+// A registry on the blocked list, or any registry when an allow list is
+// configured and the registry is not on it, is rejected with
+// PermissionDenied. Empty lists allow everything; the empty registry means
+// the default registry and is matched with the name "docker.io".
+func (h *Runtime) checkRegistryPolicy(registry string) error {
+	if registry == "" {
+		registry = defaultRegistryHost
+	}
+
+	h.registryPolicyLock.RLock()
+	defer h.registryPolicyLock.RUnlock()
+	for _, blocked := range h.blockedRegistries {
+		if registry == blocked {
+			return status.Errorf(codes.PermissionDenied, "pulls from registry %q are blocked by node policy", registry)
+		}
+	}
+
+	if len(h.allowedRegistries) == 0 {
+		return nil
+	}
+	for _, allowed := range h.allowedRegistries {
+		if registry == allowed {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "registry %q is not on this node's allowed registry list", registry)
+}
+
+// checkSandboxCapacity rejects a new sandbox when the configured soft limit
+// on concurrent sandboxes is reached, returning ResourceExhausted so kubelet
+// backs off instead of overcommitting the node VM resources. A zero limit
+// disables the check.
+func (h *Runtime) checkSandboxCapacity() error {
+	if h.maxPods <= 0 {
+		return nil
+	}
+
+	podList, err := h.client.GetPodList()
+	if err != nil {
+		return err
+	}
+	if int32(len(podList)) >= h.maxPods {
+		glog.Warningf("Sandbox soft limit of %d reached, rejecting new sandbox", h.maxPods)
+		return status.Errorf(codes.ResourceExhausted, "sandbox limit %d reached", h.maxPods)
+	}
+	return nil
+}
+
+// checkContainerCapacity is the container counterpart of
+// checkSandboxCapacity.
+func (h *Runtime) checkContainerCapacity() error {
+	if h.maxContainers <= 0 {
+		return nil
+	}
+
+	containerList, err := h.client.GetContainerList()
+	if err != nil {
+		return err
+	}
+	if int32(len(containerList)) >= h.maxContainers {
+		glog.Warningf("Container soft limit of %d reached, rejecting new container", h.maxContainers)
+		return status.Errorf(codes.ResourceExhausted, "container limit %d reached", h.maxContainers)
+	}
+	return nil
+}
+
+// toKubeTerminatedReason builds the reason reported for a terminated
+// container. hyperd may leave the reason empty, in which case it is derived
+// from the exit code so that cleanly finished containers show "Completed".
+func toKubeTerminatedReason(terminated *types.TermStatus) string {
+	// Normalize however hyperd spells a memory kill to the reason
+	// kubelet understands, so restart policies treat it correctly.
+	if strings.Contains(strings.ToLower(terminated.Reason), "oom") {
+		return reasonOOMKilled
+	}
+	if terminated.Reason != "" {
+		return terminated.Reason
+	}
+
+	switch terminated.ExitCode {
+	case 0:
+		return reasonCompleted
+	case sigkillExitCode:
+		// hyperd reports no reason for kernel OOM kills; the SIGKILL
+		// exit code is the only trace left.
+		return reasonOOMKilled
+	default:
+		return reasonError
+	}
+}
+
 // TODO(harry) These two methods will find subsystem mount point frequently, consider move FindCgroupMountpoint into a unified place.
 // getCpuLimitFromCgroup get the cpu limit from given cgroupParent
 func (h *Runtime) getCpuLimitFromCgroup(cgroupParent string) (int32, error) {
@@ -401,7 +737,13 @@ func isPodSandboxRunning(client *Client, podID string) (bool, error) {
 		return false, err
 	}
 
-	return podInfo.Status.Phase == "Running", nil
+	return podInfo.Status.Phase == "Running" || podInfo.Status.Phase == "running", nil
+}
+
+// isContainerNotFoundError returns if error means the container is not found
+// in hyperd, riding on the shared hyperd error classifier.
+func isContainerNotFoundError(err error) bool {
+	return err != nil && classifyHyperdError(err) == errorNotFound
 }
 
 // isPodNotFoundError returns if error type is not found in hyperd
@@ -17,8 +17,12 @@ limitations under the License.
 package hyper
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
@@ -55,6 +59,189 @@ func TestBuildSandboxName(t *testing.T) {
 	}
 }
 
+func TestToKubePodIP(t *testing.T) {
+	for i, test := range []struct {
+		podIPs   []string
+		expected string
+	}{
+		// No address at all.
+		{nil, ""},
+		// A single IPv4 address, with and without a CIDR suffix.
+		{[]string{"10.244.1.2"}, "10.244.1.2"},
+		{[]string{"10.244.1.2/24"}, "10.244.1.2"},
+		// IPv4 is preferred over IPv6 regardless of ordering.
+		{[]string{"fd00::2", "10.244.1.2"}, "10.244.1.2"},
+		// An IPv6-only pod reports its IPv6 address.
+		{[]string{"fd00::2/64", "fd00::3"}, "fd00::2"},
+		// Unparsable entries are skipped.
+		{[]string{"bogus", "10.244.1.2"}, "10.244.1.2"},
+	} {
+		if actual := toKubePodIP(test.podIPs); actual != test.expected {
+			t.Errorf("case %d: expected %q for %v, but got %q", i, test.expected, test.podIPs, actual)
+		}
+	}
+}
+
+func TestParseRepositoryTag(t *testing.T) {
+	for _, test := range []struct {
+		repos        string
+		expectedRepo string
+		expectedTag  string
+	}{
+		// A bare repository defaults to the latest tag.
+		{"busybox", "busybox", "latest"},
+		{"library/busybox", "library/busybox", "latest"},
+		// Explicit tags.
+		{"busybox:1.25", "busybox", "1.25"},
+		{"localhost.localdomain:5000/samalba/hipache:latest", "localhost.localdomain:5000/samalba/hipache", "latest"},
+		// A port in the registry host is not a tag.
+		{"localhost:5000/samalba/hipache", "localhost:5000/samalba/hipache", "latest"},
+		{"myregistry.local:5000/foo/bar:v2", "myregistry.local:5000/foo/bar", "v2"},
+		// Digest references keep the full digest as the "tag".
+		{"localhost:5000/foo/bar@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", "localhost:5000/foo/bar", "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"},
+		{"busybox@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", "busybox", "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"},
+		// Malformed references still split deterministically.
+		{"", "", "latest"},
+		{"busybox:", "busybox", "latest"},
+		{"busybox@", "busybox", ""},
+		{"busybox@sha256:digest@extra", "busybox", "sha256:digest@extra"},
+	} {
+		repo, tag := parseRepositoryTag(test.repos)
+		if repo != test.expectedRepo || tag != test.expectedTag {
+			t.Errorf("Expected (%q, %q) for %q, but got (%q, %q)",
+				test.expectedRepo, test.expectedTag, test.repos, repo, tag)
+		}
+	}
+}
+
+func FuzzParseRepositoryTag(f *testing.F) {
+	for _, seed := range []string{
+		"busybox",
+		"busybox:1.25",
+		"localhost:5000/samalba/hipache",
+		"localhost.localdomain:5000/samalba/hipache:latest",
+		"localhost:5000/foo/bar@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		"busybox@",
+		":",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, repos string) {
+		repo, tag := parseRepositoryTag(repos)
+		// A tag never contains a "/", otherwise a registry port was
+		// mistaken for a tag.
+		if strings.Contains(tag, "/") {
+			t.Errorf("Tag %q of %q contains a path separator", tag, repos)
+		}
+		// Tagged references must round trip to the input.
+		if !strings.Contains(repos, "@") && strings.HasSuffix(repos, ":"+tag) {
+			if joined := repo + ":" + tag; joined != repos {
+				t.Errorf("Expected %q to round trip, but got %q", repos, joined)
+			}
+		}
+		// Digest references round trip through "@".
+		if n := strings.Index(repos, "@"); n >= 0 {
+			if joined := repo + "@" + tag; joined != repos {
+				t.Errorf("Expected %q to round trip, but got %q", repos, joined)
+			}
+		}
+	})
+}
+
+func TestParseRegistryHost(t *testing.T) {
+	for repos, expected := range map[string]string{
+		"busybox":                          "",
+		"library/busybox":                  "",
+		"localhost/busybox":                "localhost",
+		"localhost:5000/samalba/hipache":   "localhost:5000",
+		"myregistry.local/busybox":         "myregistry.local",
+		"myregistry.local:5000/foo/bar":    "myregistry.local:5000",
+		"gcr.io/google_containers/busybox": "gcr.io",
+	} {
+		if actual := parseRegistryHost(repos); actual != expected {
+			t.Errorf("Expected registry %q for %q, but got %q", expected, repos, actual)
+		}
+	}
+}
+
+func TestIsInsecureRegistry(t *testing.T) {
+	r := &Runtime{insecureRegistries: []string{"localhost:5000", "myregistry.local"}}
+	for registry, expected := range map[string]bool{
+		"":                 false,
+		"localhost:5000":   true,
+		"myregistry.local": true,
+		"localhost":        false,
+		"gcr.io":           false,
+	} {
+		if actual := r.isInsecureRegistry(registry); actual != expected {
+			t.Errorf("Expected insecure=%v for registry %q, but got %v", expected, registry, actual)
+		}
+	}
+}
+
+func TestCheckRegistryPolicy(t *testing.T) {
+	r, _, _ := newTestRuntime()
+
+	// Everything is allowed by default.
+	assert.NoError(t, r.checkRegistryPolicy("myregistry.local:5000"))
+	assert.NoError(t, r.checkRegistryPolicy(""))
+
+	r.blockedRegistries = []string{"bad.example.com"}
+	err := r.checkRegistryPolicy("bad.example.com")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "blocked by node policy")
+	assert.NoError(t, r.checkRegistryPolicy("good.example.com"))
+
+	// With an allow list only listed registries pass; the empty registry
+	// counts as the default registry.
+	r.allowedRegistries = []string{"good.example.com"}
+	assert.NoError(t, r.checkRegistryPolicy("good.example.com"))
+	assert.Error(t, r.checkRegistryPolicy("other.example.com"))
+	assert.Error(t, r.checkRegistryPolicy(""))
+	r.allowedRegistries = append(r.allowedRegistries, defaultRegistryHost)
+	assert.NoError(t, r.checkRegistryPolicy(""))
+
+	// The pull path enforces the policy too.
+	_, err = r.PullImage(&kubeapi.ImageSpec{Image: "other.example.com/foo:1"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, grpc.Code(err))
+}
+
+func TestCheckSandboxCapacity(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+
+	// Unlimited by default.
+	assert.NoError(t, r.checkSandboxCapacity())
+
+	r.maxPods = 1
+	assert.NoError(t, r.checkSandboxCapacity())
+
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   "p*0",
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "running",
+	}})
+	err := r.checkSandboxCapacity()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sandbox limit 1 reached")
+}
+
+func TestCheckContainerCapacity(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.maxContainers = 1
+	setFakeRunningPods(fakeClient, "sandboxid")
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// The second container exceeds the limit and is rejected.
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "container limit 1 reached")
+}
+
 func TestBuildContainerName(t *testing.T) {
 	var attempt uint32 = 3
 	podUID := "12345678"
@@ -96,3 +283,65 @@ func TestBuildContainerName(t *testing.T) {
 		t.Errorf("Expected: %q, but got %q", attempt, attempActual)
 	}
 }
+
+func TestClusterIDNameRoundTrip(t *testing.T) {
+	assert.Error(t, SetClusterID("bad_id"))
+	assert.NoError(t, SetClusterID("cluster-a"))
+	defer SetClusterID("")
+
+	sandboxConfig := &kubeapi.PodSandboxConfig{
+		Metadata: &kubeapi.PodSandboxMetadata{
+			Uid:       "12345678",
+			Name:      "foo",
+			Namespace: "bar",
+			Attempt:   3,
+		},
+	}
+	containerConfig := &kubeapi.ContainerConfig{
+		Metadata: &kubeapi.ContainerMetadata{
+			Name:    "foo1",
+			Attempt: 2,
+		},
+	}
+
+	// The hyperd-side names carry the cluster ID, but parsing strips it
+	// so kubelet sees the original metadata.
+	sandboxName := buildSandboxName(sandboxConfig)
+	assert.True(t, strings.HasPrefix(sandboxName, "cluster-a_k8s_"))
+	podName, podNamespace, podUID, attempt, err := parseSandboxName(sandboxName)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", podName)
+	assert.Equal(t, "bar", podNamespace)
+	assert.Equal(t, "12345678", podUID)
+	assert.Equal(t, uint32(3), attempt)
+
+	generatedContainerName := buildContainerName(sandboxConfig, containerConfig)
+	assert.True(t, strings.HasPrefix(generatedContainerName, "cluster-a_k8s_"))
+	_, _, _, containerName, attempt, err := parseContainerName(generatedContainerName)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo1", containerName)
+	assert.Equal(t, uint32(2), attempt)
+
+	// Names from an instance with another (or no) cluster ID are not ours.
+	_, _, _, _, err = parseSandboxName("k8s_POD.0_foo_bar_12345678_00000000")
+	assert.Error(t, err)
+	_, _, _, _, err = parseSandboxName("cluster-b_k8s_POD.0_foo_bar_12345678_00000000")
+	assert.Error(t, err)
+}
+
+func TestCanonicalizeImageName(t *testing.T) {
+	cases := map[string]string{
+		"nginx":                              "docker.io/library/nginx:latest",
+		"nginx:1.9":                          "docker.io/library/nginx:1.9",
+		"user/app":                           "docker.io/user/app:latest",
+		"quay.io/foo/bar:v1":                 "quay.io/foo/bar:v1",
+		"localhost:5000/foo/bar":             "localhost:5000/foo/bar:latest",
+		"localhost:5000/foo/bar@sha256:1234": "localhost:5000/foo/bar@sha256:1234",
+	}
+	for image, expected := range cases {
+		assert.Equal(t, expected, canonicalizeImageName(image), "image %q", image)
+	}
+
+	assert.True(t, sameImageRef("nginx", "docker.io/library/nginx:latest"))
+	assert.False(t, sameImageRef("nginx:1.9", "nginx"))
+}
@@ -18,9 +18,12 @@ package hyper
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 
 	"k8s.io/frakti/pkg/hyper/ocicni"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
@@ -34,6 +37,13 @@ const (
 
 	// timeout in second for interacting with hyperd's gRPC API.
 	hyperConnectionTimeout = 300 * time.Second
+
+	// default timeout for a single CNI plugin invocation.
+	defaultCNITimeout = 2 * time.Minute
+
+	// default grace period in seconds for stopping a container when
+	// kubelet does not ask for one.
+	defaultStopContainerGracePeriod = int64(10)
 )
 
 // Runtime is the HyperContainer implementation of kubelet runtime API
@@ -45,11 +55,143 @@ type Runtime struct {
 
 	defaultCPUNum   int32
 	defaultMemoryMB int32
+
+	// cniTimeout bounds a single CNI plugin invocation.
+	cniTimeout time.Duration
+
+	// insecureRegistries is the list of registry hosts that may be
+	// accessed over plain HTTP or with unverified certificates.
+	insecureRegistries []string
+
+	// allowedRegistries and blockedRegistries implement the node-level
+	// registry pull policy. Empty lists allow everything. All three
+	// registry lists are guarded by registryPolicyLock so they can be
+	// swapped at runtime.
+	allowedRegistries  []string
+	blockedRegistries  []string
+	registryPolicyLock sync.RWMutex
+
+	// allowedHypervisors restricts which hypervisor drivers pods may
+	// select via the VMType pod option annotation. Empty allows any
+	// driver hyperd supports.
+	allowedHypervisors []string
+
+	// stopContainerGracePeriod is the grace period in seconds applied
+	// when kubelet requests an immediate container stop.
+	stopContainerGracePeriod int64
+
+	// sandboxLabels and containerLabels index kubelet labels by ID so
+	// label selector filters do not need a full scan.
+	sandboxLabels   *labelIndex
+	containerLabels *labelIndex
+
+	// maxPods and maxContainers are soft limits on the number of
+	// concurrent sandboxes and containers. Zero means no limit.
+	maxPods       int32
+	maxContainers int32
+
+	// execCache optionally caches ExecSync results for a short TTL so
+	// exec probe storms do not each pay a VM round trip. Nil when the
+	// feature is disabled.
+	execCache *execResultCache
+
+	// defaultDNS is applied to sandboxes whose config carries no DNS
+	// servers, so the VM does not end up without a resolver.
+	defaultDNS []string
+
+	// dryRun makes RunPodSandbox translate and validate specs without
+	// creating anything in hyperd. For testing only.
+	dryRun bool
+
+	// enableImagePrePull makes RunPodSandbox pull the images named in the
+	// pre-pull annotation in the background, so the first CreateContainer
+	// does not pay the pull latency.
+	enableImagePrePull bool
+
+	// verifyImagePresence makes CreateContainer check that the container
+	// image is already pulled, failing with a clear NotFound instead of a
+	// confusing hyperd error. Off by default since kubelet normally
+	// guarantees the pull.
+	verifyImagePresence bool
+
+	// pulls coalesces concurrent pulls of the same image reference.
+	pulls *pullSingleFlight
+
+	// imageDigests remembers the manifest digest each repository's last
+	// pull resolved to, so image listings can report RepoDigests even
+	// when hyperd drops them. Guarded by imageDigestsLock.
+	imageDigestsLock sync.Mutex
+	imageDigests     map[string]string
+
+	// containerRefs caches the mapping from container references (IDs
+	// or hyperd container names) to container IDs. Guarded by
+	// containerRefsLock; lazily initialized.
+	containerRefsLock sync.Mutex
+	containerRefs     map[string]string
+
+	// createLimiter bounds concurrent sandbox and container creates so
+	// a kubelet sync storm does not boot every VM at once. Nil means no
+	// limit.
+	createLimiter *createLimiter
+
+	// defaultSeccompProfile is applied to containers that request no
+	// seccomp profile of their own; an explicit unconfined request opts
+	// out. Empty leaves such containers without a profile.
+	defaultSeccompProfile string
+
+	// sandboxBootTimeout bounds the StartPod (VM boot) phase of sandbox
+	// creation. Non-positive falls back to the shared hyperd call timeout.
+	sandboxBootTimeout time.Duration
+
+	// bootTimes correlates container creates with their starts for the
+	// boot latency metrics. Zero value is ready to use.
+	bootTimes bootTracker
+
+	// specSnapshots keeps the redacted hyperd specs for the debug
+	// endpoint, keyed by pod and container ID. Zero value is ready
+	// to use.
+	specSnapshots specSnapshots
+
+	// annotationFilter decides which annotations are persisted into
+	// hyperd's specs; withheldAnnotations keeps the rest for the status
+	// round-trip. A nil filter passes everything.
+	annotationFilter    *annotationFilter
+	withheldAnnotations annotationStore
+
+	// reservations caches the per-container VM resource reservations for
+	// the sandbox capacity checks. Zero value is ready to use.
+	reservations reservationCache
+
+	// imageList caches hyperd's full image list for a short TTL, so
+	// kubelet's image relists do not each refetch thousands of images.
+	// Zero value is ready to use.
+	imageList imageListCache
+
+	// pullCancels holds the cancel functions of pods' in-flight
+	// pre-pulls, so deleting a pod aborts its pulls. Guarded by
+	// pullCancelsLock; lazily initialized.
+	pullCancelsLock sync.Mutex
+	pullCancels     map[string]context.CancelFunc
+
+	// enableContainerCheckpoint gates the checkpoint/restore passthrough;
+	// containerCheckpointDir is where checkpoints are kept under the
+	// frakti state dir.
+	enableContainerCheckpoint bool
+	containerCheckpointDir    string
+
+	// enableLiveMigration gates moving a sandbox's VM to another hyperd
+	// instance for maintenance drains.
+	enableLiveMigration bool
+
+	// storageFreeThresholdMB rejects sandbox and container creates when
+	// hyperd's storage filesystem has less free space than this, in MB.
+	// Zero disables the pre-flight check.
+	storageFreeThresholdMB int64
 }
 
 // NewHyperRuntime creates a new Runtime
-func NewHyperRuntime(hyperEndpoint string, streamingConfig *streaming.Config, cniNetDir, cniPluginDir, rootDir string, defaultCPUNum, defaultMemoryMB int32) (*Runtime, streaming.Server, error) {
-	hyperClient, err := NewClient(hyperEndpoint, hyperConnectionTimeout)
+func NewHyperRuntime(hyperEndpoint string, streamingConfig *streaming.Config, cniNetDir, cniPluginDir, rootDir string, defaultCPUNum, defaultMemoryMB int32, cniTimeout time.Duration, insecureRegistries, allowedRegistries, blockedRegistries []string, stopContainerGracePeriod int64, maxPods, maxContainers, maxConcurrentCreates int32, execSyncCacheTTL time.Duration, defaultDNS []string, dryRun, enableContainerCheckpoint, enableImagePrePull bool, connPoolSize int32, verifyImagePresence bool, imagePullStallTimeout time.Duration, allowedHypervisors []string, sandboxBootTimeout time.Duration, defaultSeccompProfile string, annotationAllowPrefixes, annotationDenyPrefixes []string, enableLiveMigration bool, storageFreeThresholdMB int64) (*Runtime, streaming.Server, error) {
+	hyperClient, err := NewClient(hyperEndpoint, hyperConnectionTimeout, connPoolSize, imagePullStallTimeout)
 	if err != nil {
 		glog.Fatalf("Initialize hyper client failed: %v", err)
 		return nil, nil, err
@@ -74,18 +216,75 @@ func NewHyperRuntime(hyperEndpoint string, streamingConfig *streaming.Config, cn
 		return nil, nil, err
 	}
 
+	if cniTimeout <= 0 {
+		cniTimeout = defaultCNITimeout
+	}
+	if stopContainerGracePeriod <= 0 {
+		stopContainerGracePeriod = defaultStopContainerGracePeriod
+	}
+
 	rt := &Runtime{
-		client:            hyperClient,
-		streamingServer:   streamingServer,
-		netPlugin:         netPlugin,
-		checkpointHandler: persistentCheckpointHandler,
-		defaultCPUNum:     defaultCPUNum,
-		defaultMemoryMB:   defaultMemoryMB,
+		client:                    hyperClient,
+		streamingServer:           streamingServer,
+		netPlugin:                 netPlugin,
+		checkpointHandler:         persistentCheckpointHandler,
+		defaultCPUNum:             defaultCPUNum,
+		defaultMemoryMB:           defaultMemoryMB,
+		cniTimeout:                cniTimeout,
+		insecureRegistries:        insecureRegistries,
+		allowedRegistries:         allowedRegistries,
+		blockedRegistries:         blockedRegistries,
+		allowedHypervisors:        allowedHypervisors,
+		sandboxBootTimeout:        sandboxBootTimeout,
+		defaultSeccompProfile:     defaultSeccompProfile,
+		stopContainerGracePeriod:  stopContainerGracePeriod,
+		sandboxLabels:             newLabelIndex(),
+		containerLabels:           newLabelIndex(),
+		maxPods:                   maxPods,
+		maxContainers:             maxContainers,
+		createLimiter:             newCreateLimiter(maxConcurrentCreates),
+		execCache:                 newExecResultCache(execSyncCacheTTL),
+		defaultDNS:                defaultDNS,
+		dryRun:                    dryRun,
+		enableImagePrePull:        enableImagePrePull,
+		verifyImagePresence:       verifyImagePresence,
+		pulls:                     newPullSingleFlight(),
+		enableContainerCheckpoint: enableContainerCheckpoint,
+		containerCheckpointDir:    filepath.Join(rootDir, "container-checkpoints"),
+		annotationFilter:          newAnnotationFilter(annotationAllowPrefixes, annotationDenyPrefixes),
+		enableLiveMigration:       enableLiveMigration,
+		storageFreeThresholdMB:    storageFreeThresholdMB,
+	}
+	if dryRun {
+		glog.Warningf("Sandbox dry-run mode is enabled; sandboxes will not actually be created. FOR TESTING ONLY")
+	}
+	// Check once at startup, so degraded stats do not spam the log on
+	// every kubelet summary scrape.
+	if hyperClient.apiVersionBefore("", apiVersionPodStats) {
+		glog.Warningf("hyperd at %s predates the pod stats API; container stats will carry only identity fields and timestamps", hyperEndpoint)
 	}
 
 	return rt, streamingServer, nil
 }
 
+// UpdateRegistryPolicy replaces the registry lists at runtime, so operators
+// can change the pull policy without restarting frakti. A nil list keeps
+// the current value; an empty non-nil list clears it. In-flight pulls see
+// either the old or the new policy, never a mix.
+func (h *Runtime) UpdateRegistryPolicy(insecureRegistries, allowedRegistries, blockedRegistries []string) {
+	h.registryPolicyLock.Lock()
+	defer h.registryPolicyLock.Unlock()
+	if insecureRegistries != nil {
+		h.insecureRegistries = insecureRegistries
+	}
+	if allowedRegistries != nil {
+		h.allowedRegistries = allowedRegistries
+	}
+	if blockedRegistries != nil {
+		h.blockedRegistries = blockedRegistries
+	}
+}
+
 // ServiceName method is used to log out with service's name
 func (h *Runtime) ServiceName() string {
 	return "hyper runtime service"
@@ -44,6 +44,8 @@ type PortMapping struct {
 	ContainerPort *int32 `json:"container_port,omitempty"`
 	// Port number on the host.
 	HostPort *int32 `json:"host_port,omitempty"`
+	// Host IP the host port is bound to; empty means all interfaces.
+	HostIp *string `json:"host_ip,omitempty"`
 }
 
 // ContainerInterfaceInfo contains a network interface inside the container.
@@ -58,6 +60,10 @@ type ContainerInterfaceInfo struct {
 type CheckpointData struct {
 	PortMappings []*PortMapping            `json:"port_mappings,omitempty"`
 	Interfaces   []*ContainerInterfaceInfo `json:"interfaces,omitempty"`
+	// TerminationGracePeriod is the pod's termination grace period in
+	// seconds, persisted at create time and honored when the sandbox is
+	// stopped. Zero means none was recorded.
+	TerminationGracePeriod int64 `json:"termination_grace_period,omitempty"`
 }
 
 // PodSandboxCheckpoint is the checkpoint structure for a sandbox
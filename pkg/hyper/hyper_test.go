@@ -35,10 +35,23 @@ func newTestRuntime() (*Runtime, *fakeClientInterface, *clock.FakeClock) {
 		client: publicClient,
 	}
 	return &Runtime{
-		client: client,
+		client:          client,
+		sandboxLabels:   newLabelIndex(),
+		containerLabels: newLabelIndex(),
+		pulls:           newPullSingleFlight(),
 	}, publicClient, fakeClock
 }
 
+// setFakeRunningPods registers running fake pods for the given IDs, so
+// container creation against them passes the sandbox readiness check.
+func setFakeRunningPods(fakeClient *fakeClientInterface, podIDs ...string) {
+	pods := make([]*FakePod, 0, len(podIDs))
+	for _, id := range podIDs {
+		pods = append(pods, &FakePod{PodID: id, Status: "running"})
+	}
+	fakeClient.SetFakePod(pods)
+}
+
 type fakeCNIPlugin struct {
 	sync.Mutex
 	name   string
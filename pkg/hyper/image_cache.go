@@ -0,0 +1,89 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// imageListCacheTTL is how long a fetched image list may be served from
+// cache. Kubelet lists images every few seconds for GC and stats; on a node
+// with thousands of images each fetch carries the full list through the
+// shared RPC timeout, so back-to-back callers share one fetch. Pulls and
+// removes invalidate the cache, so the TTL only bounds how stale the list
+// can get when hyperd changes behind frakti's back.
+const imageListCacheTTL = 10 * time.Second
+
+// imageListCache holds the last fetched image list. A fill that started
+// before a pull or remove is dropped via the generation counter, so the
+// cache cannot resurrect a pre-mutation list. The zero value is ready to
+// use.
+type imageListCache struct {
+	sync.Mutex
+	gen     uint64
+	images  []*types.ImageInfo
+	fetched time.Time
+}
+
+func (c *imageListCache) get() (images []*types.ImageInfo, gen uint64, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.images == nil || time.Since(c.fetched) > imageListCacheTTL {
+		return nil, c.gen, false
+	}
+	return c.images, c.gen, true
+}
+
+func (c *imageListCache) put(gen uint64, images []*types.ImageInfo) {
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.gen {
+		return
+	}
+	c.images = images
+	c.fetched = time.Now()
+}
+
+func (c *imageListCache) invalidate() {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.images = nil
+}
+
+// getImages returns hyperd's image list, served from the short-TTL cache
+// when fresh.
+func (h *Runtime) getImages() ([]*types.ImageInfo, error) {
+	cached, gen, ok := h.imageList.get()
+	if ok {
+		return cached, nil
+	}
+
+	images, err := h.client.GetImages()
+	if err != nil {
+		glog.Errorf("Get image list failed: %v", err)
+		return nil, err
+	}
+
+	h.imageList.put(gen, images)
+	return images, nil
+}
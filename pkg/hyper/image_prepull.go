@@ -0,0 +1,121 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// prePullImagesAnnotationKey holds a comma-separated list of images to
+// pre-pull when the sandbox is created, so the first CreateContainer does
+// not have to wait for the pull. Only honored when pre-pull is enabled.
+const prePullImagesAnnotationKey = "runtime.frakti.alpha.kubernetes.io/PrePullImages"
+
+// pullSingleFlight coalesces concurrent pulls of the same image reference
+// into one hyperd pull; all waiters get the same result. kubelet retries
+// and the sandbox pre-pull can otherwise race the same pull.
+type pullSingleFlight struct {
+	sync.Mutex
+	inflight map[string]*pullCall
+}
+
+type pullCall struct {
+	done    chan struct{}
+	imageID string
+	err     error
+}
+
+func newPullSingleFlight() *pullSingleFlight {
+	return &pullSingleFlight{inflight: make(map[string]*pullCall)}
+}
+
+// Do runs fn for key, unless a call for the same key is already running, in
+// which case it waits for that call and returns its result.
+func (g *pullSingleFlight) Do(key string, fn func() (string, error)) (string, error) {
+	g.Lock()
+	if call, ok := g.inflight[key]; ok {
+		g.Unlock()
+		<-call.done
+		return call.imageID, call.err
+	}
+	call := &pullCall{done: make(chan struct{})}
+	g.inflight[key] = call
+	g.Unlock()
+
+	call.imageID, call.err = fn()
+
+	g.Lock()
+	delete(g.inflight, key)
+	g.Unlock()
+	close(call.done)
+
+	return call.imageID, call.err
+}
+
+// prePullImages pulls the images named in the sandbox's pre-pull annotation,
+// honoring the pod's imagespec annotations (registry override, platform).
+// It runs in the background after the sandbox is up; failures only cost the
+// latency win, the normal CreateContainer pull path still applies. The pulls
+// are tied to the pod's lifecycle: stopping or removing the pod aborts
+// whatever is still in flight instead of pulling to completion.
+func (h *Runtime) prePullImages(podID string, config *kubeapi.PodSandboxConfig) {
+	images := splitPodOptionList(config.GetAnnotations()[prePullImagesAnnotationKey])
+	if len(images) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.pullCancelsLock.Lock()
+	if h.pullCancels == nil {
+		h.pullCancels = make(map[string]context.CancelFunc)
+	}
+	h.pullCancels[podID] = cancel
+	h.pullCancelsLock.Unlock()
+	defer func() {
+		h.pullCancelsLock.Lock()
+		delete(h.pullCancels, podID)
+		h.pullCancelsLock.Unlock()
+		cancel()
+	}()
+
+	for _, image := range images {
+		if ctx.Err() != nil {
+			glog.V(3).Infof("Pod %s is gone, skipping its remaining pre-pulls", podID)
+			return
+		}
+		if _, err := h.pullImageWithContext(ctx, &kubeapi.ImageSpec{Image: image}, config.GetAnnotations(), nil); err != nil {
+			glog.Warningf("Pre-pull image %q for sandbox %q failed: %v", image, config.GetMetadata().GetName(), err)
+		}
+	}
+}
+
+// cancelPodPulls aborts the pod's in-flight pre-pulls, if any. It is called
+// when the pod is stopped or removed, so a deleted pod does not keep
+// consuming bandwidth and registry quota.
+func (h *Runtime) cancelPodPulls(podID string) {
+	h.pullCancelsLock.Lock()
+	cancel := h.pullCancels[podID]
+	delete(h.pullCancels, podID)
+	h.pullCancelsLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestPullSingleFlight(t *testing.T) {
+	g := newPullSingleFlight()
+	var calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := g.Do("busybox:latest", func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				close(started)
+				<-release
+				return "image-id", nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "image-id", id)
+		}()
+	}
+	// Let the goroutines pile up on the same key before the first pull
+	// completes, then release it.
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// A different key runs its own pull.
+	_, err := g.Do("nginx:latest", func() (string, error) { return "", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestPrePullImages(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	config := &kubeapi.PodSandboxConfig{
+		Metadata: &kubeapi.PodSandboxMetadata{Name: "foo"},
+		Annotations: map[string]string{
+			prePullImagesAnnotationKey: "test/foo:54321, test/bar:11111",
+		},
+	}
+
+	r.prePullImages("podid", config)
+	pulls := 0
+	for _, call := range fakeClient.called {
+		if call == "ImagePull" {
+			pulls++
+		}
+	}
+	assert.Equal(t, 2, pulls)
+
+	// Without the annotation nothing is pulled.
+	fakeClient.called = nil
+	r.prePullImages("podid", &kubeapi.PodSandboxConfig{Metadata: &kubeapi.PodSandboxMetadata{Name: "bar"}})
+	assert.NotContains(t, fakeClient.called, "ImagePull")
+}
+
+func TestPrePullImagesHonorPullOptions(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+
+	// The pod's registry override redirects its pre-pulls.
+	config := &kubeapi.PodSandboxConfig{
+		Metadata: &kubeapi.PodSandboxMetadata{Name: "foo"},
+		Annotations: map[string]string{
+			prePullImagesAnnotationKey: "localhost:5000/test/foo:54321",
+			imageSpecRegistry:          "mirror.example.com:5000",
+		},
+	}
+	r.prePullImages("podid", config)
+	pulled := []string{}
+	for _, image := range fakeClient.imageInfoList {
+		pulled = append(pulled, image.RepoTags...)
+	}
+	assert.Contains(t, pulled, "mirror.example.com:5000/test/foo:54321")
+
+	// A malformed override fails the pre-pull instead of silently pulling
+	// from the wrong place.
+	fakeClient.called = nil
+	config.Annotations[imageSpecRegistry] = "host/with/path"
+	r.prePullImages("podid", config)
+	assert.NotContains(t, fakeClient.called, "ImagePull")
+}
@@ -18,17 +18,19 @@ package hyper
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
-// ListImages lists existing images.
+// ListImages lists existing images, served from the short-TTL image list
+// cache when fresh.
 func (h *Runtime) ListImages(filter *kubeapi.ImageFilter) ([]*kubeapi.Image, error) {
-	images, err := h.client.GetImages()
+	images, err := h.getImages()
 	if err != nil {
-		glog.Errorf("Get image list failed: %v", err)
 		return nil, err
 	}
 
@@ -36,12 +38,10 @@ func (h *Runtime) ListImages(filter *kubeapi.ImageFilter) ([]*kubeapi.Image, err
 	for _, img := range images {
 		if filter != nil && filter.GetImage() != nil && filter.GetImage().Image != "" {
 			filter := filter.GetImage().Image
-			// Use 'latest' tag if not specified explicitly
-			if !strings.Contains(filter, ":") {
-				filter = filter + ":latest"
-			}
-
-			if !inList(filter, img.RepoTags) && !inList(filter, img.RepoDigests) {
+			// Compare canonicalized references, so bare names like
+			// "nginx" match "docker.io/library/nginx:latest" and
+			// vice versa.
+			if !inRefList(filter, img.RepoTags) && !inRefList(filter, img.RepoDigests) {
 				continue
 			}
 		}
@@ -50,7 +50,7 @@ func (h *Runtime) ListImages(filter *kubeapi.ImageFilter) ([]*kubeapi.Image, err
 		results = append(results, &kubeapi.Image{
 			Id:          img.Id,
 			RepoTags:    img.RepoTags,
-			RepoDigests: img.RepoDigests,
+			RepoDigests: h.mergeResolvedDigests(img.RepoTags, img.RepoDigests),
 			Size_:       imageSize,
 		})
 	}
@@ -59,15 +59,67 @@ func (h *Runtime) ListImages(filter *kubeapi.ImageFilter) ([]*kubeapi.Image, err
 	return results, nil
 }
 
-// PullImage pulls the image with authentication config.
+// PullImage pulls the image with authentication config. Concurrent pulls of
+// the same reference share one hyperd pull.
 func (h *Runtime) PullImage(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthConfig) (string, error) {
+	// The v1alpha1 PullImage request carries no annotations, so
+	// kubelet-initiated pulls have no pull options to parse.
+	return h.pullImageWithContext(context.Background(), image, nil, authConfig)
+}
+
+// pullImageWithContext is PullImage with a caller-supplied context and
+// annotations, so internal callers like the sandbox pre-pull can tie the
+// pull to a pod's lifecycle and pass the pod's pull-tuning annotations
+// along. Note that cancellation aborts the underlying hyperd pull for
+// every caller coalesced onto it; kubelet simply retries in that case.
+func (h *Runtime) pullImageWithContext(ctx context.Context, image *kubeapi.ImageSpec, annotations map[string]string, authConfig *kubeapi.AuthConfig) (string, error) {
+	opts, err := parsePullOptions(annotations)
+	if err != nil {
+		glog.Errorf("Pull image %q rejected: %v", image.Image, err)
+		return "", err
+	}
+
 	repo, tag := parseRepositoryTag(image.Image)
+	// Apply the registry override before coalescing, so pulls of the same
+	// reference from different registries do not share a result.
+	repo = opts.applyRegistry(repo)
+	return h.pulls.Do(repo+":"+tag, func() (string, error) {
+		return h.pullImage(ctx, repo, tag, image, opts, authConfig)
+	})
+}
+
+func (h *Runtime) pullImage(ctx context.Context, repo, tag string, image *kubeapi.ImageSpec, opts pullOptions, authConfig *kubeapi.AuthConfig) (string, error) {
+	if err := h.checkRegistryPolicy(parseRegistryHost(repo)); err != nil {
+		glog.Errorf("Pull image %q rejected: %v", image.Image, err)
+		return "", err
+	}
+
+	// Remember whether hyperd already has the image: the first container
+	// created from a freshly pulled image counts as a cold start in the
+	// boot latency metrics.
+	if _, err := h.client.GetImageInfo(repo, tag); IsImageNotFound(err) {
+		h.bootTimes.markColdImage(repo + ":" + tag)
+	}
+
 	auth := getHyperAuthConfig(authConfig)
-	err := h.client.PullImage(repo, tag, auth, nil)
+	if registry := parseRegistryHost(repo); h.isInsecureRegistry(registry) {
+		// hyperd has no dedicated insecure-registry option, hint the
+		// plaintext endpoint through the auth server address instead.
+		if auth.Serveraddress == "" {
+			auth.Serveraddress = "http://" + registry
+		}
+		glog.V(3).Infof("Allowing insecure pull from registry %q for image %q", registry, image.Image)
+	}
+	digest, err := h.client.PullImage(ctx, repo, tag, opts.platform, auth, nil)
 	if err != nil {
 		glog.Errorf("Pull image %q failed: %v", image.Image, err)
 		return "", err
 	}
+	// The list changed under the cache; kubelet must see the new image.
+	h.imageList.invalidate()
+	if digest != "" {
+		h.recordResolvedDigest(repo, digest)
+	}
 
 	imageInfo, err := h.client.GetImageInfo(repo, tag)
 	if err != nil {
@@ -78,39 +130,152 @@ func (h *Runtime) PullImage(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthCo
 	return imageInfo.Id, nil
 }
 
-// RemoveImage removes the image.
+// recordResolvedDigest remembers the manifest digest the last pull of repo
+// resolved to.
+func (h *Runtime) recordResolvedDigest(repo, digest string) {
+	h.imageDigestsLock.Lock()
+	defer h.imageDigestsLock.Unlock()
+	if h.imageDigests == nil {
+		h.imageDigests = make(map[string]string)
+	}
+	h.imageDigests[repo] = digest
+}
+
+// mergeResolvedDigests fills in RepoDigests from the recorded pull digests
+// when hyperd reports none for an image, so kubelet can pin images by digest
+// even though hyperd only tracks tags.
+func (h *Runtime) mergeResolvedDigests(repoTags, repoDigests []string) []string {
+	if len(repoDigests) > 0 {
+		return repoDigests
+	}
+
+	h.imageDigestsLock.Lock()
+	defer h.imageDigestsLock.Unlock()
+	seen := make(map[string]bool)
+	for _, repoTag := range repoTags {
+		repo, _ := parseRepositoryTag(repoTag)
+		digest := h.imageDigests[repo]
+		if digest == "" || seen[repo] {
+			continue
+		}
+		seen[repo] = true
+		repoDigests = append(repoDigests, repo+"@"+digest)
+	}
+	return repoDigests
+}
+
+// getInUseImages returns the set of image references backing existing
+// containers, keyed by both the image name (with an explicit tag) and the
+// image ID. It is used by kubelet's image GC to skip in-use images.
+func (h *Runtime) getInUseImages() (map[string]bool, error) {
+	containerList, err := h.client.GetContainerList()
+	if err != nil {
+		glog.Errorf("Get container list failed: %v", err)
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, c := range containerList {
+		info, err := h.client.GetContainerInfo(c.ContainerID)
+		if err != nil {
+			glog.Errorf("Get container info for %s failed: %v", c.ContainerID, err)
+			return nil, err
+		}
+
+		if image := info.Container.Image; image != "" {
+			// Use 'latest' tag if not specified explicitly
+			if !strings.Contains(image, ":") {
+				image = image + ":latest"
+			}
+			inUse[image] = true
+		}
+		if info.Container.ImageID != "" {
+			inUse[info.Container.ImageID] = true
+		}
+	}
+
+	return inUse, nil
+}
+
+// RemoveImage removes the image. It refuses to remove an image which still
+// backs a container.
 func (h *Runtime) RemoveImage(image *kubeapi.ImageSpec) error {
 	repo, tag := parseRepositoryTag(image.Image)
-	err := h.client.RemoveImage(repo, tag)
+
+	inUse, err := h.getInUseImages()
+	if err != nil {
+		glog.Errorf("Get in-use images failed: %v", err)
+		return err
+	}
+	for ref := range inUse {
+		if sameImageRef(ref, image.Image) {
+			err := fmt.Errorf("image %q is in use by at least one container", image.Image)
+			glog.Errorf("Remove image failed: %v", err)
+			return err
+		}
+	}
+
+	err = h.client.RemoveImage(repo, tag)
 	if err != nil {
 		glog.Errorf("Remove image %q failed: %v", image.Image, err)
 		return err
 	}
+	h.imageList.invalidate()
 
 	return nil
 }
 
-// ImageStatus returns the status of the image.
+// ImageStatus returns the status of the image. hyperd can only look an
+// image up by listing them all, so the lookup runs against the cached list;
+// pulls and removes invalidate it, making absence from the list
+// authoritative.
 func (h *Runtime) ImageStatus(image *kubeapi.ImageSpec) (*kubeapi.Image, error) {
 	repo, tag := parseRepositoryTag(image.Image)
-	imageInfo, err := h.client.GetImageInfo(repo, tag)
+	images, err := h.getImages()
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return nil, nil
-		}
 		glog.Errorf("Get image info for %q failed: %v", image.Image, err)
 		return nil, err
 	}
+	imageInfo := findImageInfo(images, repo, tag)
+	if imageInfo == nil {
+		return nil, nil
+	}
 
 	imageSize := uint64(imageInfo.VirtualSize)
+	uid, username := parseImageUser(imageInfo.Labels[imageUserLabelKey])
 	return &kubeapi.Image{
 		Id:          imageInfo.Id,
 		RepoTags:    imageInfo.RepoTags,
-		RepoDigests: imageInfo.RepoDigests,
+		RepoDigests: h.mergeResolvedDigests(imageInfo.RepoTags, imageInfo.RepoDigests),
 		Size_:       imageSize,
+		Uid:         uid,
+		Username:    username,
 	}, nil
 }
 
+// imageUserLabelKey is the image label under which hyperd records the
+// image config's User. Older hyperds do not set it; the image status then
+// reports neither a UID nor a username and kubelet's runAsNonRoot check
+// falls back to inspecting the running container.
+const imageUserLabelKey = "io.hyper.image.user"
+
+// parseImageUser splits an image config User value into the CRI Uid and
+// Username fields: a numeric user is a UID, anything else a username. A
+// ":group" suffix is dropped, matching how container runtimes interpret
+// the field.
+func parseImageUser(user string) (*kubeapi.Int64Value, string) {
+	if idx := strings.Index(user, ":"); idx >= 0 {
+		user = user[:idx]
+	}
+	if user == "" {
+		return nil, ""
+	}
+	if uid, err := strconv.ParseInt(user, 10, 64); err == nil {
+		return &kubeapi.Int64Value{Value: uid}, ""
+	}
+	return nil, user
+}
+
 // ImageFsInfo returns information of the filesystem that is used to store images.
 func (h *Runtime) ImageFsInfo() ([]*kubeapi.FilesystemUsage, error) {
 	return nil, fmt.Errorf("not implemented")
@@ -17,11 +17,15 @@ limitations under the License.
 package hyper
 
 import (
+	goruntime "runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 
+	"k8s.io/frakti/pkg/hyper/types"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
@@ -83,6 +87,49 @@ func TestListImage(t *testing.T) {
 
 }
 
+func TestRemoveImageInUse(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	imageFullName := []string{
+		"localhost:5000/foo/bar@sha256:12345",
+		"test/foo:54321",
+	}
+	for i := range imageFullName {
+		imageSpec := &kubeapi.ImageSpec{
+			Image: imageFullName[i],
+		}
+		_, err := r.PullImage(imageSpec, nil)
+		assert.NoError(t, err)
+	}
+
+	//Create a container backed by the second image
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "test/foo:54321", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	inUse, err := r.getInUseImages()
+	assert.NoError(t, err)
+	assert.True(t, inUse["test/foo:54321"])
+
+	//Removing the in-use image must fail and keep it in the list
+	err = r.RemoveImage(&kubeapi.ImageSpec{Image: "test/foo:54321"})
+	assert.Error(t, err)
+	assert.Len(t, fakeClient.imageInfoList, len(imageFullName))
+
+	//An unused image can still be removed
+	err = r.RemoveImage(&kubeapi.ImageSpec{Image: "localhost:5000/foo/bar@sha256:12345"})
+	assert.NoError(t, err)
+	assert.Len(t, fakeClient.imageInfoList, len(imageFullName)-1)
+
+	//Once the container is gone the image can be removed
+	err = r.RemoveContainer(containerID)
+	assert.NoError(t, err)
+	err = r.RemoveImage(&kubeapi.ImageSpec{Image: "test/foo:54321"})
+	assert.NoError(t, err)
+	assert.Len(t, fakeClient.imageInfoList, 0)
+}
+
 func TestImageStatus(t *testing.T) {
 	r, _, _ := newTestRuntime()
 	imageFullName := []string{
@@ -114,3 +161,285 @@ func TestImageStatus(t *testing.T) {
 		assert.Equal(t, image, expected)
 	}
 }
+
+func TestImageStatusReportsUser(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	_, err := r.PullImage(&kubeapi.ImageSpec{Image: "test/numeric:v1"}, nil)
+	assert.NoError(t, err)
+	_, err = r.PullImage(&kubeapi.ImageSpec{Image: "test/named:v1"}, nil)
+	assert.NoError(t, err)
+
+	// hyperd records the image config's User in the image labels; a
+	// numeric value maps to Uid, anything else to Username.
+	fakeClient.Lock()
+	fakeClient.imageInfoList[0].Labels = map[string]string{imageUserLabelKey: "1000"}
+	fakeClient.imageInfoList[1].Labels = map[string]string{imageUserLabelKey: "nginx:nginx"}
+	fakeClient.Unlock()
+
+	image, err := r.ImageStatus(&kubeapi.ImageSpec{Image: "test/numeric:v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), image.GetUid().GetValue())
+	assert.Empty(t, image.Username)
+
+	image, err = r.ImageStatus(&kubeapi.ImageSpec{Image: "test/named:v1"})
+	assert.NoError(t, err)
+	assert.Nil(t, image.Uid)
+	assert.Equal(t, "nginx", image.Username)
+
+	// Images from hyperds that do not record the user report neither.
+	uid, username := parseImageUser("")
+	assert.Nil(t, uid)
+	assert.Empty(t, username)
+}
+
+func TestPullImageRecordsRepoDigest(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	digest := "sha256:ebf9588dcdb1e5351af624d83e2b82f5e8db64644dee5f66b17ba567b0c454dc"
+	fakeClient.pullData = [][]byte{
+		[]byte("Digest: " + digest + "\n"),
+	}
+
+	imageSpec := &kubeapi.ImageSpec{
+		Image: "test/foo:54321",
+	}
+	_, err := r.PullImage(imageSpec, nil)
+	assert.NoError(t, err)
+
+	// The digest the tag pull resolved to shows up in both the image
+	// list and the image status.
+	images, err := r.ListImages(nil)
+	assert.NoError(t, err)
+	assert.Len(t, images, 1)
+	assert.Equal(t, []string{"test/foo@" + digest}, images[0].RepoDigests)
+
+	image, err := r.ImageStatus(imageSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test/foo@" + digest}, image.RepoDigests)
+}
+
+func TestPullImageCancellation(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.pullHold = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		_, err := r.pullImageWithContext(ctx, &kubeapi.ImageSpec{Image: "test/foo:54321"}, nil, nil)
+		errC <- err
+	}()
+
+	// Cancelling mid-pull aborts the pull instead of letting it run to
+	// completion.
+	cancel()
+	select {
+	case err := <-errC:
+		assert.Error(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("pull did not abort after cancellation")
+	}
+
+	// A cancelled pull records no resolved digest.
+	r.imageDigestsLock.Lock()
+	assert.Len(t, r.imageDigests, 0)
+	r.imageDigestsLock.Unlock()
+}
+
+func TestPullImageStallDetector(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	// Stream one progress frame, then go silent without sending EOF.
+	fakeClient.pullData = [][]byte{
+		[]byte("Pulling fs layer\n"),
+	}
+	fakeClient.pullHold = make(chan struct{})
+	r.client.pullStallTimeout = 100 * time.Millisecond
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := r.PullImage(&kubeapi.ImageSpec{Image: "test/foo:54321"}, nil)
+		errC <- err
+	}()
+
+	// The pull fails once the idle window elapses, long before any
+	// overall timeout would fire.
+	select {
+	case err := <-errC:
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no progress")
+	case <-time.After(10 * time.Second):
+		t.Fatal("pull did not abort after the stream went silent")
+	}
+}
+
+func TestPrePullCancelledWhenPodRemoved(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.pullHold = make(chan struct{})
+
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{prePullImagesAnnotationKey: "test/foo:54321"},
+	)
+	done := make(chan struct{})
+	go func() {
+		r.prePullImages("podid", config)
+		close(done)
+	}()
+
+	// Wait until the pre-pull has registered its cancel function.
+	for i := 0; i < 100; i++ {
+		r.pullCancelsLock.Lock()
+		registered := r.pullCancels["podid"] != nil
+		r.pullCancelsLock.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r.cancelPodPulls("podid")
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("pre-pull did not abort after the pod was removed")
+	}
+}
+
+func TestListImageFilterCanonicalNames(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	_, err := r.PullImage(&kubeapi.ImageSpec{Image: "nginx"}, nil)
+	assert.NoError(t, err)
+
+	// The fully-qualified spelling matches the bare name hyperd stores.
+	images, err := r.ListImages(&kubeapi.ImageFilter{
+		Image: &kubeapi.ImageSpec{Image: "docker.io/library/nginx"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, images, 1)
+
+	images, err = r.ListImages(&kubeapi.ImageFilter{
+		Image: &kubeapi.ImageSpec{Image: "nginx:other"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, images, 0)
+}
+
+func TestParsePullOptions(t *testing.T) {
+	opts, err := parsePullOptions(map[string]string{
+		imageSpecRegistry:                     "mirror.example.com:5000",
+		imageSpecPlatform:                     "linux/amd64",
+		imageSpecAnnotationPrefix + "Unknown": "ignored",
+		"irrelevant.example.com/key":          "ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "mirror.example.com:5000", opts.registry)
+	assert.Equal(t, "linux/amd64", opts.platform)
+
+	// The registry override rewrites an explicit registry host and
+	// prefixes bare references.
+	assert.Equal(t, "mirror.example.com:5000/foo/bar", opts.applyRegistry("localhost:5000/foo/bar"))
+	assert.Equal(t, "mirror.example.com:5000/library/nginx", opts.applyRegistry("library/nginx"))
+
+	// Empty or malformed values are rejected.
+	_, err = parsePullOptions(map[string]string{imageSpecRegistry: ""})
+	assert.Error(t, err)
+	_, err = parsePullOptions(map[string]string{imageSpecRegistry: "host/with/path"})
+	assert.Error(t, err)
+	_, err = parsePullOptions(map[string]string{imageSpecPlatform: "amd64"})
+	assert.Error(t, err)
+
+	// No annotations derive the zero options, which change nothing.
+	opts, err = parsePullOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, pullOptions{}, opts)
+	assert.Equal(t, "test/foo", opts.applyRegistry("test/foo"))
+}
+
+func TestPullImagePlatformSelection(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	ctx := context.Background()
+
+	// An empty platform defaults to the node's own and the pull is sent.
+	_, err := r.client.PullImage(ctx, "test/foo", "1", "", nil, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, fakeClient.called, "ImagePull")
+
+	// The node platform spelled out, with or without a variant suffix,
+	// is accepted too.
+	node := goruntime.GOOS + "/" + goruntime.GOARCH
+	_, err = r.client.PullImage(ctx, "test/foo", "2", node, nil, nil)
+	assert.NoError(t, err)
+	_, err = r.client.PullImage(ctx, "test/foo", "3", node+"/v8", nil, nil)
+	assert.NoError(t, err)
+
+	// An incompatible platform is rejected before anything reaches hyperd.
+	fakeClient.Lock()
+	fakeClient.called = nil
+	fakeClient.Unlock()
+	_, err = r.client.PullImage(ctx, "test/foo", "4", "windows/arm64", nil, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "windows/arm64")
+	assert.NotContains(t, fakeClient.called, "ImagePull")
+}
+
+func TestImageListCacheInvalidation(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	_, err := r.PullImage(&kubeapi.ImageSpec{Image: "test/foo:54321"}, nil)
+	assert.NoError(t, err)
+
+	imageListCalls := func() int {
+		fakeClient.Lock()
+		defer fakeClient.Unlock()
+		count := 0
+		for _, call := range fakeClient.called {
+			if call == "ImageList" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Back-to-back lists and statuses within the TTL share one fetch.
+	fakeClient.CleanCalls()
+	_, err = r.ListImages(nil)
+	assert.NoError(t, err)
+	_, err = r.ListImages(nil)
+	assert.NoError(t, err)
+	image, err := r.ImageStatus(&kubeapi.ImageSpec{Image: "test/foo:54321"})
+	assert.NoError(t, err)
+	assert.NotNil(t, image)
+	assert.Equal(t, 1, imageListCalls())
+
+	// Removing an image invalidates the cache, so the next list sees the
+	// change instead of the cached pre-remove list.
+	err = r.RemoveImage(&kubeapi.ImageSpec{Image: "test/foo:54321"})
+	assert.NoError(t, err)
+	images, err := r.ListImages(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, images)
+	assert.Equal(t, 2, imageListCalls())
+
+	// A removed image's status reports absence, not the cached entry.
+	image, err = r.ImageStatus(&kubeapi.ImageSpec{Image: "test/foo:54321"})
+	assert.NoError(t, err)
+	assert.Nil(t, image)
+}
+
+func TestImageListCacheStaleFill(t *testing.T) {
+	c := imageListCache{}
+	images := []*types.ImageInfo{{Id: "i1"}}
+
+	// A fill that started before an invalidation is dropped, so the cache
+	// cannot resurrect a pre-mutation list.
+	_, gen, ok := c.get()
+	assert.False(t, ok)
+	c.invalidate()
+	c.put(gen, images)
+	_, _, ok = c.get()
+	assert.False(t, ok)
+
+	// An undisturbed fill is stored and served.
+	_, gen, _ = c.get()
+	c.put(gen, images)
+	cached, _, ok := c.get()
+	assert.True(t, ok)
+	assert.Equal(t, images, cached)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import "sync"
+
+// labelIndex is an in-memory index from sandbox/container ID to its kubelet
+// labels, maintained on create and remove. It lets label selector filters be
+// answered without a per-candidate round trip to hyperd. Entries only exist
+// for items created by this process, so a missing entry means "unknown"
+// (e.g. right after a frakti restart) and callers must fall back to the
+// full scan for it.
+type labelIndex struct {
+	sync.RWMutex
+	labels map[string]map[string]string
+}
+
+func newLabelIndex() *labelIndex {
+	return &labelIndex{
+		labels: make(map[string]map[string]string),
+	}
+}
+
+// Add indexes the kubelet labels of id, replacing any previous entry.
+func (i *labelIndex) Add(id string, labels map[string]string) {
+	if i == nil {
+		return
+	}
+
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	i.Lock()
+	defer i.Unlock()
+	i.labels[id] = copied
+}
+
+// Remove drops the entry of id, if any.
+func (i *labelIndex) Remove(id string) {
+	if i == nil {
+		return
+	}
+
+	i.Lock()
+	defer i.Unlock()
+	delete(i.labels, id)
+}
+
+// Matches reports whether the labels of id satisfy selector. known is false
+// when id is not indexed, in which case match is meaningless and the caller
+// must decide by scanning.
+func (i *labelIndex) Matches(id string, selector map[string]string) (match bool, known bool) {
+	if i == nil {
+		return false, false
+	}
+
+	i.RLock()
+	defer i.RUnlock()
+	labels, ok := i.labels[id]
+	if !ok {
+		return false, false
+	}
+
+	return inMap(selector, labels), true
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestLabelIndex(t *testing.T) {
+	index := newLabelIndex()
+	index.Add("c1", map[string]string{"app": "web", "tier": "frontend"})
+
+	// A subset selector matches.
+	match, known := index.Matches("c1", map[string]string{"app": "web"})
+	assert.True(t, known)
+	assert.True(t, match)
+
+	// A mismatching selector does not.
+	match, known = index.Matches("c1", map[string]string{"app": "db"})
+	assert.True(t, known)
+	assert.False(t, match)
+
+	// Unknown IDs are reported as such so callers can fall back to a scan.
+	_, known = index.Matches("c2", map[string]string{"app": "web"})
+	assert.False(t, known)
+
+	// Removed entries become unknown again.
+	index.Remove("c1")
+	_, known = index.Matches("c1", map[string]string{"app": "web"})
+	assert.False(t, known)
+
+	// A nil index behaves like a cold one instead of panicking.
+	var nilIndex *labelIndex
+	nilIndex.Add("c1", map[string]string{"app": "web"})
+	nilIndex.Remove("c1")
+	_, known = nilIndex.Matches("c1", map[string]string{"app": "web"})
+	assert.False(t, known)
+}
+
+func TestListContainersByLabelUsesIndex(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	for i := 0; i < 3; i++ {
+		setFakeRunningPods(fakeClient, fmt.Sprintf("sandboxid%d", i))
+		sConfig := makeSandboxConfig(fmt.Sprintf("foo%d", i), "bar", fmt.Sprintf("%d", i), 0)
+		labels := map[string]string{"app": fmt.Sprintf("app%d", i)}
+		config := makeContainerConfig(sConfig, fmt.Sprintf("sidecar%d", i), "logger:v1", 0, labels, map[string]string{}, nil)
+		_, err := r.CreateContainer(fmt.Sprintf("sandboxid%d", i), config, sConfig)
+		assert.NoError(t, err)
+	}
+
+	filter := &kubeapi.ContainerFilter{
+		LabelSelector: map[string]string{"app": "app1"},
+	}
+	containers, err := r.ListContainers(filter)
+	assert.NoError(t, err)
+	assert.Len(t, containers, 1)
+	assert.Equal(t, "app1", containers[0].Labels["app"])
+}
+
+func BenchmarkListContainersByLabel(b *testing.B) {
+	r, fakeClient, _ := newTestRuntime()
+	// Populate the node with 500 containers, only one matching the selector.
+	for i := 0; i < 500; i++ {
+		setFakeRunningPods(fakeClient, fmt.Sprintf("sandboxid%d", i))
+		sConfig := makeSandboxConfig(fmt.Sprintf("foo%d", i), "bar", fmt.Sprintf("%d", i), 0)
+		labels := map[string]string{"app": fmt.Sprintf("app%d", i)}
+		config := makeContainerConfig(sConfig, fmt.Sprintf("sidecar%d", i), "logger:v1", 0, labels, map[string]string{}, nil)
+		if _, err := r.CreateContainer(fmt.Sprintf("sandboxid%d", i), config, sConfig); err != nil {
+			b.Fatal(err)
+		}
+	}
+	fakeClient.CleanCalls()
+
+	filter := &kubeapi.ContainerFilter{
+		LabelSelector: map[string]string{"app": "app250"},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ListContainers(filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	// hyperdRequestLatency records per-method latency of hyperd gRPC
+	// calls, so slowness can be attributed to hyperd rather than frakti.
+	hyperdRequestLatency = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name: "frakti_hyperd_request_duration_seconds",
+			Help: "Latency of hyperd gRPC requests, by method.",
+		},
+		[]string{"method"},
+	)
+	// hyperdRequestErrors counts failed hyperd gRPC calls by method.
+	hyperdRequestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "frakti_hyperd_request_errors_total",
+			Help: "Number of failed hyperd gRPC requests, by method.",
+		},
+		[]string{"method"},
+	)
+	// stateDrift reports the drift the reconciler found between frakti's
+	// persisted state and hyperd, by kind of orphan.
+	stateDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "frakti_hyperd_state_drift",
+			Help: "Objects found on only one side of the frakti/hyperd state comparison, by kind.",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(hyperdRequestLatency)
+	prometheus.MustRegister(hyperdRequestErrors)
+	prometheus.MustRegister(stateDrift)
+}
+
+// hyperdMetricsInterceptor instruments every unary hyperd call with latency
+// and error metrics. Installing it as a gRPC client interceptor keeps the
+// Client methods themselves free of metrics plumbing.
+func hyperdMetricsInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	hyperdRequestLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		hyperdRequestErrors.WithLabelValues(method).Inc()
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// containerStartSampleCount reads the sample count of the container start
+// latency histogram for the given start kind.
+func containerStartSampleCount(t *testing.T, kind string) uint64 {
+	m, err := containerStartLatency.GetMetricWithLabelValues(kind)
+	assert.NoError(t, err)
+	metric := &dto.Metric{}
+	assert.NoError(t, m.(prometheus.Metric).Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestContainerStartLatencyMetrics(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// The metrics are process-global, so compare against the counts other
+	// tests may already have contributed.
+	coldBefore := containerStartSampleCount(t, startKindCold)
+	warmBefore := containerStartSampleCount(t, startKindWarm)
+
+	// Pull an image hyperd does not have yet; its first consumer below is
+	// a cold start.
+	_, err := r.PullImage(&kubeapi.ImageSpec{Image: "test/foo:54321"}, nil)
+	assert.NoError(t, err)
+
+	config := makeContainerConfig(sConfig, "first", "test/foo:54321", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, r.StartContainer(containerID))
+	assert.Equal(t, coldBefore+1, containerStartSampleCount(t, startKindCold))
+	assert.Equal(t, warmBefore, containerStartSampleCount(t, startKindWarm))
+
+	// A second container from the now-cached image starts warm.
+	config = makeContainerConfig(sConfig, "second", "test/foo:54321", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, r.StartContainer(containerID))
+	assert.Equal(t, coldBefore+1, containerStartSampleCount(t, startKindCold))
+	assert.Equal(t, warmBefore+1, containerStartSampleCount(t, startKindWarm))
+}
+
+func TestHyperdMetricsInterceptor(t *testing.T) {
+	method := "/types.PublicAPI/PodList"
+	invoked := false
+	err := hyperdMetricsInterceptor(context.Background(), method, nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			invoked = true
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.True(t, invoked)
+
+	// Errors are propagated unchanged and counted.
+	expected := fmt.Errorf("hyperd is down")
+	err = hyperdMetricsInterceptor(context.Background(), method, nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return expected
+		})
+	assert.Equal(t, expected, err)
+
+	metric := &dto.Metric{}
+	err = hyperdRequestErrors.WithLabelValues(method).Write(metric)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), metric.GetCounter().GetValue())
+
+	// Both calls observed their latency.
+	summary, err := hyperdRequestLatency.GetMetricWithLabelValues(method)
+	assert.NoError(t, err)
+	metric = &dto.Metric{}
+	err = summary.(prometheus.Metric).Write(metric)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), metric.GetSummary().GetSampleCount())
+}
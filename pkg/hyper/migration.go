@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// apiVersionLiveMigration is the first hyperd API version expected to expose
+// live migration of a pod's VM to another daemon. No released hyperd
+// implements it yet, so the coordination below mostly reports a clear
+// "unsupported" error; once hyperd gains the RPC, only the client call here
+// needs filling in.
+const apiVersionLiveMigration = "0.3.0"
+
+// MigratePodSandbox live-migrates the sandbox's VM to the hyperd instance at
+// targetEndpoint, for maintenance drains where the pod must keep running.
+// The capability is feature gated and requires hyperd support on both sides;
+// without either, a clear error is returned instead of a silent no-op. CRI
+// has no corresponding RPC, so this is only reachable through out-of-band
+// tooling for now.
+func (h *Runtime) MigratePodSandbox(podSandboxID, targetEndpoint string) error {
+	if !h.enableLiveMigration {
+		return fmt.Errorf("live migration is disabled, enable it with --enable-live-migration")
+	}
+	if _, _, err := net.SplitHostPort(targetEndpoint); err != nil {
+		return fmt.Errorf("invalid target hyperd endpoint %q for migrating sandbox %s: %v", targetEndpoint, podSandboxID, err)
+	}
+
+	// Only a running VM can be migrated; anything else is caught here
+	// before the daemons are asked to move anything.
+	info, err := h.client.GetPodInfo(podSandboxID)
+	if err != nil {
+		glog.Errorf("GetPodInfo for migrating sandbox %s failed: %v", podSandboxID, err)
+		return err
+	}
+	if info.Status == nil || toPodSandboxState(info.Status.Phase) != kubeapi.PodSandboxState_SANDBOX_READY {
+		return fmt.Errorf("sandbox %s is not running and cannot be live-migrated", podSandboxID)
+	}
+
+	if err := h.client.MigratePod(podSandboxID, targetEndpoint); err != nil {
+		glog.Errorf("Migrate sandbox %s to %s failed: %v", podSandboxID, targetEndpoint, err)
+		return err
+	}
+
+	// The VM now runs behind the target hyperd and the source side has
+	// released it. Drop the local bookkeeping so relists stop reporting
+	// the sandbox here; the checkpoint goes last since it anchors the
+	// netns path until hyperd has torn the source network down.
+	if err := h.checkpointHandler.RemoveCheckpoint(podSandboxID); err != nil {
+		glog.Warningf("Remove checkpoint of migrated sandbox %s failed: %v", podSandboxID, err)
+	}
+	h.sandboxLabels.Remove(podSandboxID)
+	h.specSnapshots.forget(podSandboxID)
+	h.withheldAnnotations.forget(podSandboxID)
+	return nil
+}
+
+// MigratePod asks hyperd to live-migrate the pod's VM to the daemon at
+// targetEndpoint. hyperd's public API does not expose migration below
+// apiVersionLiveMigration, in which case an unsupported error is returned.
+// The version handshake with the target daemon also belongs here once the
+// RPC exists, so the source can refuse a target that cannot receive the VM.
+func (c *Client) MigratePod(podID, targetEndpoint string) error {
+	if c.apiVersionBefore("", apiVersionLiveMigration) {
+		return fmt.Errorf("live migration is not supported by hyperd API version %q", c.detectAPIVersion())
+	}
+
+	// The generated hyperd bindings do not carry the migration RPC yet;
+	// report that clearly rather than pretending the call happened.
+	return fmt.Errorf("live migration requires hyperd API %s or newer bindings, which this build does not include", apiVersionLiveMigration)
+}
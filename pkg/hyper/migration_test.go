@@ -0,0 +1,53 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigratePodSandbox(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.SetVersion("1.0.0", "0.1.0")
+	setFakeRunningPods(fakeClient, "sandboxid")
+
+	// Disabled by default.
+	err := r.MigratePodSandbox("sandboxid", "10.0.0.2:22318")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "disabled")
+
+	// The target endpoint must be a host:port address.
+	r.enableLiveMigration = true
+	err = r.MigratePodSandbox("sandboxid", "not an endpoint")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid target hyperd endpoint")
+
+	// Only a running sandbox can be migrated.
+	fakeClient.podInfoMap["sandboxid"].Status.Phase = "failed"
+	err = r.MigratePodSandbox("sandboxid", "10.0.0.2:22318")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not running")
+
+	// Enabled with a running sandbox, but the connected hyperd is too
+	// old to support migration.
+	fakeClient.podInfoMap["sandboxid"].Status.Phase = "running"
+	err = r.MigratePodSandbox("sandboxid", "10.0.0.2:22318")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not supported by hyperd API version")
+}
@@ -27,6 +27,10 @@ import (
 	"github.com/containernetworking/cni/pkg/ns"
 	"github.com/golang/glog"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
 const (
@@ -42,6 +46,58 @@ type cniPortMapping struct {
 	HostIP        string `json:"hostIP"`
 }
 
+// buildCNIPortMappings converts the sandbox config's port mappings into the
+// CNI portmapping capability. A mapping's HostIp binds the host port to that
+// address only; empty means all interfaces. An unparsable HostIp fails the
+// sandbox instead of silently binding everywhere.
+func buildCNIPortMappings(config *kubeapi.PodSandboxConfig) ([]cniPortMapping, error) {
+	portMappings := config.GetPortMappings()
+	result := make([]cniPortMapping, 0, len(portMappings))
+	for _, p := range portMappings {
+		if p.HostPort == 0 {
+			continue
+		}
+		if p.HostIp != "" && net.ParseIP(p.HostIp) == nil {
+			return nil, fmt.Errorf("invalid host IP %q in port mapping for host port %d", p.HostIp, p.HostPort)
+		}
+
+		protocol := kubeapi.Protocol_name[int32(p.Protocol)]
+		result = append(result, cniPortMapping{
+			HostPort:      p.HostPort,
+			ContainerPort: p.ContainerPort,
+			Protocol:      strings.ToLower(protocol),
+			HostIP:        p.HostIp,
+		})
+	}
+	return result, nil
+}
+
+// checkpointCNIPortMappings rebuilds the CNI portmapping capability from a
+// sandbox checkpoint, so teardown releases exactly the bindings setup
+// requested, including host-IP-specific ones.
+func checkpointCNIPortMappings(checkpoint *PodSandboxCheckpoint) []cniPortMapping {
+	result := make([]cniPortMapping, 0)
+	if checkpoint == nil || checkpoint.Data == nil {
+		return result
+	}
+	for _, p := range checkpoint.Data.PortMappings {
+		if p.HostPort == nil || *p.HostPort == 0 {
+			continue
+		}
+
+		mapping := cniPortMapping{
+			HostPort:      *p.HostPort,
+			ContainerPort: *p.ContainerPort,
+			Protocol:      strings.ToLower(string(*p.Protocol)),
+		}
+		if p.HostIp != nil {
+			mapping.HostIP = *p.HostIp
+		}
+		result = append(result, mapping)
+	}
+	return result
+}
+
 // The network information needed to create HyperContainer
 // network device from CNI Result
 type NetworkInfo struct {
@@ -432,6 +488,93 @@ func buildNetworkInfo(bridgeName string, interfaces []*containerInterface) *Netw
 	}
 }
 
+// getPodNetworkStats reads the rx/tx counters of the interfaces inside the
+// pod's network namespace. CNI managed interfaces are not known to hyperd, so
+// the counters have to be collected from the netns directly. It returns nil
+// for host-network pods, which have no dedicated namespace to account.
+func getPodNetworkStats(netnsPath string) (*types.NetworkStats, error) {
+	if netnsPath == "" {
+		return nil, nil
+	}
+
+	netns, err := ns.GetNS(netnsPath)
+	if err != nil {
+		// A namespace already gone mid-teardown has no counters left to
+		// report. GetNS wraps the stat failure in its own error type, so
+		// the missing path cannot be matched with os.IsNotExist.
+		if _, ok := err.(ns.NSPathNotExistErr); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error of getting netns %q: %v", netnsPath, err)
+	}
+
+	stats := &types.NetworkStats{}
+	if err := netns.Do(func(_ ns.NetNS) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			attrs := link.Attrs()
+			if attrs.Name == "lo" || attrs.Statistics == nil {
+				continue
+			}
+
+			stats.Interfaces = append(stats.Interfaces, &types.InterfaceStats{
+				Name:      attrs.Name,
+				RxBytes:   attrs.Statistics.RxBytes,
+				RxPackets: attrs.Statistics.RxPackets,
+				RxErrors:  attrs.Statistics.RxErrors,
+				RxDropped: attrs.Statistics.RxDropped,
+				TxBytes:   attrs.Statistics.TxBytes,
+				TxPackets: attrs.Statistics.TxPackets,
+				TxErrors:  attrs.Statistics.TxErrors,
+				TxDropped: attrs.Statistics.TxDropped,
+			})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// sumInterfaceStats aggregates per-interface counters into a single entry,
+// which is what pod-level accounting wants for multi-homed pods.
+func sumInterfaceStats(stats *types.NetworkStats) *types.InterfaceStats {
+	if stats == nil {
+		return nil
+	}
+
+	total := &types.InterfaceStats{}
+	for _, iface := range stats.Interfaces {
+		total.RxBytes += iface.RxBytes
+		total.RxPackets += iface.RxPackets
+		total.RxErrors += iface.RxErrors
+		total.RxDropped += iface.RxDropped
+		total.TxBytes += iface.TxBytes
+		total.TxPackets += iface.TxPackets
+		total.TxErrors += iface.TxErrors
+		total.TxDropped += iface.TxDropped
+	}
+
+	return total
+}
+
+// GetPodNetworkStats collects the network counters of the given sandbox from
+// its network namespace recorded in the checkpoint.
+func (h *Runtime) GetPodNetworkStats(podSandboxID string) (*types.NetworkStats, error) {
+	checkpoint, err := h.checkpointHandler.GetCheckpoint(podSandboxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint for sandbox %q: %v", podSandboxID, err)
+	}
+
+	return getPodNetworkStats(checkpoint.NetNsPath)
+}
+
 func disableBridgeTracking(brName string, disable bool) error {
 	iptablesPath, err := exec.LookPath("iptables")
 	if err != nil {
@@ -450,3 +593,40 @@ func disableBridgeTracking(brName string, disable bool) error {
 
 	return nil
 }
+
+// verifyNetworkCleanup checks that the netns file and the host relay bridge
+// of a sandbox are really gone after network teardown, retrying the removal
+// once for anything left behind. A CNI DEL can partially fail without
+// reporting an error, and leaked netns mounts and veths accumulate until
+// the node runs out of interfaces.
+func verifyNetworkCleanup(netnsPath, bridgeName string) error {
+	var residue []string
+
+	if netnsPath != "" {
+		if _, err := os.Stat(netnsPath); err == nil {
+			glog.Warningf("Netns %q still present after teardown, retrying removal", netnsPath)
+			unix.Unmount(netnsPath, unix.MNT_DETACH)
+			os.Remove(netnsPath)
+			if _, err := os.Stat(netnsPath); err == nil {
+				residue = append(residue, fmt.Sprintf("netns %q", netnsPath))
+			}
+		}
+	}
+
+	if bridgeName != "" {
+		if _, err := getBridgeByName(bridgeName); err == nil {
+			glog.Warningf("Relay bridge %q still present after teardown, retrying removal", bridgeName)
+			if err := teardownRelayBridgeInHost(bridgeName); err != nil {
+				glog.Warningf("Retried teardown of relay bridge %q failed: %v", bridgeName, err)
+			}
+			if _, err := getBridgeByName(bridgeName); err == nil {
+				residue = append(residue, fmt.Sprintf("relay bridge %q", bridgeName))
+			}
+		}
+	}
+
+	if len(residue) > 0 {
+		return fmt.Errorf("still present: %s", strings.Join(residue, ", "))
+	}
+	return nil
+}
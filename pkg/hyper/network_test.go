@@ -0,0 +1,149 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestSumInterfaceStats(t *testing.T) {
+	stats := &types.NetworkStats{
+		Interfaces: []*types.InterfaceStats{
+			{
+				Name:      "eth0",
+				RxBytes:   100,
+				RxPackets: 10,
+				TxBytes:   200,
+				TxPackets: 20,
+			},
+			{
+				Name:      "eth1",
+				RxBytes:   50,
+				RxPackets: 5,
+				TxBytes:   25,
+				TxPackets: 2,
+				TxErrors:  1,
+			},
+		},
+	}
+
+	total := sumInterfaceStats(stats)
+	assert.Equal(t, uint64(150), total.RxBytes)
+	assert.Equal(t, uint64(15), total.RxPackets)
+	assert.Equal(t, uint64(225), total.TxBytes)
+	assert.Equal(t, uint64(22), total.TxPackets)
+	assert.Equal(t, uint64(1), total.TxErrors)
+}
+
+func TestGetPodNetworkStatsHostNetwork(t *testing.T) {
+	// Host-network pods have no dedicated netns and report no stats.
+	stats, err := getPodNetworkStats("")
+	assert.NoError(t, err)
+	assert.Nil(t, stats)
+}
+
+func TestVerifyNetworkCleanup(t *testing.T) {
+	// Nothing recorded, nothing to verify.
+	assert.NoError(t, verifyNetworkCleanup("", ""))
+
+	// A netns file left behind by a partially failed CNI DEL is removed
+	// by the retry.
+	netnsFile, err := ioutil.TempFile("", "netns")
+	assert.NoError(t, err)
+	netnsPath := netnsFile.Name()
+	netnsFile.Close()
+	assert.NoError(t, verifyNetworkCleanup(netnsPath, ""))
+	_, err = os.Stat(netnsPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Residue that cannot be removed is reported instead of silently
+	// leaked; a non-empty directory defeats the plain remove retry.
+	netnsDir, err := ioutil.TempDir("", "netns")
+	assert.NoError(t, err)
+	defer os.RemoveAll(netnsDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(netnsDir, "residue"), []byte{}, 0644))
+	err = verifyNetworkCleanup(netnsDir, "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "netns")
+	}
+
+	// A bridge that is already gone is not residue.
+	assert.NoError(t, verifyNetworkCleanup("", "frakti-test-br0"))
+}
+
+func TestBuildCNIPortMappings(t *testing.T) {
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	config.PortMappings = []*kubeapi.PortMapping{
+		// Bound to a specific host address.
+		{Protocol: kubeapi.Protocol_TCP, ContainerPort: 80, HostPort: 8080, HostIp: "127.0.0.1"},
+		// Empty HostIp binds to all interfaces.
+		{Protocol: kubeapi.Protocol_UDP, ContainerPort: 53, HostPort: 5353},
+		// No host port, nothing to map.
+		{Protocol: kubeapi.Protocol_TCP, ContainerPort: 9090},
+	}
+
+	mappings, err := buildCNIPortMappings(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []cniPortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp", HostIP: "127.0.0.1"},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "udp", HostIP: ""},
+	}, mappings)
+
+	// An unparsable HostIp fails the sandbox instead of silently binding
+	// everywhere.
+	config.PortMappings = []*kubeapi.PortMapping{
+		{Protocol: kubeapi.Protocol_TCP, ContainerPort: 80, HostPort: 8080, HostIp: "not-an-ip"},
+	}
+	_, err = buildCNIPortMappings(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid host IP")
+}
+
+func TestCheckpointCNIPortMappingsHostIP(t *testing.T) {
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	config.PortMappings = []*kubeapi.PortMapping{
+		{Protocol: kubeapi.Protocol_TCP, ContainerPort: 80, HostPort: 8080, HostIp: "192.168.1.10"},
+		{Protocol: kubeapi.Protocol_TCP, ContainerPort: 81, HostPort: 8081},
+	}
+
+	// The host IP survives the checkpoint, so teardown releases the same
+	// binding that setup requested.
+	checkpoint := constructPodSandboxCheckpoint(config, "/proc/1/ns/net", "", nil, 30)
+	assert.Equal(t, []cniPortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp", HostIP: "192.168.1.10"},
+		{HostPort: 8081, ContainerPort: 81, Protocol: "tcp", HostIP: ""},
+	}, checkpointCNIPortMappings(checkpoint))
+
+	// Checkpoints written before host IPs were recorded have no mappings
+	// to rebuild; nil data must not panic.
+	assert.Empty(t, checkpointCNIPortMappings(nil))
+	assert.Empty(t, checkpointCNIPortMappings(&PodSandboxCheckpoint{}))
+}
+
+func TestGetPodNetworkStatsMissingNetns(t *testing.T) {
+	// A netns that disappeared mid-teardown is skipped, not an error.
+	stats, err := getPodNetworkStats("/var/run/netns/gone-gone-gone")
+	assert.NoError(t, err)
+	assert.Nil(t, stats)
+}
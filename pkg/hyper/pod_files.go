@@ -0,0 +1,167 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	etcHostsPath      = "/etc/hosts"
+	etcHostnamePath   = "/etc/hostname"
+	etcResolvConfPath = "/etc/resolv.conf"
+
+	// hostAliasesAnnotationKey carries the pod's hostAliases as a JSON
+	// list in the v1.HostAlias shape, e.g.
+	// [{"ip":"10.1.2.3","hostnames":["foo.local"]}].
+	hostAliasesAnnotationKey = "runtime.frakti.alpha.kubernetes.io/HostAliases"
+)
+
+// hostAlias mirrors the Kubernetes v1.HostAlias shape carried in the
+// sandbox annotations.
+type hostAlias struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
+
+// parseHostAliases reads the host aliases annotation. Pods without the
+// annotation get no extra hosts entries.
+func parseHostAliases(annotations map[string]string) ([]hostAlias, error) {
+	value, ok := annotations[hostAliasesAnnotationKey]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	var aliases []hostAlias
+	if err := json.Unmarshal([]byte(value), &aliases); err != nil {
+		return nil, fmt.Errorf("invalid host aliases annotation %q: %v", value, err)
+	}
+	for _, alias := range aliases {
+		if alias.IP == "" || len(alias.Hostnames) == 0 {
+			return nil, fmt.Errorf("invalid host aliases annotation %q: each entry needs an ip and at least one hostname", value)
+		}
+	}
+	return aliases, nil
+}
+
+// makePodFiles materializes /etc/hosts, /etc/hostname and /etc/resolv.conf
+// for a container from its sandbox config. The content is injected by
+// hyperd when the container starts, so every container of the pod sees the
+// same files without any state shared through the host filesystem.
+func makePodFiles(sandboxConfig *kubeapi.PodSandboxConfig) ([]*types.UserFileReference, error) {
+	hostname := sandboxConfig.GetHostname()
+	if hostname == "" {
+		hostname = sandboxConfig.GetMetadata().GetName()
+	}
+
+	aliases, err := parseHostAliases(sandboxConfig.GetAnnotations())
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*types.UserFileReference{
+		makePodFile(etcHostnamePath, hostname+"\n"),
+		makePodFile(etcHostsPath, makeHostsContent(hostname, aliases)),
+	}
+	if content := makeResolvConfContent(sandboxConfig.GetDnsConfig()); content != "" {
+		files = append(files, makePodFile(etcResolvConfPath, content))
+	}
+	return files, nil
+}
+
+// makePodFile wraps inline file content into a hyperd file reference, the
+// same way makeContainerVolumes generates uniquely named volume details.
+func makePodFile(path, content string) *types.UserFileReference {
+	detail := &types.UserFile{
+		Name:     strings.Trim(strings.Replace(path, "/", "-", -1), "-") + fmt.Sprintf("_%08x", rand.Uint32()),
+		Encoding: "raw",
+		Content:  content,
+	}
+	return &types.UserFileReference{
+		Path:     path,
+		Filename: detail.Name,
+		Perm:     "0644",
+		Detail:   detail,
+	}
+}
+
+// mergeHostAliases combines alias entries sharing an IP into a single
+// entry, preserving the first-seen order of both IPs and hostnames.
+func mergeHostAliases(aliases []hostAlias) []hostAlias {
+	merged := make([]hostAlias, 0, len(aliases))
+	index := make(map[string]int)
+	for _, alias := range aliases {
+		if i, ok := index[alias.IP]; ok {
+			merged[i].Hostnames = append(merged[i].Hostnames, alias.Hostnames...)
+			continue
+		}
+		index[alias.IP] = len(merged)
+		merged = append(merged, hostAlias{IP: alias.IP, Hostnames: alias.Hostnames})
+	}
+	return merged
+}
+
+// makeHostsContent renders the pod's hosts file: the conventional
+// localhost entries, the pod's own hostname and any hostAliases entries.
+// Aliases sharing an IP are merged onto one line.
+func makeHostsContent(hostname string, aliases []hostAlias) string {
+	aliases = mergeHostAliases(aliases)
+	var buffer bytes.Buffer
+	buffer.WriteString("# Kubernetes-managed hosts file (by frakti).\n")
+	buffer.WriteString("127.0.0.1\tlocalhost\n")
+	buffer.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	buffer.WriteString("fe00::0\tip6-localnet\n")
+	buffer.WriteString("fe00::0\tip6-mcastprefix\n")
+	buffer.WriteString("fe00::1\tip6-allnodes\n")
+	buffer.WriteString("fe00::2\tip6-allrouters\n")
+	buffer.WriteString(fmt.Sprintf("127.0.0.1\t%s\n", hostname))
+	if len(aliases) > 0 {
+		buffer.WriteString("# Entries added by HostAliases.\n")
+		for _, alias := range aliases {
+			buffer.WriteString(fmt.Sprintf("%s\t%s\n", alias.IP, strings.Join(alias.Hostnames, " ")))
+		}
+	}
+	return buffer.String()
+}
+
+// makeResolvConfContent renders the sandbox's DNS config as a resolv.conf.
+// An empty string means the sandbox carries no DNS config and the image's
+// own resolv.conf is left alone.
+func makeResolvConfContent(dnsConfig *kubeapi.DNSConfig) string {
+	if dnsConfig == nil {
+		return ""
+	}
+
+	var buffer bytes.Buffer
+	for _, server := range dnsConfig.Servers {
+		buffer.WriteString(fmt.Sprintf("nameserver %s\n", server))
+	}
+	if len(dnsConfig.Searches) > 0 {
+		buffer.WriteString(fmt.Sprintf("search %s\n", strings.Join(dnsConfig.Searches, " ")))
+	}
+	if len(dnsConfig.Options) > 0 {
+		buffer.WriteString(fmt.Sprintf("options %s\n", strings.Join(dnsConfig.Options, " ")))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func findPodFile(files []*types.UserFileReference, path string) *types.UserFileReference {
+	for _, f := range files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+func TestMakePodFilesHostAliases(t *testing.T) {
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{
+			hostAliasesAnnotationKey: `[{"ip":"10.1.2.3","hostnames":["foo.local","bar.local"]},{"ip":"10.4.5.6","hostnames":["baz.local"]}]`,
+		},
+	)
+	config.Hostname = "foo-host"
+	config.DnsConfig = &kubeapi.DNSConfig{
+		Servers:  []string{"10.0.0.10"},
+		Searches: []string{"svc.cluster.local", "cluster.local"},
+		Options:  []string{"ndots:5"},
+	}
+
+	files, err := makePodFiles(config)
+	assert.NoError(t, err)
+
+	hostname := findPodFile(files, etcHostnamePath)
+	assert.NotNil(t, hostname)
+	assert.Equal(t, "foo-host\n", hostname.Detail.Content)
+
+	hosts := findPodFile(files, etcHostsPath)
+	assert.NotNil(t, hosts)
+	assert.Contains(t, hosts.Detail.Content, "127.0.0.1\tfoo-host\n")
+	assert.Contains(t, hosts.Detail.Content, "10.1.2.3\tfoo.local bar.local\n")
+	assert.Contains(t, hosts.Detail.Content, "10.4.5.6\tbaz.local\n")
+
+	resolv := findPodFile(files, etcResolvConfPath)
+	assert.NotNil(t, resolv)
+	assert.Equal(t, "nameserver 10.0.0.10\nsearch svc.cluster.local cluster.local\noptions ndots:5\n", resolv.Detail.Content)
+
+	// A malformed annotation fails the container instead of silently
+	// dropping the aliases.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{hostAliasesAnnotationKey: "not-json"},
+	)
+	_, err = makePodFiles(config)
+	assert.Error(t, err)
+
+	// Without a DNS config no resolv.conf is injected and the hostname
+	// falls back to the pod name.
+	config = makeSandboxConfig("foo", "bar", "1", 0)
+	files, err = makePodFiles(config)
+	assert.NoError(t, err)
+	assert.Nil(t, findPodFile(files, etcResolvConfPath))
+	hostname = findPodFile(files, etcHostnamePath)
+	assert.NotNil(t, hostname)
+	assert.Equal(t, "foo\n", hostname.Detail.Content)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// maxMergedLogLinesPerContainer bounds how many trailing lines are read from
+// each container log during a merge, so dumping the logs of a chatty pod
+// does not load gigabytes into memory.
+const maxMergedLogLinesPerContainer = 1000
+
+// podLogStream is the remaining lines of one container's log, consumed in
+// file order during the merge.
+type podLogStream struct {
+	container string
+	lines     []string
+	stamps    []time.Time
+	next      int
+}
+
+func newPodLogStream(container string, lines []string) *podLogStream {
+	stamps := make([]time.Time, len(lines))
+	var last time.Time
+	for i, line := range lines {
+		if when, ok := parseLogTimestamp(line); ok {
+			last = when
+		}
+		// A line without a parsable timestamp (e.g. a truncated write)
+		// inherits the preceding line's, so it stays glued to it.
+		stamps[i] = last
+	}
+	return &podLogStream{container: container, lines: lines, stamps: stamps}
+}
+
+// parseLogTimestamp extracts the leading RFC3339Nano timestamp the CRI log
+// format puts in front of every line.
+func parseLogTimestamp(line string) (time.Time, bool) {
+	idx := strings.IndexByte(line, ' ')
+	if idx <= 0 {
+		return time.Time{}, false
+	}
+	when, err := time.Parse(time.RFC3339Nano, line[:idx])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return when, true
+}
+
+// tailLogLines returns up to limit trailing lines of the log file at path.
+// It streams through the file keeping only the trailing window, so a very
+// large log costs limit lines of memory, not its file size.
+func tailLogLines(path string, limit int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0, limit)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(lines) == limit {
+			copy(lines, lines[1:])
+			lines = lines[:limit-1]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// mergePodLogStreams interleaves the streams by timestamp while preserving
+// each container's own line order: only the streams' head lines are ever
+// compared. A container whose clock is skewed therefore still comes out in
+// the order it wrote, it just interleaves earlier or later than wall time
+// would suggest.
+func mergePodLogStreams(streams []*podLogStream) []string {
+	total := 0
+	for _, s := range streams {
+		total += len(s.lines)
+	}
+
+	merged := make([]string, 0, total)
+	for {
+		var best *podLogStream
+		for _, s := range streams {
+			if s.next >= len(s.lines) {
+				continue
+			}
+			if best == nil || s.stamps[s.next].Before(best.stamps[best.next]) {
+				best = s
+			}
+		}
+		if best == nil {
+			return merged
+		}
+		merged = append(merged, fmt.Sprintf("%s %s", best.container, best.lines[best.next]))
+		best.next++
+	}
+}
+
+// MergedSandboxLogs interleaves the trailing log lines of all containers in
+// the sandbox by timestamp, each line prefixed with its container's name. At
+// most tail lines are read per container, capped at
+// maxMergedLogLinesPerContainer; tail <= 0 asks for the cap. This is
+// diagnostic only: it issues read calls exclusively and a container whose
+// log cannot be read is skipped rather than failing the merge.
+func (h *Runtime) MergedSandboxLogs(podSandboxID string, tail int) ([]string, error) {
+	if tail <= 0 || tail > maxMergedLogLinesPerContainer {
+		tail = maxMergedLogLinesPerContainer
+	}
+
+	containers, err := h.client.GetContainerList()
+	if err != nil {
+		glog.Errorf("Get container list failed: %v", err)
+		return nil, err
+	}
+
+	var streams []*podLogStream
+	for _, c := range containers {
+		if c.PodID != podSandboxID {
+			continue
+		}
+
+		info, err := h.client.GetContainerInfo(c.ContainerID)
+		if err != nil {
+			glog.Warningf("Get container info for %s failed, skipping its log: %v", c.ContainerID, err)
+			continue
+		}
+		logPath := info.Container.Labels[containerLogPathLabelKey]
+		if logPath == "" {
+			continue
+		}
+
+		lines, err := tailLogLines(logPath, tail)
+		if err != nil {
+			// A container that never wrote anything has no log file; that
+			// is not worth failing the whole merge over.
+			glog.Warningf("Read log of container %s at %s failed: %v", c.ContainerID, logPath, err)
+			continue
+		}
+
+		name := c.ContainerName
+		if metadata, err := toKubeContainerMetadata(name); err == nil {
+			name = metadata.Name
+		}
+		streams = append(streams, newPodLogStream(name, lines))
+	}
+
+	return mergePodLogStreams(streams), nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePodLogStreams(t *testing.T) {
+	app := newPodLogStream("app", []string{
+		"2017-01-01T00:00:01Z stdout F app one",
+		"2017-01-01T00:00:03Z stdout F app two",
+		"no timestamp here",
+		"2017-01-01T00:00:05Z stdout F app three",
+	})
+	sidecar := newPodLogStream("sidecar", []string{
+		"2017-01-01T00:00:02Z stdout F sidecar one",
+		"2017-01-01T00:00:04Z stdout F sidecar two",
+	})
+
+	merged := mergePodLogStreams([]*podLogStream{app, sidecar})
+	assert.Equal(t, []string{
+		"app 2017-01-01T00:00:01Z stdout F app one",
+		"sidecar 2017-01-01T00:00:02Z stdout F sidecar one",
+		"app 2017-01-01T00:00:03Z stdout F app two",
+		// The line without a timestamp sticks to its predecessor.
+		"app no timestamp here",
+		"sidecar 2017-01-01T00:00:04Z stdout F sidecar two",
+		"app 2017-01-01T00:00:05Z stdout F app three",
+	}, merged)
+
+	// A container whose clock jumped backwards still comes out in the
+	// order it wrote; only the interleaving with other containers shifts.
+	steady := newPodLogStream("steady", []string{
+		"2017-01-01T00:00:05Z stdout F steady",
+	})
+	skewed := newPodLogStream("skewed", []string{
+		"2017-01-01T00:00:10Z stdout F before the jump",
+		"2017-01-01T00:00:00Z stdout F after the jump",
+	})
+	merged = mergePodLogStreams([]*podLogStream{steady, skewed})
+	assert.Equal(t, []string{
+		"steady 2017-01-01T00:00:05Z stdout F steady",
+		"skewed 2017-01-01T00:00:10Z stdout F before the jump",
+		"skewed 2017-01-01T00:00:00Z stdout F after the jump",
+	}, merged)
+}
+
+func TestMergedSandboxLogs(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	logDir, err := ioutil.TempDir("", "frakti-pod-logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(logDir)
+
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	sConfig.LogDirectory = logDir
+
+	appConfig := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	appConfig.LogPath = "app.log"
+	_, err = r.CreateContainer("sandboxid", appConfig, sConfig)
+	assert.NoError(t, err)
+
+	sidecarConfig := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	sidecarConfig.LogPath = "sidecar.log"
+	_, err = r.CreateContainer("sandboxid", sidecarConfig, sConfig)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(logDir, "app.log"), []byte(
+		"2017-01-01T00:00:01Z stdout F app one\n"+
+			"2017-01-01T00:00:03Z stdout F app two\n"+
+			"2017-01-01T00:00:05Z stdout F app three\n"), 0644)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(logDir, "sidecar.log"), []byte(
+		"2017-01-01T00:00:02Z stdout F sidecar one\n"+
+			"2017-01-01T00:00:04Z stdout F sidecar two\n"), 0644)
+	assert.NoError(t, err)
+
+	merged, err := r.MergedSandboxLogs("sandboxid", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"app 2017-01-01T00:00:01Z stdout F app one",
+		"sidecar 2017-01-01T00:00:02Z stdout F sidecar one",
+		"app 2017-01-01T00:00:03Z stdout F app two",
+		"sidecar 2017-01-01T00:00:04Z stdout F sidecar two",
+		"app 2017-01-01T00:00:05Z stdout F app three",
+	}, merged)
+
+	// Only the trailing tail lines of each container are read and merged.
+	merged, err = r.MergedSandboxLogs("sandboxid", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"sidecar 2017-01-01T00:00:04Z stdout F sidecar two",
+		"app 2017-01-01T00:00:05Z stdout F app three",
+	}, merged)
+
+	// A sandbox without containers merges to nothing instead of failing.
+	merged, err = r.MergedSandboxLogs("no-such-sandbox", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, merged)
+}
+
+func TestTailLogLines(t *testing.T) {
+	logDir, err := ioutil.TempDir("", "frakti-tail-log")
+	assert.NoError(t, err)
+	defer os.RemoveAll(logDir)
+
+	path := filepath.Join(logDir, "c.log")
+	err = ioutil.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644)
+	assert.NoError(t, err)
+
+	lines, err := tailLogLines(path, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"two", "three"}, lines)
+
+	lines, err = tailLogLines(path, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+
+	_, err = tailLogLines(filepath.Join(logDir, "missing.log"), 2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// Sandbox annotations under podOptionsAnnotationPrefix map onto advanced
+// hyperd UserPod fields that CRI has no first-class notion of. Supported
+// keys:
+//
+//	podoptions.frakti.alpha.kubernetes.io/VMType      - hypervisor driver for the sandbox VM, e.g. "qemu" or "libvirt". Validated against the node's configured allow-list
+//	podoptions.frakti.alpha.kubernetes.io/DNSOptions  - comma-separated resolv.conf options appended to the pod's DNS options
+//	podoptions.frakti.alpha.kubernetes.io/DNSSearch   - comma-separated search domains appended to the pod's DNS search list
+//
+// Unknown keys under the prefix are ignored with a warning so newer
+// annotations do not break older fraktis; recognized keys with empty values
+// are rejected.
+const (
+	podOptionsAnnotationPrefix = "podoptions.frakti.alpha.kubernetes.io/"
+
+	podOptionVMType     = podOptionsAnnotationPrefix + "VMType"
+	podOptionDNSOptions = podOptionsAnnotationPrefix + "DNSOptions"
+	podOptionDNSSearch  = podOptionsAnnotationPrefix + "DNSSearch"
+)
+
+// applyPodOptions maps recognized pod option annotations onto the UserPod
+// spec built from the sandbox config. A non-empty allowedHypervisors list
+// restricts which drivers VMType may select; an empty list leaves the
+// choice to hyperd, which rejects drivers it was not built with.
+func applyPodOptions(spec *types.UserPod, annotations map[string]string, allowedHypervisors []string) error {
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, podOptionsAnnotationPrefix) {
+			continue
+		}
+
+		switch key {
+		case podOptionVMType:
+			if value == "" {
+				return fmt.Errorf("pod option %q must not be empty", key)
+			}
+			if err := validateHypervisor(value, allowedHypervisors); err != nil {
+				return err
+			}
+			spec.Type = value
+		case podOptionDNSOptions:
+			options := splitPodOptionList(value)
+			if len(options) == 0 {
+				return fmt.Errorf("pod option %q must not be empty", key)
+			}
+			spec.DnsOptions = append(spec.DnsOptions, options...)
+		case podOptionDNSSearch:
+			domains := splitPodOptionList(value)
+			if len(domains) == 0 {
+				return fmt.Errorf("pod option %q must not be empty", key)
+			}
+			spec.DnsSearch = append(spec.DnsSearch, domains...)
+		default:
+			glog.Warningf("Ignoring unknown pod option annotation %q", key)
+		}
+	}
+
+	return nil
+}
+
+// splitPodOptionList splits a comma-separated pod option value, dropping
+// empty entries.
+func splitPodOptionList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validateHypervisor rejects hypervisor drivers outside the configured
+// allow-list, so pods cannot select a driver the operator has not vetted
+// for this node.
+func validateHypervisor(driver string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(driver, a) {
+			return nil
+		}
+	}
+	return fmt.Errorf("hypervisor driver %q is not allowed on this node; allowed drivers: %s", driver, strings.Join(allowed, ", "))
+}
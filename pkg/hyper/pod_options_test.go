@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestApplyPodOptions(t *testing.T) {
+	spec := &types.UserPod{
+		DnsOptions: []string{"ndots:2"},
+	}
+	err := applyPodOptions(spec, map[string]string{
+		podOptionVMType:     "libvirt",
+		podOptionDNSOptions: "timeout:1, attempts:2",
+		podOptionDNSSearch:  "svc.cluster.local",
+		// Unrelated annotations and unknown keys under the prefix are
+		// both ignored.
+		"io.kubernetes.pod.name":               "foo",
+		podOptionsAnnotationPrefix + "Mystery": "x",
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "libvirt", spec.Type)
+	assert.Equal(t, []string{"ndots:2", "timeout:1", "attempts:2"}, spec.DnsOptions)
+	assert.Equal(t, []string{"svc.cluster.local"}, spec.DnsSearch)
+
+	// Recognized keys with empty values are rejected.
+	err = applyPodOptions(&types.UserPod{}, map[string]string{podOptionVMType: ""}, nil)
+	assert.Error(t, err)
+	err = applyPodOptions(&types.UserPod{}, map[string]string{podOptionDNSSearch: " , "}, nil)
+	assert.Error(t, err)
+}
+
+func TestApplyPodOptionsHypervisorAllowList(t *testing.T) {
+	allowed := []string{"qemu", "kvm"}
+
+	// A recognized driver is applied to the pod spec.
+	spec := &types.UserPod{}
+	err := applyPodOptions(spec, map[string]string{podOptionVMType: "kvm"}, allowed)
+	assert.NoError(t, err)
+	assert.Equal(t, "kvm", spec.Type)
+
+	// A driver outside the allow-list is rejected before any VM is
+	// created.
+	spec = &types.UserPod{}
+	err = applyPodOptions(spec, map[string]string{podOptionVMType: "xen"}, allowed)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed")
+	assert.Empty(t, spec.Type)
+}
+
+func TestBuildUserPodOptions(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	config := &kubeapi.PodSandboxConfig{
+		Metadata: &kubeapi.PodSandboxMetadata{
+			Name:      "foo",
+			Namespace: "default",
+			Uid:       "12345",
+			Attempt:   1,
+		},
+		Annotations: map[string]string{
+			podOptionVMType: "qemu",
+		},
+	}
+
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "qemu", spec.Type)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+const (
+	// podPriorityAnnotationKey is the sandbox annotation carrying the
+	// pod's scheduling priority, as placed there by kubelet; CRI v1alpha1
+	// has no priority field of its own.
+	podPriorityAnnotationKey = "scheduler.alpha.kubernetes.io/priority"
+
+	// podPriorityLabelKey keeps the parsed priority in pod labels. Like
+	// the QoS class, the value only rides along for now; hyperd has no VM
+	// scheduling-priority setting to map it onto yet.
+	podPriorityLabelKey = "io.kubernetes.frakti.pod-priority"
+)
+
+// applyPodPriority parses the pod's priority annotation and records it on
+// the pod spec, so higher-priority pods can win VM resources under
+// contention once hyperd can weight or preempt VMs; this is the single
+// place to wire that up. Until then the priority is kept as a label and the
+// VM is scheduled like any other, which is the graceful fallback for a
+// daemon without a priority concept. A malformed value is rejected before
+// any resource is created.
+func applyPodPriority(spec *types.UserPod, annotations map[string]string) error {
+	value, ok := annotations[podPriorityAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	priority, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid pod priority annotation %q: %v", value, err)
+	}
+
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	spec.Labels[podPriorityLabelKey] = strconv.FormatInt(priority, 10)
+	return nil
+}
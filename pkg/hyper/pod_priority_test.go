@@ -0,0 +1,57 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPodPriority(t *testing.T) {
+	r, _, _ := newTestRuntime()
+
+	// The annotated priority is recorded in the pod labels, including a
+	// negative one.
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{podPriorityAnnotationKey: "1000"})
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", spec.Labels[podPriorityLabelKey])
+
+	config.Annotations[podPriorityAnnotationKey] = " -10 "
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "-10", spec.Labels[podPriorityLabelKey])
+
+	// The label is internal bookkeeping and must not surface in the
+	// kubelet-visible labels.
+	assert.NotContains(t, getKubeletLabels(spec.Labels), podPriorityLabelKey)
+
+	// A malformed priority fails the sandbox early.
+	config.Annotations[podPriorityAnnotationKey] = "critical"
+	_, err = r.buildUserPod(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid pod priority annotation")
+
+	// Without the annotation nothing is recorded.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{})
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.NotContains(t, spec.Labels, podPriorityLabelKey)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Annotations under imageSpecAnnotationPrefix tune how an image is pulled.
+// They are read from the pod's own annotations on the sandbox pre-pull
+// path; the v1alpha1 PullImage request carries no image annotations, so
+// kubelet-initiated pulls run with the defaults until the CRI vendoring is
+// bumped to a revision with annotations on the ImageSpec. Supported keys:
+//
+//	imagespec.frakti.alpha.kubernetes.io/registry  - registry host the image is pulled from, overriding the one in the reference
+//	imagespec.frakti.alpha.kubernetes.io/platform  - "os/arch[/variant]" the image is wanted for; hyperd can only pull the node's own platform, so a mismatch is rejected
+//
+// A key under the prefix that parsePullOptions does not recognize only
+// draws a warning, while a recognized key with a value it cannot act on
+// (an empty registry, a malformed platform) fails the pull outright: a
+// silently dropped override could fetch an image from the wrong place.
+const (
+	imageSpecAnnotationPrefix = "imagespec.frakti.alpha.kubernetes.io/"
+
+	imageSpecRegistry = imageSpecAnnotationPrefix + "registry"
+	imageSpecPlatform = imageSpecAnnotationPrefix + "platform"
+)
+
+// pullOptions are the pull tunables derived from image annotations.
+type pullOptions struct {
+	// registry, when non-empty, replaces the registry host of the pulled
+	// reference.
+	registry string
+	// platform, when non-empty, is the "os/arch[/variant]" the image is
+	// wanted for.
+	platform string
+}
+
+// parsePullOptions derives the pull options from annotations.
+func parsePullOptions(annotations map[string]string) (pullOptions, error) {
+	var opts pullOptions
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, imageSpecAnnotationPrefix) {
+			continue
+		}
+
+		switch key {
+		case imageSpecRegistry:
+			if value == "" {
+				return pullOptions{}, fmt.Errorf("image annotation %q must not be empty", key)
+			}
+			if strings.Contains(value, "/") || strings.Contains(value, "://") {
+				return pullOptions{}, fmt.Errorf("image annotation %q must be a bare registry host, got %q", key, value)
+			}
+			opts.registry = value
+		case imageSpecPlatform:
+			parts := strings.Split(value, "/")
+			if len(parts) < 2 || len(parts) > 3 || inList("", parts) {
+				return pullOptions{}, fmt.Errorf("image annotation %q must be of the form \"os/arch[/variant]\", got %q", key, value)
+			}
+			opts.platform = value
+		default:
+			glog.Warningf("Ignoring unknown image annotation %q", key)
+		}
+	}
+
+	return opts, nil
+}
+
+// applyRegistry rewrites the registry host of repo according to the
+// options, leaving the repository path untouched. Bare references like
+// "library/nginx" get the registry prepended.
+func (o pullOptions) applyRegistry(repo string) string {
+	if o.registry == "" {
+		return repo
+	}
+	if existing := parseRegistryHost(repo); existing != "" {
+		return o.registry + strings.TrimPrefix(repo, existing)
+	}
+	return o.registry + "/" + repo
+}
+
+// nodePlatform is the "os/arch" of the node frakti runs on, which is the
+// only platform hyperd can pull for.
+func nodePlatform() string {
+	return goruntime.GOOS + "/" + goruntime.GOARCH
+}
+
+// validatePullPlatform rejects pull platforms incompatible with the node.
+// A variant suffix on the node's own platform (e.g. "linux/arm/v7" on an
+// arm node) is accepted; the registry resolves it like the variant-less
+// form.
+func validatePullPlatform(platform string) error {
+	node := nodePlatform()
+	if platform == node || strings.HasPrefix(platform, node+"/") {
+		return nil
+	}
+	return fmt.Errorf("cannot pull image for platform %q on a %q node", platform, node)
+}
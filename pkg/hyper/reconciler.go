@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// StartReconciler periodically compares frakti's persisted sandbox state
+// against hyperd and reports any drift, catching pods leaked by crashes or
+// stop/start races. It only issues read calls, so it is safe to run
+// concurrently with CRI traffic; nothing is deleted automatically. A
+// non-positive interval disables the reconciler.
+func (h *Runtime) StartReconciler(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	glog.V(2).Infof("Starting state reconciler with interval %v", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if orphanPods, orphanCheckpoints, err := h.reconcile(); err != nil {
+				glog.Warningf("State reconciliation failed: %v", err)
+			} else if len(orphanPods)+len(orphanCheckpoints) > 0 {
+				glog.Warningf("State drift detected: %d hyperd pods without checkpoints %v, %d checkpoints without hyperd pods %v",
+					len(orphanPods), orphanPods, len(orphanCheckpoints), orphanCheckpoints)
+			}
+		}
+	}()
+}
+
+// reconcile returns the hyperd pods frakti has no checkpoint for and the
+// checkpoints hyperd has no pod for, and publishes both counts as metrics.
+// Non-kubelet pods living on a shared hyperd are left out.
+func (h *Runtime) reconcile() (orphanPods, orphanCheckpoints []string, err error) {
+	pods, err := h.client.GetPodList()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkpoints := make(map[string]bool)
+	for _, id := range h.checkpointHandler.ListCheckpoints() {
+		checkpoints[id] = true
+	}
+
+	podIDs := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		if _, _, _, _, err := parseSandboxName(pod.PodName); err != nil {
+			// Not managed by kubelet.
+			continue
+		}
+		podIDs[pod.PodID] = true
+		if !checkpoints[pod.PodID] {
+			orphanPods = append(orphanPods, pod.PodID)
+		}
+	}
+	for id := range checkpoints {
+		if !podIDs[id] {
+			orphanCheckpoints = append(orphanCheckpoints, id)
+		}
+	}
+
+	stateDrift.WithLabelValues("orphan_pod").Set(float64(len(orphanPods)))
+	stateDrift.WithLabelValues("orphan_checkpoint").Set(float64(len(orphanCheckpoints)))
+	return orphanPods, orphanCheckpoints, nil
+}
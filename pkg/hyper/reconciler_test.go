@@ -0,0 +1,49 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
+
+	// One pod known on both sides, one pod only hyperd knows, one
+	// checkpoint whose pod is gone.
+	fakeClient.SetFakePod([]*FakePod{
+		{PodID: "p*0", PodName: "k8s_POD_foo_bar_p*0_1", Status: "running"},
+		{PodID: "p*1", PodName: "k8s_POD_baz_bar_p*1_1", Status: "running"},
+	})
+	assert.NoError(t, checkpointHandler.CreateCheckpoint("p*0", &PodSandboxCheckpoint{Name: "c*0"}))
+	assert.NoError(t, checkpointHandler.CreateCheckpoint("p*2", &PodSandboxCheckpoint{Name: "c*2"}))
+
+	orphanPods, orphanCheckpoints, err := r.reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p*1"}, orphanPods)
+	assert.Equal(t, []string{"p*2"}, orphanCheckpoints)
+
+	// Once the state converges no drift is reported.
+	assert.NoError(t, checkpointHandler.CreateCheckpoint("p*1", &PodSandboxCheckpoint{Name: "c*1"}))
+	assert.NoError(t, checkpointHandler.RemoveCheckpoint("p*2"))
+	orphanPods, orphanCheckpoints, err = r.reconcile()
+	assert.NoError(t, err)
+	assert.Empty(t, orphanPods)
+	assert.Empty(t, orphanCheckpoints)
+}
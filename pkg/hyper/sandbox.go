@@ -19,25 +19,76 @@ package hyper
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/ns"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
 	"github.com/golang/glog"
 	"golang.org/x/sys/unix"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/frakti/pkg/hyper/types"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+	"k8s.io/kubernetes/pkg/util/bandwidth"
 )
 
 // RunPodSandbox creates and starts a pod-level sandbox.
 func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error) {
+	bootStart := time.Now()
+	if err := h.checkSandboxCapacity(); err != nil {
+		glog.Errorf("Run sandbox %q failed: %v", config.String(), err)
+		return "", err
+	}
+	if err := h.checkStorageFreeSpace(); err != nil {
+		glog.Errorf("Run sandbox %q failed: %v", config.String(), err)
+		return "", err
+	}
+
 	userpod, err := h.buildUserPod(config)
 	if err != nil {
 		glog.Errorf("Build UserPod for sandbox %q failed: %v", config.String(), err)
 		return "", err
 	}
 
+	// Validate the bandwidth annotations before any resource is created, so
+	// a malformed quantity fails the sandbox early.
+	ingress, egress, err := bandwidth.ExtractPodBandwidthResources(config.GetAnnotations())
+	if err != nil {
+		glog.Errorf("Invalid bandwidth annotations for sandbox %q: %v", config.String(), err)
+		return "", err
+	}
+
+	// The termination grace period is validated here and persisted in the
+	// checkpoint below, so StopPodSandbox can honor it later.
+	terminationGracePeriod, err := getTerminationGracePeriod(config.GetAnnotations())
+	if err != nil {
+		glog.Errorf("Invalid termination grace period for sandbox %q: %v", config.String(), err)
+		return "", err
+	}
+
+	// In dry-run mode the spec is translated and validated as usual, but
+	// no VM, network or checkpoint is materialized. This exists purely so
+	// the translation logic can be exercised without a real hyperd.
+	if h.dryRun {
+		podID := "dryrun-" + getMD5Hash(userpod.Id)
+		h.sandboxLabels.Add(podID, config.GetLabels())
+		glog.V(3).Infof("Dry run: sandbox %q translated to %q, not started", config.String(), podID)
+		return podID, nil
+	}
+
+	// Queue behind other in-flight creates when VM-boot concurrency is
+	// bounded. The CRI call carries no caller context here, so the wait
+	// is capped by the same timeout as hyperd calls.
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+	if err := h.createLimiter.acquire(ctx); err != nil {
+		glog.Errorf("Waiting for a create slot for sandbox %q failed: %v", config.String(), err)
+		return "", err
+	}
+	defer h.createLimiter.release()
+
 	netns, err := ns.NewNS()
 	if err != nil {
 		glog.Errorf("Create Network Namespace sandbox %q failed: %v", config.String(), err)
@@ -58,20 +109,10 @@ func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error
 	userpod.Labels["NETNS"] = netNsPath
 
 	// Setup the network
-	portMappings := config.GetPortMappings()
-	portMappingsParam := make([]cniPortMapping, 0, len(portMappings))
-	for _, p := range portMappings {
-		if p.HostPort == 0 {
-			continue
-		}
-
-		protocol := kubeapi.Protocol_name[int32(p.Protocol)]
-		portMappingsParam = append(portMappingsParam, cniPortMapping{
-			HostPort:      p.HostPort,
-			ContainerPort: p.ContainerPort,
-			Protocol:      strings.ToLower(protocol),
-			HostIP:        p.HostIp,
-		})
+	portMappingsParam, err := buildCNIPortMappings(config)
+	if err != nil {
+		glog.Errorf("Build port mappings for sandbox %q failed: %v", config.String(), err)
+		return "", err
 	}
 	capabilities := map[string]interface{}{
 		"portMappings": portMappingsParam,
@@ -82,7 +123,7 @@ func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error
 	if h.netPlugin.Name() == "weave" {
 		sandboxID = getMD5Hash(podId)
 	}
-	_, err = h.netPlugin.SetUpPod(netNsPath, sandboxID, config.GetMetadata(), config.GetAnnotations(), capabilities)
+	_, err = h.setUpPodNetwork(netNsPath, sandboxID, config.GetMetadata(), config.GetAnnotations(), capabilities)
 	if err != nil {
 		glog.Errorf("Setup network for sandbox %q by cni plugin failed: %v", config.String(), err)
 		return "", err
@@ -136,11 +177,31 @@ func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error
 	networkInfo := buildNetworkInfo(bridgeName, containerInterfaces)
 	addNetworkInterfaceForPod(userpod, networkInfo)
 
+	// Apply bandwidth shaping on the host relay bridge. The qdiscs are
+	// removed together with the bridge when the sandbox is stopped.
+	if ingress != nil || egress != nil {
+		shaper := bandwidth.NewTCShaper(bridgeName)
+		if err = shaper.ReconcileInterface(); err != nil {
+			glog.Errorf("Reconcile shaping interface %q failed: %v", bridgeName, err)
+			return "", err
+		}
+		if err = shaper.Limit(networkInfo.Ip, ingress, egress); err != nil {
+			glog.Errorf("Apply bandwidth shaping for sandbox %q failed: %v", podId, err)
+			return "", err
+		}
+	}
+
+	// Withhold bulky or irrelevant annotations from the VM config; the
+	// status path merges them back from frakti's own metadata.
+	withheldAnnotations := h.annotationFilter.filterSpecLabels(userpod.Labels, config.GetAnnotations())
+
 	podID, err := h.client.CreatePod(userpod)
 	if err != nil {
 		glog.Errorf("Create pod for sandbox %q failed: %v", config.String(), err)
 		return "", err
 	}
+	h.specSnapshots.record(podID, redactUserPod(userpod))
+	h.withheldAnnotations.record(podID, withheldAnnotations)
 	defer func() {
 		if err != nil {
 			if removeError := h.client.RemovePod(podID); removeError != nil {
@@ -150,7 +211,7 @@ func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error
 	}()
 
 	// Create sandbox checkpoint
-	err = h.checkpointHandler.CreateCheckpoint(podID, constructPodSandboxCheckpoint(config, netNsPath, bridgeName, containerInterfaces))
+	err = h.checkpointHandler.CreateCheckpoint(podID, constructPodSandboxCheckpoint(config, netNsPath, bridgeName, containerInterfaces, terminationGracePeriod))
 	if err != nil {
 		return podID, err
 	}
@@ -162,15 +223,55 @@ func (h *Runtime) RunPodSandbox(config *kubeapi.PodSandboxConfig) (string, error
 		}
 	}()
 
-	err = h.client.StartPod(podID)
+	// The VM boot gets its own timeout; on overrun the deferred cleanup
+	// above removes the half-started pod.
+	err = h.client.StartPod(podID, h.sandboxBootTimeout)
 	if err != nil {
+		// Surface hyperd's own view of why the VM did not start.
+		err = withStartFailureCause(err, h.podStartFailureCause(podID))
 		glog.Errorf("Start pod %q failed: %v", podID, err)
 		return "", err
 	}
 
+	h.sandboxLabels.Add(podID, config.GetLabels())
+	sandboxBootLatency.Observe(time.Since(bootStart).Seconds())
+
+	// Kick off image pre-pulls in the background; sandbox readiness never
+	// waits for them.
+	if h.enableImagePrePull {
+		go h.prePullImages(podID, config)
+	}
+
 	return podID, nil
 }
 
+// setUpPodNetwork invokes the CNI plugin with a bounded timeout, so that a
+// hanging plugin fails sandbox creation (triggering the normal cleanup path)
+// instead of blocking it indefinitely.
+func (h *Runtime) setUpPodNetwork(netNsPath, sandboxID string, metadata *kubeapi.PodSandboxMetadata, annotations map[string]string, capabilities map[string]interface{}) (cnitypes.Result, error) {
+	timeout := h.cniTimeout
+	if timeout <= 0 {
+		timeout = defaultCNITimeout
+	}
+
+	type setUpResult struct {
+		result cnitypes.Result
+		err    error
+	}
+	resultCh := make(chan setUpResult, 1)
+	go func() {
+		result, err := h.netPlugin.SetUpPod(netNsPath, sandboxID, metadata, annotations, capabilities)
+		resultCh <- setUpResult{result: result, err: err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.result, res.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("CNI plugin %q did not finish setting up pod %q within %v", h.netPlugin.Name(), sandboxID, timeout)
+	}
+}
+
 // TODO: only bridge plugin now, support other plugins in the future
 func addNetworkInterfaceForPod(userpod *types.UserPod, info *NetworkInfo) {
 	ifaces := append([]*types.UserInterface{}, &types.UserInterface{
@@ -190,6 +291,10 @@ func (h *Runtime) buildUserPod(config *kubeapi.PodSandboxConfig) (*types.UserPod
 		cpuNumber, memoryinMegabytes int32
 		err                          error
 	)
+	// The sandbox runs inside a VM, so it can not be placed under kubelet's
+	// QoS cgroup hierarchy directly. Instead, the cgroup parent is used to
+	// size the VM (see below), and is kept in pod labels so node-level
+	// accounting tools can still correlate the VM with its QoS cgroup.
 	var cgroupParent string
 	if linuxConfig := config.GetLinux(); linuxConfig != nil {
 		cgroupParent = linuxConfig.CgroupParent
@@ -213,9 +318,20 @@ func (h *Runtime) buildUserPod(config *kubeapi.PodSandboxConfig) (*types.UserPod
 		memoryinMegabytes = h.defaultMemoryMB
 	}
 
+	// Account the RuntimeClass pod overhead on top of the workload's own
+	// sizing, so the VM kernel and agents do not compete with the
+	// containers for their requested resources. The overhead arrives via
+	// annotations because CRI v1alpha1 has no overhead field.
+	overheadCPU, overheadMemory, err := getPodOverhead(config.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	cpuNumber += overheadCPU
+	memoryinMegabytes += overheadMemory
+
 	spec := &types.UserPod{
 		Id:       buildSandboxName(config),
-		Hostname: config.Hostname,
+		Hostname: buildPodHostname(config),
 		Labels:   buildLabelsWithAnnotations(config.Labels, config.Annotations),
 		Resource: &types.UserResource{
 			Vcpu:   cpuNumber,
@@ -223,19 +339,157 @@ func (h *Runtime) buildUserPod(config *kubeapi.PodSandboxConfig) (*types.UserPod
 		},
 	}
 
+	if len(cgroupParent) != 0 {
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		spec.Labels[cgroupParentLabelKey] = cgroupParent
+	}
+
+	// Pass the pod's QoS class along as a scheduling hint. hyperd has no
+	// priority or reservation setting to map it onto yet, so the VM sizing
+	// above is the only enforcement and the class is recorded as a label.
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	spec.Labels[qosClassLabelKey] = getPodQoSClass(cgroupParent)
+
+	// The pod's priority travels the same way, for the day hyperd can
+	// weight or preempt VMs under contention.
+	if err := applyPodPriority(spec, config.GetAnnotations()); err != nil {
+		return nil, err
+	}
+
 	// Setup dns options.
 	if config.DnsConfig != nil {
 		spec.Dns = config.DnsConfig.Servers
 		spec.DnsOptions = config.DnsConfig.Options
 		spec.DnsSearch = config.DnsConfig.Searches
 	}
+	if len(spec.Dns) == 0 && len(h.defaultDNS) > 0 {
+		// Without any resolver the VM cannot resolve names at all, so
+		// fall back to the configured default servers.
+		spec.Dns = h.defaultDNS
+	}
+	// Apply the pod's DNS policy on top of the raw server lists.
+	if err := h.applyDNSPolicy(spec, config); err != nil {
+		return nil, err
+	}
+
+	// Apply extra hyperd pod options requested via sandbox annotations.
+	if err := applyPodOptions(spec, config.Annotations, h.allowedHypervisors); err != nil {
+		return nil, err
+	}
+
+	// Record the pod's /etc/hosts, including any hostAliases from the
+	// sandbox annotations, in the pod spec. Containers inject the same
+	// content at create time; rendering it here also rejects a malformed
+	// annotation before any resource is created.
+	aliases, err := parseHostAliases(config.GetAnnotations())
+	if err != nil {
+		return nil, err
+	}
+	hostsFile := makePodFile(etcHostsPath, makeHostsContent(spec.Hostname, aliases))
+	spec.Files = []*types.UserFile{hostsFile.Detail}
 
 	return spec, nil
 }
 
+const (
+	// podOverheadCPUAnnotationKey carries the RuntimeClass pod overhead
+	// CPU in milli-CPUs. The VM is sized in whole vCPUs, so the overhead
+	// is rounded up; the workload keeps its full request either way.
+	podOverheadCPUAnnotationKey = "runtime.frakti.alpha.kubernetes.io/PodOverheadCPUMilli"
+	// podOverheadMemoryAnnotationKey carries the RuntimeClass pod
+	// overhead memory in megabytes.
+	podOverheadMemoryAnnotationKey = "runtime.frakti.alpha.kubernetes.io/PodOverheadMemoryMB"
+	// terminationGracePeriodAnnotationKey carries the pod's termination
+	// grace period in seconds. CRI v1alpha1 passes no grace period to
+	// StopPodSandbox, so it is persisted in the sandbox checkpoint at
+	// create time instead.
+	terminationGracePeriodAnnotationKey = "runtime.frakti.alpha.kubernetes.io/TerminationGracePeriodSeconds"
+)
+
+// getPodOverhead reads the pod overhead annotations, returning the extra
+// vCPUs and megabytes of memory to add to the VM on top of the workload
+// sizing. Pods without the annotations get no overhead.
+func getPodOverhead(annotations map[string]string) (vcpu, memoryMB int32, err error) {
+	if value, ok := annotations[podOverheadCPUAnnotationKey]; ok {
+		milli, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || milli < 0 {
+			return 0, 0, fmt.Errorf("invalid pod overhead CPU %q: expected a non-negative number of milli-CPUs", value)
+		}
+		vcpu = int32((milli + 999) / 1000)
+	}
+	if value, ok := annotations[podOverheadMemoryAnnotationKey]; ok {
+		mb, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || mb < 0 {
+			return 0, 0, fmt.Errorf("invalid pod overhead memory %q: expected a non-negative number of megabytes", value)
+		}
+		memoryMB = int32(mb)
+	}
+	return vcpu, memoryMB, nil
+}
+
+// getTerminationGracePeriod reads the termination grace period annotation.
+// Pods without the annotation report zero, leaving the configured default
+// in effect at stop time.
+func getTerminationGracePeriod(annotations map[string]string) (int64, error) {
+	value, ok := annotations[terminationGracePeriodAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+	gracePeriod, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || gracePeriod < 0 {
+		return 0, fmt.Errorf("invalid termination grace period %q: expected a non-negative number of seconds", value)
+	}
+	return gracePeriod, nil
+}
+
+// getPodQoSClass derives the pod's QoS class from its cgroup parent, which
+// kubelet names after the class for Burstable and BestEffort pods.
+// Guaranteed pods (and pods without a cgroup parent) fall through to
+// Guaranteed, matching how the VM is sized from explicit limits.
+func getPodQoSClass(cgroupParent string) string {
+	parent := strings.ToLower(cgroupParent)
+	switch {
+	case strings.Contains(parent, strings.ToLower(string(v1.PodQOSBestEffort))):
+		return string(v1.PodQOSBestEffort)
+	case strings.Contains(parent, strings.ToLower(string(v1.PodQOSBurstable))):
+		return string(v1.PodQOSBurstable)
+	default:
+		return string(v1.PodQOSGuaranteed)
+	}
+}
+
+// buildPodHostname returns the hostname for the sandbox VM. It defaults to
+// the pod name when kubelet does not provide a hostname, and expands to the
+// FQDN when a subdomain is requested so that /etc/hostname and /etc/hosts
+// written by hyperd inside the VM match the pod's DNS identity.
+func buildPodHostname(config *kubeapi.PodSandboxConfig) string {
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname = config.GetMetadata().Name
+	}
+
+	subdomain := config.GetAnnotations()[podSubdomainAnnotationKey]
+	if subdomain != "" && !strings.Contains(hostname, ".") {
+		hostname = fmt.Sprintf("%s.%s", hostname, subdomain)
+	}
+
+	return hostname
+}
+
 // StopPodSandbox stops the sandbox. If there are any running containers in the
-// sandbox, they should be force terminated.
+// sandbox, they should be force terminated. Beyond stopping the VM it tears
+// down all per-sandbox resources in order: the relay bridges, the CNI
+// network, the network namespace and the persisted checkpoint. Steps whose
+// resources are already gone are skipped, so kubelet may safely call it
+// repeatedly.
 func (h *Runtime) StopPodSandbox(podSandboxID string) error {
+	// The pod is going away, abort any of its in-flight image pre-pulls.
+	h.cancelPodPulls(podSandboxID)
+
 	// Get the pod's net ns info first
 	var netNsPath string
 	var hostBridge string
@@ -256,61 +510,96 @@ func (h *Runtime) StopPodSandbox(podSandboxID string) error {
 		hostBridge = checkpoint.HostBridge
 	}
 
-	// Get portMappings from checkpoint.
-	portMappingsParam := make([]cniPortMapping, 0)
-	if checkpoint != nil {
-		for _, p := range checkpoint.Data.PortMappings {
-			if p.HostPort == nil || *p.HostPort == 0 {
-				continue
-			}
+	// Neither hyperd nor the checkpoint know the sandbox anymore: an
+	// earlier stop already tore everything down, so a repeated stop is
+	// a no-op rather than an error.
+	if statusErr != nil && checkpoint == nil {
+		glog.V(3).Infof("Nothing left to stop for sandbox %q, assuming it is already stopped", podSandboxID)
+		return nil
+	}
 
-			portMappingsParam = append(portMappingsParam, cniPortMapping{
-				HostPort:      *p.HostPort,
-				ContainerPort: *p.ContainerPort,
-				Protocol:      strings.ToLower(string(*p.Protocol)),
-			})
+	// The netns is removed as the last network teardown step, so its
+	// absence means the network of this sandbox was already released and
+	// those steps can be skipped on a repeated stop.
+	networkTorndown := netNsPath == ""
+	if netNsPath != "" {
+		if _, statErr := os.Stat(netNsPath); os.IsNotExist(statErr) {
+			networkTorndown = true
 		}
 	}
+
+	// Get portMappings from checkpoint.
+	portMappingsParam := checkpointCNIPortMappings(checkpoint)
 	capabilities := map[string]interface{}{
 		"portMappings": portMappingsParam,
 	}
 
-	// 1: stop the sandbox.
+	// 1: stop the pod's containers with the pod's termination grace
+	// period, persisted at create time; hyperd's pod stop alone would not
+	// give them their full SIGTERM window. Per-container failures are
+	// only logged, the pod stop below takes whatever is left down anyway.
+	gracePeriod := h.stopContainerGracePeriod
+	if checkpoint != nil && checkpoint.Data != nil && checkpoint.Data.TerminationGracePeriod > 0 {
+		gracePeriod = checkpoint.Data.TerminationGracePeriod
+	}
+	if containers, err := h.client.GetContainerList(); err != nil {
+		glog.Warningf("Get container list for sandbox %s failed: %v", podSandboxID, err)
+	} else {
+		for _, c := range containers {
+			if c.PodID != podSandboxID {
+				continue
+			}
+			if err := h.client.StopContainer(c.ContainerID, gracePeriod); err != nil {
+				glog.Warningf("Stop container %s of sandbox %s failed: %v", c.ContainerID, podSandboxID, err)
+			}
+		}
+	}
+
+	// 2: stop the sandbox.
 	code, cause, err := h.client.StopPod(podSandboxID)
 	if err != nil && !isPodNotFoundError(err, podSandboxID) {
 		return fmt.Errorf("error of stopping sandbox %q, code: %d, cause: %q, error: %v", podSandboxID, code, cause, err)
 	}
 
-	// 2: teardown relay bridge inside netns.
-	if checkpoint != nil {
-		err = teardownRelayBridgeInNetns(netNsPath, checkpoint.Data.Interfaces)
+	if !networkTorndown {
+		// 3: teardown relay bridge inside netns. No recorded interfaces
+		// means no relay bridge was ever set up.
+		if checkpoint != nil && checkpoint.Data != nil && len(checkpoint.Data.Interfaces) > 0 {
+			err = teardownRelayBridgeInNetns(netNsPath, checkpoint.Data.Interfaces)
+			if err != nil {
+				return fmt.Errorf("error of teardown relay bridge inside netns %q: %v", netNsPath, err)
+			}
+		}
+
+		// 4: tear down the host relay bridge.
+		err = teardownRelayBridgeInHost(hostBridge)
 		if err != nil {
-			return fmt.Errorf("error of teardown relay bridge inside netns %q: %v", netNsPath, err)
+			return fmt.Errorf("error of teardown relay bridge for sandbox %q: %v", podSandboxID, err)
 		}
-	}
 
-	// 3: tear down the host relay bridge.
-	err = teardownRelayBridgeInHost(hostBridge)
-	if err != nil {
-		return fmt.Errorf("error of teardown relay bridge for sandbox %q: %v", podSandboxID, err)
-	}
+		// 5: tear down the cni network.
+		sandboxID := podSandboxID
+		// workaroud for weave network plugin because it creates a veth pair based on a truncated sandboxID.
+		if h.netPlugin.Name() == "weave" {
+			sandboxID = getMD5Hash(podSandboxID)
+		}
+		err = h.netPlugin.TearDownPod(netNsPath, sandboxID, status.GetMetadata(), status.GetAnnotations(), capabilities)
+		if err != nil {
+			return fmt.Errorf("error of teardown network for sandbox %q: %v", podSandboxID, err)
+		}
 
-	// 4: tear down the cni network.
-	sandboxID := podSandboxID
-	// workaroud for weave network plugin because it creates a veth pair based on a truncated sandboxID.
-	if h.netPlugin.Name() == "weave" {
-		sandboxID = getMD5Hash(podSandboxID)
-	}
-	err = h.netPlugin.TearDownPod(netNsPath, sandboxID, status.GetMetadata(), status.GetAnnotations(), capabilities)
-	if err != nil {
-		return fmt.Errorf("error of teardown network for sandbox %q: %v", podSandboxID, err)
-	}
+		// 6: umount and remove the netns.
+		unix.Unmount(netNsPath, unix.MNT_DETACH)
+		os.Remove(netNsPath)
 
-	// 5: umount and remove the netns.
-	unix.Unmount(netNsPath, unix.MNT_DETACH)
-	os.Remove(netNsPath)
+		// 7: verify nothing was left behind; a CNI DEL can partially
+		// fail without reporting an error.
+		if err := verifyNetworkCleanup(netNsPath, hostBridge); err != nil {
+			return fmt.Errorf("network cleanup of sandbox %q left residue: %v", podSandboxID, err)
+		}
+	}
 
-	// 6: remove the checkpoint.
+	// 8: remove the checkpoint.
 	err = h.checkpointHandler.RemoveCheckpoint(podSandboxID)
 	if err != nil {
 		return fmt.Errorf("error of removing checkpoint for sandbox %q: %v", podSandboxID, err)
@@ -322,6 +611,29 @@ func (h *Runtime) StopPodSandbox(podSandboxID string) error {
 // RemovePodSandbox deletes the sandbox. If there are any running containers in the
 // sandbox, they should be force deleted.
 func (h *Runtime) RemovePodSandbox(podSandboxID string) error {
+	h.cancelPodPulls(podSandboxID)
+
+	// Stop and remove the pod's containers individually first, so one
+	// wedged container does not fail hyperd's cascading pod removal and
+	// leak the whole pod. Per-container failures are only logged; the pod
+	// removal below gets a chance to clean up whatever is left.
+	if containers, err := h.client.GetContainerList(); err != nil {
+		glog.Warningf("Get container list for sandbox %s failed: %v", podSandboxID, err)
+	} else {
+		for _, c := range containers {
+			if c.PodID != podSandboxID {
+				continue
+			}
+			if err := h.client.StopContainer(c.ContainerID, h.stopContainerGracePeriod); err != nil {
+				glog.Warningf("Stop container %s of sandbox %s failed: %v", c.ContainerID, podSandboxID, err)
+			}
+			if err := h.client.RemoveContainer(c.ContainerID); err != nil {
+				glog.Warningf("Remove container %s of sandbox %s failed: %v", c.ContainerID, podSandboxID, err)
+			}
+			h.containerLabels.Remove(c.ContainerID)
+		}
+	}
+
 	err := h.client.RemovePod(podSandboxID)
 	if err != nil {
 		glog.Errorf("Remove pod %s failed: %v", podSandboxID, err)
@@ -333,6 +645,10 @@ func (h *Runtime) RemovePodSandbox(podSandboxID string) error {
 		return err
 	}
 
+	h.sandboxLabels.Remove(podSandboxID)
+	h.specSnapshots.forget(podSandboxID)
+	h.withheldAnnotations.forget(podSandboxID)
+	h.reservations.forgetPod(podSandboxID)
 	return nil
 }
 
@@ -344,10 +660,16 @@ func (h *Runtime) PodSandboxStatus(podSandboxID string) (*kubeapi.PodSandboxStat
 		return nil, err
 	}
 
-	state := toPodSandboxState(info.Status.Phase)
-	podIP := ""
-	if len(info.Status.PodIP) > 0 {
-		podIP = info.Status.PodIP[0]
+	// hyperd may return a partially-populated PodInfo while a pod is being
+	// set up or torn down. Treat a missing status or spec as NOTREADY with
+	// whatever fields are available instead of crashing on a nil pointer.
+	state := kubeapi.PodSandboxState_SANDBOX_NOTREADY
+	var podIP string
+	if info.Status != nil {
+		state = toPodSandboxState(info.Status.Phase)
+		podIP = toKubePodIP(info.Status.PodIP)
+	} else {
+		glog.Warningf("PodInfo of sandbox %s has no status, reporting it NOTREADY", podSandboxID)
 	}
 
 	podName, podNamespace, podUID, attempt, err := parseSandboxName(info.PodName)
@@ -363,8 +685,40 @@ func (h *Runtime) PodSandboxStatus(podSandboxID string) (*kubeapi.PodSandboxStat
 		Attempt:   attempt,
 	}
 
-	annotations := getAnnotationsFromLabels(info.Spec.Labels)
-	kubeletLabels := getKubeletLabels(info.Spec.Labels)
+	var specLabels map[string]string
+	if info.Spec != nil {
+		specLabels = info.Spec.Labels
+	} else {
+		glog.Warningf("PodInfo of sandbox %s has no spec, labels and annotations will be empty", podSandboxID)
+	}
+	annotations := getAnnotationsFromLabels(specLabels)
+	annotations = h.withheldAnnotations.mergeInto(podSandboxID, annotations)
+	// The sandbox state only reflects the VM, so expose a per-container
+	// summary for tooling that needs to spot READY sandboxes whose
+	// containers have all crashed.
+	if total := len(info.Status.GetContainerStatus()); total > 0 {
+		running := 0
+		for _, cs := range info.Status.GetContainerStatus() {
+			if cs.Phase == "running" {
+				running++
+			}
+		}
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[containerSummaryAnnotationKey] = fmt.Sprintf("%d/%d containers running", running, total)
+	}
+	// Expose the hyperd-side identity for traceability. The namespaced keys
+	// keep these clear of user annotations.
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[hyperdPodIDAnnotationKey] = info.PodID
+	if info.Vm != "" {
+		annotations[hyperdVMIDAnnotationKey] = info.Vm
+	}
+
+	kubeletLabels := getKubeletLabels(specLabels)
 	createdAtNano := info.CreatedAt * secondToNano
 	podStatus := &kubeapi.PodSandboxStatus{
 		Id:          podSandboxID,
@@ -402,8 +756,17 @@ func (h *Runtime) ListPodSandbox(filter *kubeapi.PodSandboxFilter) ([]*kubeapi.P
 				continue
 			}
 
-			if filter.LabelSelector != nil && !inMap(filter.LabelSelector, pod.Labels) {
-				continue
+			if filter.LabelSelector != nil {
+				// Answer from the label index when possible, scan the
+				// reported labels for sandboxes unknown to it (e.g.
+				// created before a frakti restart).
+				if match, known := h.sandboxLabels.Matches(pod.PodID, filter.LabelSelector); known {
+					if !match {
+						continue
+					}
+				} else if !inMap(filter.LabelSelector, pod.Labels) {
+					continue
+				}
 			}
 		}
 		converted, err := podResultToKubeAPISandbox(pod)
@@ -436,18 +799,23 @@ func (h *Runtime) ListPodSandbox(filter *kubeapi.PodSandboxFilter) ([]*kubeapi.P
 	return items, nil
 }
 
-func constructPodSandboxCheckpoint(config *kubeapi.PodSandboxConfig, netnspath, hostBridge string, interfaces []*containerInterface) *PodSandboxCheckpoint {
+func constructPodSandboxCheckpoint(config *kubeapi.PodSandboxConfig, netnspath, hostBridge string, interfaces []*containerInterface, terminationGracePeriod int64) *PodSandboxCheckpoint {
 	checkpoint := NewPodSandboxCheckpoint(config.GetMetadata().Namespace, config.GetMetadata().Name)
 	checkpoint.NetNsPath = netnspath
 	checkpoint.HostBridge = hostBridge
 	checkpoint.Data.Interfaces = toContainerInterfaceInfos(interfaces)
+	checkpoint.Data.TerminationGracePeriod = terminationGracePeriod
 	for _, pm := range config.GetPortMappings() {
 		proto := toCheckpointProtocol(pm.Protocol)
-		checkpoint.Data.PortMappings = append(checkpoint.Data.PortMappings, &PortMapping{
+		mapping := &PortMapping{
 			HostPort:      &pm.HostPort,
 			ContainerPort: &pm.ContainerPort,
 			Protocol:      &proto,
-		})
+		}
+		if pm.HostIp != "" {
+			mapping.HostIp = &pm.HostIp
+		}
+		checkpoint.Data.PortMappings = append(checkpoint.Data.PortMappings, mapping)
 	}
 
 	return checkpoint
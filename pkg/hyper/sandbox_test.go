@@ -18,10 +18,18 @@ package hyper
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
+	cnitypes "github.com/containernetworking/cni/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/frakti/pkg/hyper/types"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
 )
 
@@ -56,9 +64,355 @@ func newTestRuntimeWithCheckpoint() (*Runtime, *fakeClientInterface, CheckpointH
 	return &Runtime{
 		client:            client,
 		checkpointHandler: checkpointHandler,
+		sandboxLabels:     newLabelIndex(),
+		containerLabels:   newLabelIndex(),
 	}, publicClient, checkpointHandler
 }
 
+func TestStartPodBootTimeout(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.startHold = make(chan struct{})
+
+	// A boot that overruns the timeout fails with DeadlineExceeded and a
+	// message naming the budget, instead of a generic context error.
+	err := r.client.StartPod("p*0", 50*time.Millisecond)
+	assert.Error(t, err)
+	assert.Equal(t, codes.DeadlineExceeded, grpc.Code(err))
+	assert.Contains(t, err.Error(), "did not boot within")
+
+	// A released boot within the budget succeeds.
+	close(fakeClient.startHold)
+	assert.NoError(t, r.client.StartPod("p*0", time.Second))
+}
+
+func TestBuildUserPodWithCgroupParent(t *testing.T) {
+	r := &Runtime{
+		defaultCPUNum:   1,
+		defaultMemoryMB: 64,
+	}
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	// BestEffort pods skip the cgroup based resource calculation.
+	cgroupParent := "/kubepods/BestEffort/pod123"
+	config.Linux = &kubeapi.LinuxPodSandboxConfig{
+		CgroupParent: cgroupParent,
+	}
+
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, cgroupParent, spec.Labels[cgroupParentLabelKey])
+	assert.Equal(t, r.defaultCPUNum, spec.Resource.Vcpu)
+	assert.Equal(t, r.defaultMemoryMB, spec.Resource.Memory)
+}
+
+func TestBuildPodHostname(t *testing.T) {
+	// Hostname without a subdomain is used as is.
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	config.Hostname = "foo-host"
+	assert.Equal(t, "foo-host", buildPodHostname(config))
+
+	// Hostname defaults to the pod name when unset.
+	config.Hostname = ""
+	assert.Equal(t, "foo", buildPodHostname(config))
+
+	// A subdomain expands the hostname to the FQDN.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{podSubdomainAnnotationKey: "subdomain"})
+	config.Hostname = "foo-host"
+	assert.Equal(t, "foo-host.subdomain", buildPodHostname(config))
+}
+
+func TestBuildUserPodDefaultDNS(t *testing.T) {
+	r := &Runtime{
+		defaultCPUNum:   1,
+		defaultMemoryMB: 64,
+		defaultDNS:      []string{"8.8.8.8", "8.8.4.4"},
+	}
+
+	// A pod without DNS config gets the configured default servers.
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, r.defaultDNS, spec.Dns)
+
+	// A DNS config without servers falls back as well.
+	config.DnsConfig = &kubeapi.DNSConfig{Searches: []string{"cluster.local"}}
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, r.defaultDNS, spec.Dns)
+	assert.Equal(t, []string{"cluster.local"}, spec.DnsSearch)
+
+	// Servers from the pod config always win.
+	config.DnsConfig = &kubeapi.DNSConfig{Servers: []string{"10.0.0.10"}}
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.10"}, spec.Dns)
+
+	// Without a configured default the spec is left untouched.
+	r.defaultDNS = nil
+	config.DnsConfig = nil
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Empty(t, spec.Dns)
+}
+
+// hangingCNIPlugin blocks in SetUpPod until the test finishes.
+type hangingCNIPlugin struct {
+	fakeCNIPlugin
+	release chan struct{}
+}
+
+func (f *hangingCNIPlugin) SetUpPod(podNetnsPath string, podID string, metadata *kubeapi.PodSandboxMetadata, annotations map[string]string, capabilities map[string]interface{}) (cnitypes.Result, error) {
+	<-f.release
+	return nil, nil
+}
+
+func TestSetUpPodNetworkTimeout(t *testing.T) {
+	plugin := &hangingCNIPlugin{release: make(chan struct{})}
+	defer close(plugin.release)
+	r := &Runtime{
+		netPlugin:  plugin,
+		cniTimeout: 10 * time.Millisecond,
+	}
+
+	_, err := r.setUpPodNetwork("/var/run/netns/test", "sandboxid", nil, nil, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "did not finish")
+}
+
+func TestRunPodSandboxDryRun(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	r.dryRun = true
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{"app": "web"}, map[string]string{})
+
+	podID, err := r.RunPodSandbox(config)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(podID, "dryrun-"))
+
+	// Nothing was created in hyperd, but the internal state knows the
+	// synthetic sandbox.
+	assert.NotContains(t, fakeClient.called, "PodCreate")
+	assert.NotContains(t, fakeClient.called, "PodStart")
+	match, known := r.sandboxLabels.Matches(podID, map[string]string{"app": "web"})
+	assert.True(t, known)
+	assert.True(t, match)
+
+	// Validation still applies in dry-run mode.
+	badConfig := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{"kubernetes.io/ingress-bandwidth": "bogus"})
+	_, err = r.RunPodSandbox(badConfig)
+	assert.Error(t, err)
+}
+
+func TestRunPodSandboxWithInvalidBandwidth(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{}, map[string]string{"kubernetes.io/ingress-bandwidth": "bogus"})
+
+	_, err := r.RunPodSandbox(config)
+	assert.Error(t, err)
+}
+
+// recordingCNIPlugin records which pods had their network torn down.
+type recordingCNIPlugin struct {
+	fakeCNIPlugin
+	tornDown []string
+}
+
+func (f *recordingCNIPlugin) TearDownPod(podNetnsPath string, podID string, metadata *kubeapi.PodSandboxMetadata, annotations map[string]string, capabilities map[string]interface{}) error {
+	f.tornDown = append(f.tornDown, podID)
+	return nil
+}
+
+func TestStopPodSandboxTeardown(t *testing.T) {
+	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
+	plugin := &recordingCNIPlugin{}
+	r.netPlugin = plugin
+
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+
+	// A plain file stands in for the bind-mounted netns.
+	netns, err := ioutil.TempFile("", "frakti-netns")
+	assert.NoError(t, err)
+	netnsPath := netns.Name()
+	netns.Close()
+	defer os.Remove(netnsPath)
+
+	checkpoint := NewPodSandboxCheckpoint("bar", "foo")
+	checkpoint.NetNsPath = netnsPath
+	checkpoint.HostBridge = "frakti-none0"
+	assert.NoError(t, checkpointHandler.CreateCheckpoint(podID, checkpoint))
+
+	// The stop tears down the VM, the CNI network, the netns and the
+	// persisted checkpoint.
+	err = r.StopPodSandbox(podID)
+	assert.NoError(t, err)
+	assert.Contains(t, fakeClient.called, "PodStop")
+	assert.Equal(t, []string{podID}, plugin.tornDown)
+	_, err = os.Stat(netnsPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = checkpointHandler.GetCheckpoint(podID)
+	assert.Error(t, err)
+
+	// A repeated stop is a no-op instead of an error.
+	err = r.StopPodSandbox(podID)
+	assert.NoError(t, err)
+	assert.Len(t, plugin.tornDown, 1)
+}
+
+func TestStopPodSandboxUsesStoredGracePeriod(t *testing.T) {
+	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
+	fakeClient.Clock = clock.NewFakeClock(time.Time{})
+	r.stopContainerGracePeriod = defaultStopContainerGracePeriod
+
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	_, err := r.CreateContainer(podID, config, sConfig)
+	assert.NoError(t, err)
+
+	checkpoint := NewPodSandboxCheckpoint("bar", "foo")
+	checkpoint.Data.TerminationGracePeriod = 33
+	assert.NoError(t, checkpointHandler.CreateCheckpoint(podID, checkpoint))
+
+	// The stop gives the container the grace period recorded at create
+	// time rather than the global default.
+	err = r.StopPodSandbox(podID)
+	assert.NoError(t, err)
+	assert.Contains(t, fakeClient.called, "ContainerStop")
+	assert.Equal(t, int64(33), fakeClient.stopTimeout)
+}
+
+func TestPodSandboxStatusContainerSummary(t *testing.T) {
+	r, fakeClient, _ := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+	// All containers inside the pod have failed.
+	fakeClient.podInfoMap[podID].Status.ContainerStatus = []*types.ContainerStatus{
+		{ContainerID: "c*0", Phase: "failed"},
+		{ContainerID: "c*1", Phase: "failed"},
+	}
+
+	status, err := r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	// The sandbox stays READY, per CRI semantics the state only reflects
+	// the VM; the crashed containers show up in the summary annotation.
+	assert.Equal(t, kubeapi.PodSandboxState_SANDBOX_READY, status.State)
+	assert.Equal(t, "0/2 containers running", status.Annotations[containerSummaryAnnotationKey])
+
+	// One container recovering is reflected as well.
+	fakeClient.podInfoMap[podID].Status.ContainerStatus[0].Phase = "running"
+	status, err = r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1/2 containers running", status.Annotations[containerSummaryAnnotationKey])
+}
+
+func TestPodSandboxStatusPartialPodInfo(t *testing.T) {
+	r, fakeClient, _ := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+
+	// hyperd may report a pod without a status while it is being set up or
+	// torn down; it is surfaced as NOTREADY instead of crashing.
+	fakeClient.podInfoMap[podID].Status = nil
+	status, err := r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, kubeapi.PodSandboxState_SANDBOX_NOTREADY, status.State)
+	assert.Equal(t, "", status.Network.Ip)
+
+	// A missing spec only loses labels and annotations.
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+	fakeClient.podInfoMap[podID].Spec = nil
+	status, err = r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, kubeapi.PodSandboxState_SANDBOX_READY, status.State)
+	assert.Empty(t, status.Labels)
+}
+
+func TestPodSandboxStatusHyperdIDs(t *testing.T) {
+	r, fakeClient, _ := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+	fakeClient.podInfoMap[podID].Vm = "vm-deadbeef"
+
+	status, err := r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, podID, status.Annotations[hyperdPodIDAnnotationKey])
+	assert.Equal(t, "vm-deadbeef", status.Annotations[hyperdVMIDAnnotationKey])
+}
+
+func TestRemovePodSandboxWithStuckContainer(t *testing.T) {
+	r, fakeClient, _ := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+	fakeClient.SetFakeContainers([]*FakeContainer{
+		{ID: "c*1", Name: "k8s_one_foo_bar_p*0_1", PodID: podID, Status: "failed"},
+		{ID: "c*2", Name: "k8s_two_foo_bar_p*0_1", PodID: podID, Status: "failed"},
+	})
+	// One container is wedged and refuses to be removed; the teardown
+	// still removes the rest and the pod itself.
+	fakeClient.removeContainerErrors = map[string]error{"c*1": fmt.Errorf("device busy")}
+
+	err := r.RemovePodSandbox(podID)
+	assert.NoError(t, err)
+	assert.Contains(t, fakeClient.called, "ContainerRemove")
+	assert.Contains(t, fakeClient.called, "PodRemove")
+	_, stillThere := fakeClient.containerInfoMap["c*2"]
+	assert.False(t, stillThere)
+	_, podThere := fakeClient.podInfoMap[podID]
+	assert.False(t, podThere)
+}
+
+func TestGetPodQoSClass(t *testing.T) {
+	assert.Equal(t, "BestEffort", getPodQoSClass("/kubepods/besteffort/pod123"))
+	assert.Equal(t, "Burstable", getPodQoSClass("kubepods-burstable-pod123.slice"))
+	assert.Equal(t, "Guaranteed", getPodQoSClass("/kubepods/pod123"))
+	assert.Equal(t, "Guaranteed", getPodQoSClass(""))
+}
+
+func TestBuildUserPodQoSLabel(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "Guaranteed", spec.Labels[qosClassLabelKey])
+
+	// The label is internal bookkeeping and must not surface in the
+	// kubelet-visible labels.
+	assert.NotContains(t, getKubeletLabels(spec.Labels), qosClassLabelKey)
+}
+
 func TestListPodSandbox(t *testing.T) {
 	r, fakeClient, checkpointHandler := newTestRuntimeWithCheckpoint()
 	podId, checkPoint := "p", "c"
@@ -101,11 +455,13 @@ func TestListPodSandbox(t *testing.T) {
 		}
 		network := &kubeapi.PodSandboxNetworkStatus{Ip: ""}
 		expected := &kubeapi.PodSandboxStatus{
-			Id:          podID,
-			State:       kubeapi.PodSandboxState_SANDBOX_READY,
-			Metadata:    metadata,
-			Network:     network,
-			Annotations: make(map[string]string),
+			Id:       podID,
+			State:    kubeapi.PodSandboxState_SANDBOX_READY,
+			Metadata: metadata,
+			Network:  network,
+			Annotations: map[string]string{
+				hyperdPodIDAnnotationKey: podID,
+			},
 		}
 		assert.Equal(t, expected, podStatus)
 		assert.NoError(t, err)
@@ -134,7 +490,7 @@ func TestListPodSandbox(t *testing.T) {
 		}
 
 		podSandbox := kubeapi.PodSandbox{
-			Id:       "",
+			Id:       podID,
 			Metadata: metadata,
 			State:    kubeapi.PodSandboxState_SANDBOX_READY,
 		}
@@ -150,3 +506,67 @@ func TestListPodSandbox(t *testing.T) {
 	assert.Len(t, podsList, 2)
 	assert.Len(t, fakeClient.podInfoMap, 2)
 }
+
+func TestBuildUserPodHostAliases(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	config := makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{
+			hostAliasesAnnotationKey: `[` +
+				`{"ip":"10.1.2.3","hostnames":["foo.local","bar.local"]},` +
+				`{"ip":"10.1.2.3","hostnames":["baz.local"]},` +
+				`{"ip":"10.4.5.6","hostnames":["qux.local"]}]`,
+		},
+	)
+
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Len(t, spec.Files, 1)
+	content := spec.Files[0].Content
+	// Aliases sharing an IP end up merged onto a single hosts line.
+	assert.Contains(t, content, "10.1.2.3\tfoo.local bar.local baz.local\n")
+	assert.Contains(t, content, "10.4.5.6\tqux.local\n")
+
+	// A malformed annotation fails the sandbox up front.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{hostAliasesAnnotationKey: `[{"hostnames":["no-ip.local"]}]`},
+	)
+	_, err = r.buildUserPod(config)
+	assert.Error(t, err)
+}
+
+func TestBuildUserPodOverhead(t *testing.T) {
+	r, _, _ := newTestRuntime()
+	r.defaultCPUNum = 1
+	r.defaultMemoryMB = 64
+
+	// Without the annotations the VM gets the plain workload sizing.
+	config := makeSandboxConfig("foo", "bar", "1", 0)
+	spec, err := r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), spec.Resource.Vcpu)
+	assert.Equal(t, int32(64), spec.Resource.Memory)
+
+	// The overhead is added on top; 250m of CPU overhead is rounded up
+	// to a whole vCPU.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{
+			podOverheadCPUAnnotationKey:    "250",
+			podOverheadMemoryAnnotationKey: "128",
+		},
+	)
+	spec, err = r.buildUserPod(config)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), spec.Resource.Vcpu)
+	assert.Equal(t, int32(192), spec.Resource.Memory)
+
+	// Malformed overhead values are rejected instead of ignored.
+	config = makeSandboxConfigWithLabelsAndAnnotations("foo", "bar", "1", 0,
+		map[string]string{},
+		map[string]string{podOverheadMemoryAnnotationKey: "lots"},
+	)
+	_, err = r.buildUserPod(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+const (
+	// specSnapshotRedacted replaces values that must not leak out of the
+	// process, like credentials passed through environment variables.
+	specSnapshotRedacted = "*REDACTED*"
+)
+
+// specSnapshots remembers, per hyperd pod or container ID, the redacted
+// JSON of the spec frakti last sent to hyperd, so an operator debugging a
+// misbehaving pod can see the exact translation instead of reconstructing
+// it from the CRI config. The snapshots are served read-only by the debug
+// endpoint and stay off the CRI status, which kubelet consumes. The zero
+// value is ready to use.
+type specSnapshots struct {
+	sync.Mutex
+	specs map[string]string
+}
+
+// record stores the snapshot for id. Marshal failures only lose the
+// snapshot, never the pod or container.
+func (s *specSnapshots) record(id string, spec interface{}) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		glog.Warningf("Marshal spec snapshot of %s failed: %v", id, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.specs == nil {
+		s.specs = make(map[string]string)
+	}
+	s.specs[id] = string(data)
+}
+
+// get returns the recorded snapshot for id, or "" when there is none,
+// e.g. for pods created by an older frakti before a restart.
+func (s *specSnapshots) get(id string) string {
+	s.Lock()
+	defer s.Unlock()
+	return s.specs[id]
+}
+
+// forget drops the snapshot of a removed pod or container.
+func (s *specSnapshots) forget(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.specs, id)
+}
+
+// redactUserPod returns a copy of spec safe to expose on the debug
+// endpoint: the containers are redacted like redactUserContainer does. The
+// original spec is left untouched.
+func redactUserPod(spec *types.UserPod) *types.UserPod {
+	redacted := *spec
+	if len(spec.Containers) > 0 {
+		redacted.Containers = make([]*types.UserContainer, len(spec.Containers))
+		for i, c := range spec.Containers {
+			redacted.Containers[i] = redactUserContainer(c)
+		}
+	}
+	return &redacted
+}
+
+// redactUserContainer returns a copy of c with the values of
+// sensitive-looking environment variables replaced, so secrets injected
+// through the env do not leak out of the debug endpoint. The variable
+// names stay visible. The original spec is left untouched.
+func redactUserContainer(c *types.UserContainer) *types.UserContainer {
+	redacted := *c
+	if len(c.Envs) > 0 {
+		redacted.Envs = make([]*types.EnvironmentVar, len(c.Envs))
+		for i, env := range c.Envs {
+			e := *env
+			if isSensitiveEnvName(e.Env) {
+				e.Value = specSnapshotRedacted
+			}
+			redacted.Envs[i] = &e
+		}
+	}
+	return &redacted
+}
+
+// isSensitiveEnvName guesses whether an environment variable holds a
+// credential, erring on the side of redacting too much: a hidden value is
+// an inconvenience, a leaked one an incident.
+func isSensitiveEnvName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, marker := range []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "CREDENTIAL", "AUTH", "KEY"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
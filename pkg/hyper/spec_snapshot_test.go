@@ -0,0 +1,99 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestContainerSpecSnapshot(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Envs = []*kubeapi.KeyValue{
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "DB_PASSWORD", Value: "hunter2"},
+	}
+
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+	fakeClient.SetFakePod([]*FakePod{{PodID: sandboxID}})
+
+	// The recorded snapshot carries the spec sent to hyperd; ordinary env
+	// values stay visible, credential-looking ones are redacted.
+	snapshot := r.specSnapshots.get(containerID)
+	assert.Contains(t, snapshot, "LOG_LEVEL")
+	assert.Contains(t, snapshot, "debug")
+	assert.Contains(t, snapshot, "DB_PASSWORD")
+	assert.NotContains(t, snapshot, "hunter2")
+	assert.Contains(t, snapshot, specSnapshotRedacted)
+
+	// The snapshot stays off the CRI status; it is only served by the
+	// debug endpoint.
+	status, err := r.ContainerStatus(containerID)
+	assert.NoError(t, err)
+	assert.NotContains(t, status.Annotations, "snapshot.frakti.alpha.kubernetes.io/spec")
+
+	// The snapshot is dropped together with the container.
+	err = r.RemoveContainer(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", r.specSnapshots.get(containerID))
+}
+
+func TestPodSandboxSpecSnapshot(t *testing.T) {
+	r, fakeClient, _ := newTestRuntimeWithCheckpoint()
+	podID := "p*0"
+	fakeClient.SetFakePod([]*FakePod{{
+		PodID:   podID,
+		PodName: "k8s_POD_foo_bar_p*0_1",
+		Status:  "Running",
+	}})
+
+	spec := &types.UserPod{
+		Id:       podID,
+		Hostname: "foo",
+		Containers: []*types.UserContainer{{
+			Name: "app",
+			Envs: []*types.EnvironmentVar{{Env: "API_TOKEN", Value: "s3cr3t"}},
+		}},
+	}
+	r.specSnapshots.record(podID, redactUserPod(spec))
+
+	snapshot := r.specSnapshots.get(podID)
+	assert.Contains(t, snapshot, "foo")
+	assert.Contains(t, snapshot, "API_TOKEN")
+	assert.NotContains(t, snapshot, "s3cr3t")
+	// Redaction works on a copy, the spec itself is untouched.
+	assert.Equal(t, "s3cr3t", spec.Containers[0].Envs[0].Value)
+
+	// The snapshot stays off the CRI status; it is only served by the
+	// debug endpoint.
+	status, err := r.PodSandboxStatus(podID)
+	assert.NoError(t, err)
+	assert.NotContains(t, status.Annotations, "snapshot.frakti.alpha.kubernetes.io/spec")
+
+	// Removing the sandbox drops the snapshot.
+	err = r.RemovePodSandbox(podID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", r.specSnapshots.get(podID))
+}
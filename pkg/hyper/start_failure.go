@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// containerStartFailureCause digs the underlying reason of a failed start
+// out of hyperd's container status: a terminated status carries the exit
+// reason, a waiting status why it never got going, and failing both the pod
+// status may know why the VM is unhealthy. Best-effort: when the status
+// cannot be fetched it returns empty and the original error stands alone.
+func (h *Runtime) containerStartFailureCause(containerID string) string {
+	info, err := h.client.GetContainerInfo(containerID)
+	if err != nil {
+		return ""
+	}
+
+	if cause := describeContainerFailure(info.Status); cause != "" {
+		return cause
+	}
+	return h.podStartFailureCause(info.PodID)
+}
+
+// podStartFailureCause extracts the failure reason hyperd records in the
+// pod status, e.g. when the VM itself failed to boot.
+func (h *Runtime) podStartFailureCause(podID string) string {
+	podInfo, err := h.client.GetPodInfo(podID)
+	if err != nil || podInfo.Status == nil {
+		return ""
+	}
+
+	status := podInfo.Status
+	switch {
+	case status.Reason != "" && status.Message != "":
+		return fmt.Sprintf("pod %s: %s", status.Reason, status.Message)
+	case status.Reason != "":
+		return fmt.Sprintf("pod %s", status.Reason)
+	case status.Message != "":
+		return fmt.Sprintf("pod %s", status.Message)
+	}
+	return ""
+}
+
+func describeContainerFailure(status *types.ContainerStatus) string {
+	if status == nil {
+		return ""
+	}
+
+	if terminated := status.Terminated; terminated != nil {
+		switch {
+		case terminated.Reason != "" && terminated.Message != "":
+			return fmt.Sprintf("terminated: %s: %s (exit code %d)", terminated.Reason, terminated.Message, terminated.ExitCode)
+		case terminated.Reason != "":
+			return fmt.Sprintf("terminated: %s (exit code %d)", terminated.Reason, terminated.ExitCode)
+		case terminated.Message != "":
+			return fmt.Sprintf("terminated: %s (exit code %d)", terminated.Message, terminated.ExitCode)
+		}
+	}
+	if waiting := status.Waiting; waiting != nil && waiting.Reason != "" {
+		return fmt.Sprintf("waiting: %s", waiting.Reason)
+	}
+	return ""
+}
+
+// withStartFailureCause annotates a failed start's error with the cause
+// when one could be extracted, so kubelet events show the real reason
+// instead of a bare RPC error.
+func withStartFailureCause(err error, cause string) error {
+	if cause == "" {
+		return err
+	}
+	return fmt.Errorf("%v (caused by %s)", err, cause)
+}
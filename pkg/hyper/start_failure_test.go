@@ -0,0 +1,72 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestStartContainerSurfacesCause(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	containerID, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// The container died right after the failed start; its terminated
+	// status carries the reason kubelet should see.
+	fakeClient.Lock()
+	fakeClient.startContainerErrors = map[string]error{containerID: errors.New("rpc error")}
+	fakeClient.containerInfoMap[containerID].Status.Phase = "failed"
+	fakeClient.containerInfoMap[containerID].Status.Running = nil
+	fakeClient.containerInfoMap[containerID].Status.Terminated = &types.TermStatus{
+		Reason:   "OOMKilled",
+		ExitCode: 137,
+	}
+	fakeClient.Unlock()
+
+	err = r.StartContainer(containerID)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rpc error")
+	assert.Contains(t, err.Error(), "OOMKilled")
+	assert.Contains(t, err.Error(), "exit code 137")
+
+	// Without a container-level reason the pod status is consulted, e.g.
+	// when the VM itself is unhealthy.
+	fakeClient.Lock()
+	fakeClient.containerInfoMap[containerID].Status.Terminated = nil
+	fakeClient.podInfoMap["sandboxid"].Status.Reason = "VMBootFailed"
+	fakeClient.Unlock()
+
+	err = r.StartContainer(containerID)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pod VMBootFailed")
+
+	// When no cause can be extracted the original error stands alone.
+	fakeClient.Lock()
+	fakeClient.podInfoMap["sandboxid"].Status.Reason = ""
+	fakeClient.Unlock()
+
+	err = r.StartContainer(containerID)
+	assert.Error(t, err)
+	assert.Equal(t, "rpc error", err.Error())
+}
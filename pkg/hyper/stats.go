@@ -0,0 +1,185 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// apiVersionPodStats is the first hyperd API version that implements the
+// PodStats RPC. Older daemons fail the call, so detailed stats are skipped
+// for them and only the identity fields are reported.
+const apiVersionPodStats = "0.2.0"
+
+// ContainerStats returns stats of the container. When hyperd predates the
+// pod stats API, the entry carries only the identity fields and timestamps,
+// so kubelet's summary API keeps working against older daemons.
+func (h *Runtime) ContainerStats(containerID string) (*kubeapi.ContainerStats, error) {
+	containerID, err := h.resolveContainerID(containerID)
+	if err != nil {
+		glog.Errorf("Resolve container %q failed: %v", containerID, err)
+		return nil, err
+	}
+
+	info, err := h.client.GetContainerInfo(containerID)
+	if err != nil {
+		glog.Errorf("Get container info for %s failed: %v", containerID, err)
+		return nil, err
+	}
+
+	return h.buildContainerStats(info)
+}
+
+// ListContainerStats returns stats of all running containers.
+func (h *Runtime) ListContainerStats(filter *kubeapi.ContainerStatsFilter) (
+	[]*kubeapi.ContainerStats, error) {
+	containerFilter := &kubeapi.ContainerFilter{}
+	if filter != nil {
+		containerFilter.Id = filter.Id
+		containerFilter.PodSandboxId = filter.PodSandboxId
+		containerFilter.LabelSelector = filter.LabelSelector
+	}
+
+	containers, err := h.ListContainers(containerFilter)
+	if err != nil {
+		glog.Errorf("List containers failed: %v", err)
+		return nil, err
+	}
+
+	var results []*kubeapi.ContainerStats
+	for _, c := range containers {
+		info, err := h.client.GetContainerInfo(c.Id)
+		if err != nil {
+			glog.Errorf("Get container info for %s failed: %v", c.Id, err)
+			return nil, err
+		}
+
+		stats, err := h.buildContainerStats(info)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, stats)
+	}
+
+	return results, nil
+}
+
+// buildContainerStats assembles a CRI stats entry for the container. The
+// identity fields and timestamps are always populated; the usage numbers
+// are filled in from hyperd's PodStats RPC when the daemon supports it.
+func (h *Runtime) buildContainerStats(info *types.ContainerInfo) (*kubeapi.ContainerStats, error) {
+	metadata, err := toKubeContainerMetadata(info.Container.Name)
+	if err != nil {
+		glog.Errorf("ParseContainerName for %s failed: %v", info.Container.Name, err)
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	stats := &kubeapi.ContainerStats{
+		Attributes: &kubeapi.ContainerAttributes{
+			Id:          info.Container.ContainerID,
+			Metadata:    metadata,
+			Labels:      getKubeletLabels(info.Container.Labels),
+			Annotations: getAnnotationsFromLabels(info.Container.Labels),
+		},
+		Cpu:           &kubeapi.CpuUsage{Timestamp: now},
+		Memory:        &kubeapi.MemoryUsage{Timestamp: now},
+		WritableLayer: &kubeapi.FilesystemUsage{Timestamp: now},
+	}
+
+	if h.client.apiVersionBefore("", apiVersionPodStats) {
+		// Detailed stats are unavailable from this hyperd; that was
+		// logged once at startup, so just return the identity entry.
+		return stats, nil
+	}
+
+	podStats, err := h.client.GetPodStats(info.PodID)
+	if err != nil {
+		glog.Errorf("Get pod stats for %s failed: %v", info.PodID, err)
+		return nil, err
+	}
+	for _, cs := range podStats.GetContainersStats() {
+		if cs.ContainerID != info.Container.ContainerID {
+			continue
+		}
+
+		if cs.Cpu != nil && cs.Cpu.Usage != nil {
+			stats.Cpu.UsageCoreNanoSeconds = &kubeapi.UInt64Value{Value: cs.Cpu.Usage.Total}
+		}
+		if cs.Memory != nil {
+			stats.Memory.WorkingSetBytes = &kubeapi.UInt64Value{Value: cs.Memory.WorkingSet}
+		}
+		break
+	}
+	if usedBytes, ok := containerFsUsage(podStats, info.Container.ContainerID); ok {
+		stats.WritableLayer.UsedBytes = &kubeapi.UInt64Value{Value: usedBytes}
+	}
+
+	return stats, nil
+}
+
+// containerFsUsage sums the filesystem usage hyperd reports for one
+// container. The boolean is false when the pod stats carry no filesystem
+// entries for the container, in which case the usage is unknown and should
+// be omitted; hyperd exposes no rootfs path on the host either, so there is
+// nothing to measure locally.
+func containerFsUsage(podStats *types.PodStats, containerID string) (uint64, bool) {
+	for _, cs := range podStats.GetContainersStats() {
+		if cs.ContainerID != containerID || len(cs.Filesystem) == 0 {
+			continue
+		}
+
+		var usedBytes uint64
+		for _, fs := range cs.Filesystem {
+			usedBytes += fs.Usage
+		}
+		return usedBytes, true
+	}
+
+	return 0, false
+}
+
+// GetContainerFsUsage queries hyperd for the writable-layer usage in bytes
+// of a container. The boolean is false when hyperd does not report
+// filesystem stats for the container.
+func (c *Client) GetContainerFsUsage(podID, containerID string) (uint64, bool, error) {
+	podStats, err := c.GetPodStats(podID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	usedBytes, ok := containerFsUsage(podStats, containerID)
+	return usedBytes, ok, nil
+}
+
+// GetPodStats gets the resource usage of a pod from hyperd.
+func (c *Client) GetPodStats(podID string) (*types.PodStats, error) {
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	resp, err := c.client.PodStats(ctx, &types.PodStatsRequest{PodID: podID})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PodStats, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestContainerStatsWithoutMetricsSupport(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	// A hyperd that predates the pod stats API.
+	fakeClient.SetVersion("0.8.0", "0.1.0")
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0,
+		map[string]string{"abc.xyz": "label"}, map[string]string{}, nil)
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+
+	// The identity fields and timestamps are present, the usage values
+	// are simply absent instead of the call failing.
+	stats, err := r.ContainerStats(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, stats.Attributes.Id)
+	assert.Equal(t, "sidecar", stats.Attributes.Metadata.Name)
+	assert.Equal(t, map[string]string{"abc.xyz": "label"}, stats.Attributes.Labels)
+	assert.True(t, stats.Cpu.Timestamp > 0)
+	assert.True(t, stats.Memory.Timestamp > 0)
+	assert.True(t, stats.WritableLayer.Timestamp > 0)
+	assert.Nil(t, stats.Cpu.UsageCoreNanoSeconds)
+	assert.Nil(t, stats.Memory.WorkingSetBytes)
+	assert.Nil(t, stats.WritableLayer.UsedBytes)
+
+	statsList, err := r.ListContainerStats(nil)
+	assert.NoError(t, err)
+	assert.Len(t, statsList, 1)
+	assert.Equal(t, containerID, statsList[0].Attributes.Id)
+}
+
+func TestContainerStatsWritableLayer(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	fakeClient.SetVersion("0.8.0", apiVersionPodStats)
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "sidecar", "logger:v1", 0,
+		map[string]string{}, map[string]string{}, nil)
+	sandboxID := "sandboxid"
+	setFakeRunningPods(fakeClient, sandboxID)
+	containerID, err := r.CreateContainer(sandboxID, config, sConfig)
+	assert.NoError(t, err)
+
+	fakeClient.podStatsMap[sandboxID] = &types.PodStats{
+		ContainersStats: []*types.ContainersStats{
+			{
+				ContainerID: containerID,
+				Cpu:         &types.CpuStats{Usage: &types.CpuUsage{Total: 100000}},
+				Memory:      &types.MemoryStats{WorkingSet: 4096},
+				Filesystem: []*types.FsStats{
+					{Device: "vda1", Usage: 1024},
+					{Device: "vdb1", Usage: 512},
+				},
+			},
+		},
+	}
+
+	// The writable-layer usage sums the container's filesystem entries.
+	stats, err := r.ContainerStats(containerID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100000), stats.Cpu.UsageCoreNanoSeconds.Value)
+	assert.Equal(t, uint64(4096), stats.Memory.WorkingSetBytes.Value)
+	assert.Equal(t, uint64(1536), stats.WritableLayer.UsedBytes.Value)
+
+	usedBytes, ok, err := r.client.GetContainerFsUsage(sandboxID, containerID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1536), usedBytes)
+
+	// When hyperd reports no filesystem stats for the container, the
+	// usage is omitted rather than reported as zero.
+	fakeClient.podStatsMap[sandboxID].ContainersStats[0].Filesystem = nil
+	stats, err = r.ContainerStats(containerID)
+	assert.NoError(t, err)
+	assert.Nil(t, stats.WritableLayer.UsedBytes)
+
+	_, ok, err = r.client.GetContainerFsUsage(sandboxID, containerID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// stopSignalAnnotationKey overrides the signal hyperd sends to stop a
+// container. Set on the pod it applies to all of the pod's containers; a
+// container-level annotation wins over the pod's. Without either, the spec
+// is left empty and hyperd falls back to the image's STOPSIGNAL and finally
+// SIGTERM. The grace period still applies: hyperd escalates to SIGKILL once
+// the stop timeout expires, whatever signal was sent first.
+const stopSignalAnnotationKey = "runtime.frakti.alpha.kubernetes.io/StopSignal"
+
+// knownStopSignals is the set of signals a container can reasonably be asked
+// to stop with. Names are accepted with or without the SIG prefix, case
+// insensitively; anything else fails the create instead of surprising the
+// operator at stop time.
+var knownStopSignals = map[string]bool{
+	"SIGHUP":  true,
+	"SIGINT":  true,
+	"SIGQUIT": true,
+	"SIGKILL": true,
+	"SIGUSR1": true,
+	"SIGUSR2": true,
+	"SIGTERM": true,
+}
+
+// resolveStopSignal picks the stop signal for the container from its own and
+// its pod's annotations. An empty result means no override was requested.
+func resolveStopSignal(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
+	value := sandboxConfig.Annotations[stopSignalAnnotationKey]
+	if containerValue, ok := config.Annotations[stopSignalAnnotationKey]; ok {
+		value = containerValue
+	}
+	if value == "" {
+		return "", nil
+	}
+
+	signal := strings.ToUpper(value)
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+	if !knownStopSignals[signal] {
+		return "", fmt.Errorf("unsupported stop signal %q for container %q", value, config.GetMetadata().GetName())
+	}
+	return signal, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopSignalForwarding(t *testing.T) {
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// Without an override the spec is left empty, so hyperd falls back to
+	// the image's STOPSIGNAL and finally SIGTERM.
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	spec, err := buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "", spec.StopSignal)
+
+	// A pod-level annotation is forwarded to the container spec.
+	sConfig.Annotations = map[string]string{stopSignalAnnotationKey: "SIGQUIT"}
+	spec, err = buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "SIGQUIT", spec.StopSignal)
+
+	// A container annotation wins over the pod's; names are normalized to
+	// the SIG-prefixed upper-case form.
+	config.Annotations = map[string]string{stopSignalAnnotationKey: "usr1"}
+	spec, err = buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "SIGUSR1", spec.StopSignal)
+
+	// An unknown signal fails the create instead of surprising the
+	// operator at stop time.
+	config.Annotations = map[string]string{stopSignalAnnotationKey: "SIGWHATEVER"}
+	_, err = buildUserContainer(config, sConfig)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported stop signal")
+}
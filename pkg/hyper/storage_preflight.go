@@ -0,0 +1,131 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+// freeSpaceStatusNames are the storage driver status entries that report
+// free space in hyperd's daemon info, depending on the driver (devicemapper
+// reports "Data Space Available", others vary).
+var freeSpaceStatusNames = []string{
+	"Data Space Available",
+	"Free Space",
+	"Available Space",
+}
+
+// GetDaemonInfo gets the daemon info of hyperd.
+func (c *Client) GetDaemonInfo() (*types.InfoResponse, error) {
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	return c.client.Info(ctx, &types.InfoRequest{})
+}
+
+// checkStorageFreeSpace rejects a create with ResourceExhausted when
+// hyperd's image/storage filesystem reports less free space than the
+// configured threshold, so a full disk surfaces here instead of as a
+// cryptic failure deep inside the create. The check is best effort: when
+// the daemon info is unavailable or the storage driver does not report
+// free space, the create proceeds rather than being blocked on a guess.
+func (h *Runtime) checkStorageFreeSpace() error {
+	if h.storageFreeThresholdMB <= 0 {
+		return nil
+	}
+
+	info, err := h.client.GetDaemonInfo()
+	if err != nil {
+		glog.Warningf("Get daemon info for storage pre-flight check failed: %v", err)
+		return nil
+	}
+	free, ok := driverFreeBytes(info)
+	if !ok {
+		glog.V(3).Infof("Storage driver %q reports no free space, skipping the pre-flight check", info.Driver)
+		return nil
+	}
+
+	if free < h.storageFreeThresholdMB*1024*1024 {
+		return status.Errorf(codes.ResourceExhausted, "image storage filesystem has only %d MB free, below the configured threshold of %d MB; free up space before creating", free/(1024*1024), h.storageFreeThresholdMB)
+	}
+	return nil
+}
+
+// driverFreeBytes extracts the free space of the storage filesystem from
+// the daemon info's driver status, if the driver reports one.
+func driverFreeBytes(info *types.InfoResponse) (int64, bool) {
+	for _, entry := range info.GetDstatus() {
+		for _, name := range freeSpaceStatusNames {
+			if strings.EqualFold(entry.Name, name) {
+				return parseDriverSize(entry.Status)
+			}
+		}
+	}
+	return 0, false
+}
+
+// parseDriverSize parses a driver status size like "97.3 GB", "512 MiB" or
+// a plain byte count. Decimal units are powers of 1000, the "i" variants
+// powers of 1024, matching how docker-style drivers humanize sizes.
+func parseDriverSize(value string) (int64, bool) {
+	number := strings.TrimSpace(value)
+	unit := ""
+	if idx := strings.IndexFunc(number, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); idx >= 0 {
+		unit = strings.TrimSpace(number[idx:])
+		number = number[:idx]
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+
+	var multiplier float64
+	switch strings.ToUpper(unit) {
+	case "", "B":
+		multiplier = 1
+	case "KB":
+		multiplier = 1000
+	case "MB":
+		multiplier = 1000 * 1000
+	case "GB":
+		multiplier = 1000 * 1000 * 1000
+	case "TB":
+		multiplier = 1000 * 1000 * 1000 * 1000
+	case "KIB":
+		multiplier = 1024
+	case "MIB":
+		multiplier = 1024 * 1024
+	case "GIB":
+		multiplier = 1024 * 1024 * 1024
+	case "TIB":
+		multiplier = 1024 * 1024 * 1024 * 1024
+	default:
+		return 0, false
+	}
+	return int64(math.Round(size * multiplier)), true
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestParseDriverSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"97.3 GB": 97300000000,
+		"512 MiB": 512 * 1024 * 1024,
+		"1024":    1024,
+		"2 kb":    2000,
+	} {
+		size, ok := parseDriverSize(value)
+		assert.True(t, ok, value)
+		assert.Equal(t, expected, size, value)
+	}
+	for _, value := range []string{"", "full", "1.2 parsecs", "-1 GB"} {
+		_, ok := parseDriverSize(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestStorageFreeSpacePreflight(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	r.storageFreeThresholdMB = 512
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+
+	// The driver reports less free space than the threshold; both create
+	// paths fail up front with ResourceExhausted.
+	fakeClient.daemonInfo = &types.InfoResponse{
+		Driver:  "devicemapper",
+		Dstatus: []*types.DriverStatus{{Name: "Data Space Available", Status: "100 MB"}},
+	}
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	if assert.Error(t, err) {
+		assert.Equal(t, codes.ResourceExhausted, grpc.Code(err))
+		assert.Contains(t, err.Error(), "below the configured threshold")
+	}
+	assert.NotContains(t, fakeClient.called, "ContainerCreate")
+
+	_, err = r.RunPodSandbox(sConfig)
+	if assert.Error(t, err) {
+		assert.Equal(t, codes.ResourceExhausted, grpc.Code(err))
+	}
+
+	// With enough free space the create goes through.
+	fakeClient.daemonInfo.Dstatus[0].Status = "97.3 GB"
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// A driver that reports no free space cannot be checked; the create
+	// proceeds instead of being blocked on a guess.
+	fakeClient.daemonInfo = &types.InfoResponse{Driver: "overlay"}
+	config = makeContainerConfig(sConfig, "app2", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+
+	// A zero threshold disables the check entirely.
+	r.storageFreeThresholdMB = 0
+	fakeClient.CleanCalls()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	config = makeContainerConfig(sConfig, "app3", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	_, err = r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	assert.NotContains(t, fakeClient.called, "Info")
+}
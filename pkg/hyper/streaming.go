@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -32,11 +33,36 @@ import (
 
 type streamingRuntime struct {
 	client *Client
+
+	// stdinOnce tracks which containers already handed their one-shot
+	// stdin to an attach, per StdinOnce semantics.
+	stdinOnce stdinOnceTracker
 }
 
 // emphasize streamingRuntime should implement streaming.Runtime interface.
 var _ streaming.Runtime = &streamingRuntime{}
 
+// stdinOnceTracker remembers which containers have consumed their one-shot
+// stdin, so only the first attach of a StdinOnce container gets the stream.
+type stdinOnceTracker struct {
+	sync.Mutex
+	consumed map[string]bool
+}
+
+// claim reports whether the caller won the container's one-shot stdin.
+func (t *stdinOnceTracker) claim(containerID string) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.consumed[containerID] {
+		return false
+	}
+	if t.consumed == nil {
+		t.consumed = make(map[string]bool)
+	}
+	t.consumed[containerID] = true
+	return true
+}
+
 // Exec execute a command in the container.
 func (sr *streamingRuntime) Exec(rawContainerID string, cmd []string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
 	err := ensureContainerRunning(sr.client, rawContainerID)
@@ -57,6 +83,24 @@ func (sr *streamingRuntime) Attach(rawContainerID string, stdin io.Reader, stdou
 		return err
 	}
 
+	// Honor the Stdin/StdinOnce flags the container was created with: a
+	// container created without stdin gets no stream wired up, and a
+	// StdinOnce container hands its stdin to the first attach only.
+	if stdin != nil {
+		info, err := sr.client.GetContainerInfo(rawContainerID)
+		if err != nil {
+			return err
+		}
+		labels := info.Container.Labels
+		if labels[stdinLabelKey] != "true" {
+			glog.V(3).Infof("Container %s was created without stdin, not wiring up the attach stdin stream", rawContainerID)
+			stdin = nil
+		} else if labels[stdinOnceLabelKey] == "true" && !sr.stdinOnce.claim(rawContainerID) {
+			glog.V(3).Infof("Stdin of container %s is already consumed (StdinOnce), not wiring up the attach stdin stream", rawContainerID)
+			stdin = nil
+		}
+	}
+
 	return sr.client.AttachContainer(rawContainerID, stdin, stdout, stderr, tty, resize)
 }
 
@@ -83,10 +127,20 @@ func (h *Runtime) ExecSync(rawContainerID string, cmd []string, timeout time.Dur
 	)
 
 	// check if container is running
-	err = ensureContainerRunning(h.client, rawContainerID)
+	containerInfo, err := h.client.GetContainerInfo(rawContainerID)
 	if err != nil {
 		return nil, nil, err
 	}
+	if containerInfo.Status.Phase != "running" {
+		return nil, nil, fmt.Errorf("Container %s is not running.", rawContainerID)
+	}
+
+	// The container's start time identifies its incarnation, so results
+	// recorded before a restart are never served after it.
+	generation := containerInfo.Status.Running.GetStartedAt()
+	if cached, ok := h.execCache.Get(rawContainerID, cmd, generation); ok {
+		return cached.stdout, cached.stderr, cached.err
+	}
 
 	err = h.client.ExecInContainer(rawContainerID, cmd,
 		nil, // don't need stdin here
@@ -96,9 +150,23 @@ func (h *Runtime) ExecSync(rawContainerID string, cmd []string, timeout time.Dur
 		nil,   // don't need resize
 		timeout)
 
+	// Only command completions (including non-zero exits) are cached;
+	// transport errors and timeouts should be retried immediately.
+	if _, exited := err.(utilexec.CodeExitError); err == nil || exited {
+		h.execCache.Put(rawContainerID, cmd, generation, stdoutBuffer.Bytes(), stderrBuffer.Bytes(), err)
+	}
+
 	return stdoutBuffer.Bytes(), stderrBuffer.Bytes(), err
 }
 
+// Exec, Attach and PortForward follow the upstream CRI redirect pattern:
+// each RPC registers the request with the streaming server and returns a
+// one-time URL, and kubelet connects there for the actual SPDY/WebSocket
+// stream. The long-lived streams are thus served by the streaming server
+// (address set via --streaming-server-addr and --streaming-server-port)
+// instead of tying up the main gRPC server; streamingRuntime below
+// implements the stream backends against hyperd.
+
 // Exec prepares a streaming endpoint to execute a command in the container.
 func (h *Runtime) Exec(req *kubeapi.ExecRequest) (*kubeapi.ExecResponse, error) {
 	if h.streamingServer == nil {
@@ -76,6 +76,38 @@ func TestExec(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// brokenWriteCloser fails every write, simulating a client whose connection
+// went away in the middle of a stream.
+type brokenWriteCloser struct{}
+
+func (brokenWriteCloser) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("broken pipe")
+}
+
+func (brokenWriteCloser) Close() error {
+	return nil
+}
+
+func TestExecCleanupOnClientDisconnect(t *testing.T) {
+	r, fakeClient := newTestStreamingRuntime()
+	containers := []*FakeContainer{
+		{
+			ID:     "c*0",
+			Name:   "sidecar0",
+			Status: "running",
+			PodID:  "p*0",
+		},
+	}
+	fakeClient.SetFakeContainers(containers)
+	fakeClient.execStdout = []byte("some output")
+
+	//The write failure aborts the stream and the hyperd exec session
+	//must be killed instead of leaking
+	err := r.Exec("c*0", []string{"ls"}, nil, brokenWriteCloser{}, nil, true, nil)
+	assert.Error(t, err)
+	assert.Contains(t, fakeClient.called, "ExecSignal")
+}
+
 func TestPortForward(t *testing.T) {
 	r, fakeClient := newTestStreamingRuntime()
 	podId := "p"
@@ -0,0 +1,87 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/hyper/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+// unifiedResourcesAnnotationPrefix carries cgroup v2 "unified" resource
+// parameters as container annotations, keyed by the cgroup parameter name,
+// e.g. unified.frakti.alpha.kubernetes.io/pids.max = "512". Newer CRI
+// revisions have the map first-class on LinuxContainerResources; the
+// v1alpha1 struct vendored here has no such field yet, so the annotations
+// are the channel until the CRI vendoring is bumped.
+const unifiedResourcesAnnotationPrefix = "unified.frakti.alpha.kubernetes.io/"
+
+// unifiedResources collects the cgroup v2 unified parameters from the
+// container's annotations, with the prefix stripped. Nil when the container
+// carries none.
+func unifiedResources(config *kubeapi.ContainerConfig) map[string]string {
+	var unified map[string]string
+	for key, value := range config.GetAnnotations() {
+		if !strings.HasPrefix(key, unifiedResourcesAnnotationPrefix) {
+			continue
+		}
+		if unified == nil {
+			unified = make(map[string]string)
+		}
+		unified[strings.TrimPrefix(key, unifiedResourcesAnnotationPrefix)] = value
+	}
+	return unified
+}
+
+// applyUnifiedResources translates cgroup v2 unified parameters onto the
+// hyperd container spec. hyperd has no per-container cgroup knobs - CPU
+// and memory are sized at the pod VM level - so only parameters with an
+// in-VM equivalent are applied; the rest are warned about rather than
+// silently dropped, matching how the OOM score adjustment is handled.
+func applyUnifiedResources(spec *types.UserContainer, unified map[string]string) error {
+	for key, value := range unified {
+		switch key {
+		case "pids.max":
+			// "max" is the cgroup spelling of "unlimited", which is
+			// hyperd's default anyway.
+			if value == "max" {
+				continue
+			}
+			pids, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid unified resource %q value %q: %v", key, value, err)
+			}
+			// The nearest in-VM control is the nproc rlimit. It counts
+			// processes of the container's user rather than cgroup tasks,
+			// which is close enough to bound a fork bomb.
+			spec.Ulimits = append(spec.Ulimits, &types.Ulimit{
+				Name: "nproc",
+				Hard: pids,
+				Soft: pids,
+			})
+		default:
+			glog.Warningf("Unified resource %q of container %q can not be honored by hyperd", key, spec.Name)
+		}
+	}
+
+	return nil
+}
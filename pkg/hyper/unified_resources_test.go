@@ -0,0 +1,68 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/frakti/pkg/hyper/types"
+)
+
+func TestApplyUnifiedResources(t *testing.T) {
+	// pids.max maps onto an nproc rlimit inside the VM; memory.max has no
+	// per-container equivalent and is only warned about.
+	spec := &types.UserContainer{Name: "app"}
+	err := applyUnifiedResources(spec, map[string]string{
+		"pids.max":   "512",
+		"memory.max": "1073741824",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, spec.Ulimits, 1)
+	assert.Equal(t, "nproc", spec.Ulimits[0].Name)
+	assert.Equal(t, uint64(512), spec.Ulimits[0].Hard)
+	assert.Equal(t, uint64(512), spec.Ulimits[0].Soft)
+
+	// "max" is the cgroup spelling of unlimited, which is the default.
+	spec = &types.UserContainer{Name: "app"}
+	assert.NoError(t, applyUnifiedResources(spec, map[string]string{"pids.max": "max"}))
+	assert.Empty(t, spec.Ulimits)
+
+	// A malformed value fails the create instead of being dropped.
+	assert.Error(t, applyUnifiedResources(spec, map[string]string{"pids.max": "many"}))
+}
+
+func TestUnifiedResourcesFromAnnotations(t *testing.T) {
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{},
+		map[string]string{
+			unifiedResourcesAnnotationPrefix + "pids.max": "512",
+			"irrelevant.example.com/key":                  "ignored",
+		}, nil)
+
+	assert.Equal(t, map[string]string{"pids.max": "512"}, unifiedResources(config))
+
+	// The annotated parameter ends up on the hyperd spec.
+	spec, err := buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.Len(t, spec.Ulimits, 1)
+	assert.Equal(t, "nproc", spec.Ulimits[0].Name)
+
+	// Without the annotations nothing is collected.
+	config = makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	assert.Nil(t, unifiedResources(config))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// The policies for pod specs requesting features the hyper runtime can not
+// honor: "fail" rejects the request loudly, "warn" creates the pod
+// best-effort without the feature and logs a warning.
+const (
+	UnsupportedPolicyWarn = "warn"
+	UnsupportedPolicyFail = "fail"
+)
+
+// unsupportedPolicy is set once at startup via SetUnsupportedPolicy and
+// consulted by all translation code through unsupportedFeature. It defaults
+// to failing, matching the historical behavior for privileged containers.
+var unsupportedPolicy = UnsupportedPolicyFail
+
+// SetUnsupportedPolicy configures how unsupported features in pod specs are
+// handled, from the --on-unsupported flag.
+func SetUnsupportedPolicy(policy string) error {
+	switch policy {
+	case UnsupportedPolicyWarn, UnsupportedPolicyFail:
+		unsupportedPolicy = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid policy %q for unsupported features, must be %q or %q", policy, UnsupportedPolicyWarn, UnsupportedPolicyFail)
+	}
+}
+
+// unsupportedFeature reports a feature the hyper runtime can not honor.
+// Under the fail policy the formatted error is returned for the caller to
+// propagate; under the warn policy it is only logged and nil is returned,
+// so the caller proceeds without the feature.
+func unsupportedFeature(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if unsupportedPolicy == UnsupportedPolicyWarn {
+		glog.Warningf("Ignoring unsupported feature: %v", err)
+		return nil
+	}
+	return err
+}
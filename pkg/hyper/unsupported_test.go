@@ -0,0 +1,47 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestUnsupportedPolicy(t *testing.T) {
+	defer func() { unsupportedPolicy = UnsupportedPolicyFail }()
+
+	assert.Error(t, SetUnsupportedPolicy("bogus"))
+
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+	config := makeContainerConfig(sConfig, "pause", "pause:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		SecurityContext: &kubeapi.LinuxContainerSecurityContext{Privileged: true},
+	}
+
+	// Under the fail policy (the default) a privileged request is rejected.
+	assert.NoError(t, SetUnsupportedPolicy(UnsupportedPolicyFail))
+	_, err := buildUserContainer(config, sConfig)
+	assert.Error(t, err)
+
+	// Under the warn policy the container is created without the privilege.
+	assert.NoError(t, SetUnsupportedPolicy(UnsupportedPolicyWarn))
+	spec, err := buildUserContainer(config, sConfig)
+	assert.NoError(t, err)
+	assert.NotNil(t, spec)
+}
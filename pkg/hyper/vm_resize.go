@@ -0,0 +1,251 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// containerVcpuLabelKey and containerMemoryMBLabelKey keep the VM
+	// resources a container was accounted for at create time, so a later
+	// create into the same sandbox can compute the aggregate requirement
+	// without re-deriving limits from specs hyperd no longer has.
+	containerVcpuLabelKey     = "io.kubernetes.frakti.container-vcpu"
+	containerMemoryMBLabelKey = "io.kubernetes.frakti.container-memory-mb"
+)
+
+// ResizePod changes the VM sizing of a running pod. hyperd's public API has
+// no pod-resize RPC (the VM's vcpus and memory are fixed at StartPod), so
+// this reports Unimplemented; the method is the single point to wire up once
+// the daemon can hot-plug resources.
+func (c *Client) ResizePod(podID string, vcpu, memoryMB int32) error {
+	return status.Errorf(codes.Unimplemented, "hyperd cannot resize the VM of pod %s to %d vcpus and %d MB while it is running", podID, vcpu, memoryMB)
+}
+
+// containerVMResources derives the VM resources a container needs from its
+// CRI limits: vcpus are the CPU quota rounded up to whole cores, memory is
+// the limit rounded up to megabytes. Zero means no limit was set and
+// reserves nothing on top of the VM's sizing.
+func containerVMResources(config *kubeapi.ContainerConfig) (vcpu, memoryMB int32) {
+	resources := config.GetLinux().GetResources()
+	if resources == nil {
+		return 0, 0
+	}
+	if resources.CpuQuota > 0 && resources.CpuPeriod > 0 {
+		vcpu = int32((resources.CpuQuota + resources.CpuPeriod - 1) / resources.CpuPeriod)
+	}
+	if resources.MemoryLimitInBytes > 0 {
+		memoryMB = int32((resources.MemoryLimitInBytes + 1024*1024 - 1) / (1024 * 1024))
+	}
+	return vcpu, memoryMB
+}
+
+// recordContainerVMResources keeps the derived VM resources in the container
+// labels, so they survive in hyperd for later aggregate computations.
+func recordContainerVMResources(config *kubeapi.ContainerConfig) {
+	vcpu, memoryMB := containerVMResources(config)
+	if vcpu == 0 && memoryMB == 0 {
+		return
+	}
+	if config.Labels == nil {
+		config.Labels = make(map[string]string)
+	}
+	config.Labels[containerVcpuLabelKey] = strconv.FormatInt(int64(vcpu), 10)
+	config.Labels[containerMemoryMBLabelKey] = strconv.FormatInt(int64(memoryMB), 10)
+}
+
+// vmReservation is one container's recorded VM resources.
+type vmReservation struct {
+	podID    string
+	vcpu     int32
+	memoryMB int32
+}
+
+// reservationCache keeps the per-container VM reservations in memory, so
+// aggregate computations do not walk hyperd's containers on every create.
+// A sandbox is seeded once from the labels persisted in hyperd (so
+// reservations recorded before a frakti restart still count) and maintained
+// incrementally as containers come and go. The zero value is ready to use.
+type reservationCache struct {
+	sync.Mutex
+	containers map[string]vmReservation
+	seeded     map[string]bool
+}
+
+func (c *reservationCache) isSeeded(podID string) bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.seeded[podID]
+}
+
+// seed installs the reservations read back from hyperd for podID and marks
+// the sandbox as seeded.
+func (c *reservationCache) seed(podID string, reservations map[string]vmReservation) {
+	c.Lock()
+	defer c.Unlock()
+	if c.containers == nil {
+		c.containers = make(map[string]vmReservation)
+	}
+	if c.seeded == nil {
+		c.seeded = make(map[string]bool)
+	}
+	for containerID, reservation := range reservations {
+		c.containers[containerID] = reservation
+	}
+	c.seeded[podID] = true
+}
+
+func (c *reservationCache) record(containerID, podID string, vcpu, memoryMB int32) {
+	c.Lock()
+	defer c.Unlock()
+	if c.containers == nil {
+		c.containers = make(map[string]vmReservation)
+	}
+	c.containers[containerID] = vmReservation{podID: podID, vcpu: vcpu, memoryMB: memoryMB}
+}
+
+func (c *reservationCache) forgetContainer(containerID string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.containers, containerID)
+}
+
+func (c *reservationCache) forgetPod(podID string) {
+	c.Lock()
+	defer c.Unlock()
+	for containerID, reservation := range c.containers {
+		if reservation.podID == podID {
+			delete(c.containers, containerID)
+		}
+	}
+	delete(c.seeded, podID)
+}
+
+func (c *reservationCache) sum(podID string) (vcpu, memoryMB int32) {
+	c.Lock()
+	defer c.Unlock()
+	for _, reservation := range c.containers {
+		if reservation.podID == podID {
+			vcpu += reservation.vcpu
+			memoryMB += reservation.memoryMB
+		}
+	}
+	return vcpu, memoryMB
+}
+
+// sandboxReservations sums the recorded VM resources of the sandbox's
+// existing containers from the local cache, reading the persisted labels
+// back from hyperd only the first time a sandbox is seen.
+func (h *Runtime) sandboxReservations(podSandboxID string) (vcpu, memoryMB int32, err error) {
+	if !h.reservations.isSeeded(podSandboxID) {
+		containers, err := h.client.GetContainerList()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		reservations := make(map[string]vmReservation)
+		for _, c := range containers {
+			if c.PodID != podSandboxID {
+				continue
+			}
+			info, err := h.client.GetContainerInfo(c.ContainerID)
+			if err != nil {
+				return 0, 0, err
+			}
+			reservation := vmReservation{podID: podSandboxID}
+			if value, parseErr := strconv.ParseInt(info.Container.Labels[containerVcpuLabelKey], 10, 32); parseErr == nil {
+				reservation.vcpu = int32(value)
+			}
+			if value, parseErr := strconv.ParseInt(info.Container.Labels[containerMemoryMBLabelKey], 10, 32); parseErr == nil {
+				reservation.memoryMB = int32(value)
+			}
+			reservations[c.ContainerID] = reservation
+		}
+		h.reservations.seed(podSandboxID, reservations)
+	}
+
+	vcpu, memoryMB = h.reservations.sum(podSandboxID)
+	return vcpu, memoryMB, nil
+}
+
+// ensureSandboxCapacity grows the sandbox's VM before a container create
+// when the aggregate requirement of the existing containers plus the new one
+// exceeds the VM's current sizing, so the container does not boot into a VM
+// that cannot hold it and OOM. On success it returns a rollback that shrinks
+// the VM back, for the caller to invoke when the create itself fails. While
+// hyperd cannot resize a running VM the create proceeds at the old sizing
+// with a warning — an overcommitted VM is how such pods have always run,
+// and rejecting them would break ordinary pods whose default VM is small.
+func (h *Runtime) ensureSandboxCapacity(podSandboxID string, config *kubeapi.ContainerConfig) (rollback func(), err error) {
+	noop := func() {}
+	needVcpu, needMemory := containerVMResources(config)
+	if needVcpu == 0 && needMemory == 0 {
+		return noop, nil
+	}
+
+	podInfo, err := h.client.GetPodInfo(podSandboxID)
+	if err != nil {
+		return nil, err
+	}
+	spec := podInfo.Spec
+	if spec == nil {
+		return noop, nil
+	}
+
+	reservedVcpu, reservedMemory, err := h.sandboxReservations(podSandboxID)
+	if err != nil {
+		return nil, err
+	}
+	requiredVcpu := reservedVcpu + needVcpu
+	requiredMemory := reservedMemory + needMemory
+	if requiredVcpu <= spec.Vcpu && requiredMemory <= spec.Memory {
+		return noop, nil
+	}
+
+	targetVcpu := spec.Vcpu
+	if requiredVcpu > targetVcpu {
+		targetVcpu = requiredVcpu
+	}
+	targetMemory := spec.Memory
+	if requiredMemory > targetMemory {
+		targetMemory = requiredMemory
+	}
+
+	if err := h.client.ResizePod(podSandboxID, targetVcpu, targetMemory); err != nil {
+		if grpc.Code(err) == codes.Unimplemented {
+			glog.Warningf("Sandbox %s is sized for %d vcpus and %d MB but its containers now require %d vcpus and %d MB; hyperd cannot resize a running VM, proceeding at the current sizing", podSandboxID, spec.Vcpu, spec.Memory, requiredVcpu, requiredMemory)
+			return noop, nil
+		}
+		return nil, err
+	}
+
+	originalVcpu, originalMemory := spec.Vcpu, spec.Memory
+	return func() {
+		if err := h.client.ResizePod(podSandboxID, originalVcpu, originalMemory); err != nil {
+			glog.Warningf("Shrink sandbox %s back to %d vcpus and %d MB failed: %v", podSandboxID, originalVcpu, originalMemory, err)
+		}
+	}, nil
+}
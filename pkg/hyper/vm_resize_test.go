@@ -0,0 +1,128 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func TestContainerVMResources(t *testing.T) {
+	config := makeContainerConfig(makeSandboxConfig("foo", "bar", "1", 0), "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+
+	// No limits reserve nothing on top of the VM's sizing.
+	vcpu, memoryMB := containerVMResources(config)
+	assert.Equal(t, int32(0), vcpu)
+	assert.Equal(t, int32(0), memoryMB)
+
+	// Quota is rounded up to whole cores, memory up to megabytes.
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		Resources: &kubeapi.LinuxContainerResources{
+			CpuQuota:           150000,
+			CpuPeriod:          100000,
+			MemoryLimitInBytes: 256<<20 + 1,
+		},
+	}
+	vcpu, memoryMB = containerVMResources(config)
+	assert.Equal(t, int32(2), vcpu)
+	assert.Equal(t, int32(257), memoryMB)
+}
+
+func countCalls(fakeClient *fakeClientInterface, call string) int {
+	fakeClient.Lock()
+	defer fakeClient.Unlock()
+	count := 0
+	for _, c := range fakeClient.called {
+		if c == call {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCreateContainerSandboxCapacity(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	// The VM was sized for one vcpu and 128 MB at sandbox creation.
+	fakeClient.podInfoMap["sandboxid"].Spec.Vcpu = 1
+	fakeClient.podInfoMap["sandboxid"].Spec.Memory = 128
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// A container that fits into the current sizing needs no resize.
+	small := makeContainerConfig(sConfig, "small", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	small.Linux = &kubeapi.LinuxContainerConfig{
+		Resources: &kubeapi.LinuxContainerResources{
+			CpuQuota:           50000,
+			CpuPeriod:          100000,
+			MemoryLimitInBytes: 64 << 20,
+		},
+	}
+	containerID, err := r.CreateContainer("sandboxid", small, sConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "64", fakeClient.containerInfoMap[containerID].Container.Labels[containerMemoryMBLabelKey])
+
+	// A container pushing the aggregate past the sizing would need the VM
+	// grown first; hyperd cannot resize a running VM, so the create
+	// proceeds at the old sizing — an overcommitted VM, as before the
+	// capacity check existed.
+	big := makeContainerConfig(sConfig, "big", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	big.Linux = &kubeapi.LinuxContainerConfig{
+		Resources: &kubeapi.LinuxContainerResources{
+			CpuQuota:           200000,
+			CpuPeriod:          100000,
+			MemoryLimitInBytes: 512 << 20,
+		},
+	}
+	infoCalls := countCalls(fakeClient, "ContainerInfo")
+	_, err = r.CreateContainer("sandboxid", big, sConfig)
+	assert.NoError(t, err)
+
+	// The aggregate came from the local reservation cache seeded by the
+	// first create, not from a per-container walk of hyperd.
+	assert.Equal(t, infoCalls, countCalls(fakeClient, "ContainerInfo"))
+}
+
+func TestSandboxReservationsSeededOnce(t *testing.T) {
+	r, fakeClient, _ := newTestRuntime()
+	setFakeRunningPods(fakeClient, "sandboxid")
+	sConfig := makeSandboxConfig("foo", "bar", "1", 0)
+
+	// A pre-existing container, e.g. created before a frakti restart,
+	// only has its labels in hyperd.
+	config := makeContainerConfig(sConfig, "app", "app:v1", 0, map[string]string{}, map[string]string{}, nil)
+	config.Linux = &kubeapi.LinuxContainerConfig{
+		Resources: &kubeapi.LinuxContainerResources{MemoryLimitInBytes: 64 << 20},
+	}
+	_, err := r.CreateContainer("sandboxid", config, sConfig)
+	assert.NoError(t, err)
+	r.reservations = reservationCache{}
+
+	// The first aggregate seeds the cache from hyperd once; subsequent
+	// ones are answered locally.
+	vcpu, memoryMB, err := r.sandboxReservations("sandboxid")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), vcpu)
+	assert.Equal(t, int32(64), memoryMB)
+
+	infoCalls := countCalls(fakeClient, "ContainerInfo")
+	_, memoryMB, err = r.sandboxReservations("sandboxid")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(64), memoryMB)
+	assert.Equal(t, infoCalls, countCalls(fakeClient, "ContainerInfo"))
+}
@@ -21,6 +21,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path"
 	"reflect"
 	"strings"
 	"syscall"
@@ -29,6 +30,8 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/workqueue"
@@ -40,9 +43,20 @@ import (
 	utilexec "k8s.io/utils/exec"
 )
 
-const (
-	runtimeAPIVersion = "0.1.0"
+// runtimeAPIVersion is the CRI version frakti implements, derived from the
+// vendored kubeapi package path (e.g. "v1alpha1") so the reported version
+// cannot drift from the API actually compiled in. The hyperd runtime version
+// is reported separately by the hyper runtime service.
+var runtimeAPIVersion = criAPIVersion()
+
+// criAPIVersion extracts the version segment from the kubeapi import path,
+// e.g. ".../kubelet/apis/cri/v1alpha1/runtime" yields "v1alpha1".
+func criAPIVersion() string {
+	pkgPath := reflect.TypeOf(kubeapi.VersionRequest{}).PkgPath()
+	return path.Base(path.Dir(pkgPath))
+}
 
+const (
 	// TODO(resouer) move this to well-known labels on k8s upstream?
 	// The annotation key specifying this pod will run by OS container runtime.
 	OSContainerAnnotationKey = "runtime.frakti.alpha.kubernetes.io/OSContainer"
@@ -52,6 +66,17 @@ const (
 	UnikernelAnnotationKey = "runtime.frakti.alpha.kubernetes.io/Unikernel"
 	// The annotation value specifying this pod will run by unikernel runtime.
 	UnikernelAnnotationTrue = "true"
+
+	// The annotation key carrying the runtime handler selected by RuntimeClass.
+	// CRI v1alpha1 has no RuntimeHandler field in RunPodSandboxRequest, so the
+	// handler is forwarded as an annotation.
+	RuntimeHandlerAnnotationKey = "runtime.frakti.alpha.kubernetes.io/RuntimeHandler"
+	// Runtime handler name selecting the hyper runtime.
+	HyperRuntimeHandler = "hyper"
+	// Runtime handler name selecting the privileged (OS container) runtime.
+	PrivilegedRuntimeHandler = "privileged"
+	// Runtime handler name selecting the unikernel runtime.
+	UnikernelRuntimeHandler = "unikernel"
 )
 
 // FraktiManager serves the kubelet runtime gRPC api which will be
@@ -73,6 +98,19 @@ type FraktiManager struct {
 
 	// The pod sets need to be processed by privileged runtime
 	cachedAlternativeRuntimeItems *alternativeruntime.AlternativeRuntimeSets
+
+	// Bounds on label/annotation maps accepted from clients, enforced by
+	// the validation interceptor. Non-positive values disable the bound.
+	maxLabelMapCount int
+	maxLabelMapSize  int
+
+	// sandboxLocks serializes container creates against sandbox teardown,
+	// see its doc for the race it closes.
+	sandboxLocks sandboxLocks
+
+	// statusCache serves repeated status queries between kubelet relists,
+	// see its doc for the staleness guarantees.
+	statusCache statusCache
 }
 
 // NewFraktiManager creates a new FraktiManager
@@ -84,9 +122,11 @@ func NewFraktiManager(
 	privilegedImageService runtime.ImageManagerService,
 	unikernelRuntimeService runtime.RuntimeService,
 	unikernelImageService runtime.ImageManagerService,
+	maxLabelMapCount int,
+	maxLabelMapSize int,
+	statusCacheTTL time.Duration,
 ) (*FraktiManager, error) {
 	s := &FraktiManager{
-		server:                        grpc.NewServer(),
 		hyperRuntimeService:           hyperRuntimeService,
 		hyperImageService:             hyperImageService,
 		streamingServer:               streamingServer,
@@ -95,7 +135,11 @@ func NewFraktiManager(
 		unikernelRuntimeService:       unikernelRuntimeService,
 		unikernelImageService:         unikernelImageService,
 		cachedAlternativeRuntimeItems: alternativeruntime.NewAlternativeRuntimeSets(),
+		maxLabelMapCount:              maxLabelMapCount,
+		maxLabelMapSize:               maxLabelMapSize,
+		statusCache:                   statusCache{ttl: statusCacheTTL},
 	}
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.validationInterceptor))
 	// NOTE: Check the real value of interface, see https://golang.org/doc/faq#nil_error
 	if privilegedRuntimeService == nil || reflect.ValueOf(privilegedRuntimeService).IsNil() {
 		s.privilegedRuntimeService = nil
@@ -207,7 +251,11 @@ func (s *FraktiManager) Version(ctx context.Context, req *kubeapi.VersionRequest
 func (s *FraktiManager) RunPodSandbox(ctx context.Context, req *kubeapi.RunPodSandboxRequest) (*kubeapi.RunPodSandboxResponse, error) {
 	glog.V(3).Infof("RunPodSandbox from runtime service with request %s", req.String())
 
-	runtimeService := s.getRuntimeServiceBySandboxConfig(req.GetConfig())
+	runtimeService, err := s.getRuntimeServiceBySandboxHandler(req.GetConfig())
+	if err != nil {
+		glog.Errorf("RunPodSandbox failed: %v", err)
+		return nil, err
+	}
 	runtimeName := runtimeService.ServiceName()
 	podID, err := runtimeService.RunPodSandbox(req.Config)
 	if err != nil {
@@ -225,6 +273,11 @@ func (s *FraktiManager) RunPodSandbox(ctx context.Context, req *kubeapi.RunPodSa
 func (s *FraktiManager) StopPodSandbox(ctx context.Context, req *kubeapi.StopPodSandboxRequest) (*kubeapi.StopPodSandboxResponse, error) {
 	glog.V(3).Infof("StopPodSandbox from runtime service with request %s", req.String())
 
+	// Wait out in-flight creates into this sandbox and fail later ones,
+	// so no container is created into a pod being torn down.
+	release := s.sandboxLocks.beginTeardown(req.PodSandboxId)
+	defer release()
+
 	runtimeService, _ := s.getRuntimeService(req.PodSandboxId)
 	err := runtimeService.StopPodSandbox(req.PodSandboxId)
 	if err != nil {
@@ -232,6 +285,7 @@ func (s *FraktiManager) StopPodSandbox(ctx context.Context, req *kubeapi.StopPod
 		return nil, err
 	}
 
+	s.statusCache.invalidate(sandboxStatusCacheKey(req.PodSandboxId))
 	return &kubeapi.StopPodSandboxResponse{}, nil
 }
 
@@ -239,6 +293,9 @@ func (s *FraktiManager) StopPodSandbox(ctx context.Context, req *kubeapi.StopPod
 func (s *FraktiManager) RemovePodSandbox(ctx context.Context, req *kubeapi.RemovePodSandboxRequest) (*kubeapi.RemovePodSandboxResponse, error) {
 	glog.V(3).Infof("RemovePodSandbox from runtime service with request %s", req.String())
 
+	release := s.sandboxLocks.beginTeardown(req.PodSandboxId)
+	defer release()
+
 	runtimeService, _ := s.getRuntimeService(req.PodSandboxId)
 	err := runtimeService.RemovePodSandbox(req.PodSandboxId)
 	if err != nil {
@@ -248,6 +305,8 @@ func (s *FraktiManager) RemovePodSandbox(ctx context.Context, req *kubeapi.Remov
 	if runtimeService != s.hyperRuntimeService {
 		s.cachedAlternativeRuntimeItems.Remove(req.PodSandboxId, runtimeService.ServiceName())
 	}
+	s.sandboxLocks.forget(req.PodSandboxId)
+	s.statusCache.invalidate(sandboxStatusCacheKey(req.PodSandboxId))
 	return &kubeapi.RemovePodSandboxResponse{}, nil
 }
 
@@ -255,12 +314,19 @@ func (s *FraktiManager) RemovePodSandbox(ctx context.Context, req *kubeapi.Remov
 func (s *FraktiManager) PodSandboxStatus(ctx context.Context, req *kubeapi.PodSandboxStatusRequest) (*kubeapi.PodSandboxStatusResponse, error) {
 	glog.V(3).Infof("PodSandboxStatus with request %s", req.String())
 
+	cacheKey := sandboxStatusCacheKey(req.PodSandboxId)
+	cached, gen, ok := s.statusCache.get(cacheKey)
+	if ok {
+		return &kubeapi.PodSandboxStatusResponse{Status: cached.(*kubeapi.PodSandboxStatus)}, nil
+	}
+
 	runtimeService, _ := s.getRuntimeService(req.PodSandboxId)
 	podStatus, err := runtimeService.PodSandboxStatus(req.PodSandboxId)
 	if err != nil {
 		glog.Errorf("PodSandboxStatus from %s failed: %v", runtimeService.ServiceName(), err)
 		return nil, err
 	}
+	s.statusCache.put(cacheKey, gen, podStatus)
 	return &kubeapi.PodSandboxStatusResponse{Status: podStatus}, nil
 }
 
@@ -285,6 +351,14 @@ func (s *FraktiManager) ListPodSandbox(ctx context.Context, req *kubeapi.ListPod
 func (s *FraktiManager) CreateContainer(ctx context.Context, req *kubeapi.CreateContainerRequest) (*kubeapi.CreateContainerResponse, error) {
 	glog.V(3).Infof("CreateContainer with request %s", req.String())
 
+	release, ok := s.sandboxLocks.beginCreate(req.PodSandboxId)
+	if !ok {
+		err := status.Errorf(codes.FailedPrecondition, "cannot create container in sandbox %s: the sandbox is being torn down", req.PodSandboxId)
+		glog.Errorf("CreateContainer failed: %v", err)
+		return nil, err
+	}
+	defer release()
+
 	runtimeService, _ := s.getRuntimeService(req.PodSandboxId)
 	containerID, err := runtimeService.CreateContainer(req.PodSandboxId, req.Config, req.SandboxConfig)
 	runtimeName := runtimeService.ServiceName()
@@ -297,6 +371,9 @@ func (s *FraktiManager) CreateContainer(ctx context.Context, req *kubeapi.Create
 		s.cachedAlternativeRuntimeItems.Add(containerID, runtimeName)
 		glog.V(3).Infof("added container: %s to %s container sets", containerID, runtimeName)
 	}
+	// The sandbox status includes a container summary, so the new
+	// container invalidates it as well.
+	s.statusCache.invalidate(sandboxStatusCacheKey(req.PodSandboxId))
 	return &kubeapi.CreateContainerResponse{ContainerId: containerID}, nil
 }
 
@@ -305,14 +382,32 @@ func (s *FraktiManager) StartContainer(ctx context.Context, req *kubeapi.StartCo
 	glog.V(3).Infof("StartContainer with request %s", req.String())
 
 	runtimeService, _ := s.getRuntimeService(req.ContainerId)
-	err := runtimeService.StartContainer(req.ContainerId)
+	err := ensureContainerRunning(runtimeService, req.ContainerId)
 	if err != nil {
 		glog.Errorf("StartContainer from %s failed: %v", runtimeService.ServiceName(), err)
 		return nil, err
 	}
+	s.statusCache.invalidate(containerStatusCacheKey(req.ContainerId))
 	return &kubeapi.StartContainerResponse{}, nil
 }
 
+// ensureContainerRunning starts the container unless it is already running.
+// All start paths go through this single helper, so idempotency and any
+// runtime specific start workarounds live in one place instead of drifting
+// between callers.
+func ensureContainerRunning(runtimeService runtime.RuntimeService, containerID string) error {
+	status, err := runtimeService.ContainerStatus(containerID)
+	if err != nil {
+		return err
+	}
+	if status.State == kubeapi.ContainerState_CONTAINER_RUNNING {
+		glog.V(3).Infof("Container %q is already running, skip starting it", containerID)
+		return nil
+	}
+
+	return runtimeService.StartContainer(containerID)
+}
+
 // StopContainer stops a running container with a grace period (i.e. timeout).
 func (s *FraktiManager) StopContainer(ctx context.Context, req *kubeapi.StopContainerRequest) (*kubeapi.StopContainerResponse, error) {
 	glog.V(3).Infof("StopContainer with request %s", req.String())
@@ -323,6 +418,7 @@ func (s *FraktiManager) StopContainer(ctx context.Context, req *kubeapi.StopCont
 		glog.Errorf("StopContainer from %s failed: %v", runtimeService.ServiceName(), err)
 		return nil, err
 	}
+	s.statusCache.invalidate(containerStatusCacheKey(req.ContainerId))
 	return &kubeapi.StopContainerResponse{}, nil
 }
 
@@ -342,9 +438,36 @@ func (s *FraktiManager) RemoveContainer(ctx context.Context, req *kubeapi.Remove
 		glog.V(3).Infof("removed container: %s from %s container sets", req.ContainerId, runtimeName)
 
 	}
+	s.statusCache.invalidate(containerStatusCacheKey(req.ContainerId))
 	return &kubeapi.RemoveContainerResponse{}, nil
 }
 
+// ContainerMetadataUpdater is implemented by runtime services that can
+// update a container's mutable metadata (labels/annotations) in place.
+type ContainerMetadataUpdater interface {
+	UpdateContainerMetadata(containerID string, labels, annotations map[string]string) error
+}
+
+// UpdateContainerMetadata updates a container's labels and annotations in
+// place when the owning runtime supports it, so metadata-only changes do
+// not force recreating the container. CRI v1alpha1 carries no such call;
+// this is exposed for frakti-internal reconciliation flows.
+func (s *FraktiManager) UpdateContainerMetadata(containerID string, labels, annotations map[string]string) error {
+	runtimeService, _ := s.getRuntimeService(containerID)
+	runtimeName := runtimeService.ServiceName()
+	updater, ok := runtimeService.(ContainerMetadataUpdater)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "%s cannot update container metadata in place", runtimeName)
+	}
+
+	if err := updater.UpdateContainerMetadata(containerID, labels, annotations); err != nil {
+		glog.Errorf("UpdateContainerMetadata from %s failed: %v", runtimeName, err)
+		return err
+	}
+	s.statusCache.invalidate(containerStatusCacheKey(containerID))
+	return nil
+}
+
 // ListContainers lists all containers by filters.
 func (s *FraktiManager) ListContainers(ctx context.Context, req *kubeapi.ListContainersRequest) (*kubeapi.ListContainersResponse, error) {
 	glog.V(3).Infof("ListContainers with request %s", req.String())
@@ -368,6 +491,12 @@ func (s *FraktiManager) ListContainers(ctx context.Context, req *kubeapi.ListCon
 func (s *FraktiManager) ContainerStatus(ctx context.Context, req *kubeapi.ContainerStatusRequest) (*kubeapi.ContainerStatusResponse, error) {
 	glog.V(3).Infof("ContainerStatus with request %s", req.String())
 
+	cacheKey := containerStatusCacheKey(req.ContainerId)
+	cached, gen, ok := s.statusCache.get(cacheKey)
+	if ok {
+		return &kubeapi.ContainerStatusResponse{Status: cached.(*kubeapi.ContainerStatus)}, nil
+	}
+
 	runtimeService, _ := s.getRuntimeService(req.ContainerId)
 	kubeStatus, err := runtimeService.ContainerStatus(req.ContainerId)
 	if err != nil {
@@ -375,6 +504,7 @@ func (s *FraktiManager) ContainerStatus(ctx context.Context, req *kubeapi.Contai
 		return nil, err
 	}
 
+	s.statusCache.put(cacheKey, gen, kubeStatus)
 	return &kubeapi.ContainerStatusResponse{
 		Status: kubeStatus,
 	}, nil
@@ -394,6 +524,7 @@ func (s *FraktiManager) UpdateContainerResources(
 		return nil, err
 	}
 
+	s.statusCache.invalidate(containerStatusCacheKey(req.ContainerId))
 	return &kubeapi.UpdateContainerResourcesResponse{}, nil
 }
 
@@ -704,6 +835,32 @@ func (s *FraktiManager) getRuntimeServiceBySandboxConfig(podConfig *kubeapi.PodS
 	return s.hyperRuntimeService
 }
 
+// getRuntimeServiceBySandboxHandler returns the runtime service selected by the
+// sandbox's runtime handler annotation. An empty handler falls back to the
+// annotation and security context based selection, an unknown or disabled
+// handler is rejected instead of silently creating a default sandbox.
+func (s *FraktiManager) getRuntimeServiceBySandboxHandler(podConfig *kubeapi.PodSandboxConfig) (runtime.RuntimeService, error) {
+	handler := podConfig.GetAnnotations()[RuntimeHandlerAnnotationKey]
+	switch handler {
+	case "":
+		return s.getRuntimeServiceBySandboxConfig(podConfig), nil
+	case HyperRuntimeHandler:
+		return s.hyperRuntimeService, nil
+	case PrivilegedRuntimeHandler:
+		if s.privilegedRuntimeService == nil {
+			return nil, fmt.Errorf("runtime handler %q is not enabled", handler)
+		}
+		return s.privilegedRuntimeService, nil
+	case UnikernelRuntimeHandler:
+		if s.unikernelRuntimeService == nil {
+			return nil, fmt.Errorf("runtime handler %q is not enabled", handler)
+		}
+		return s.unikernelRuntimeService, nil
+	default:
+		return nil, fmt.Errorf("unsupported runtime handler %q", handler)
+	}
+}
+
 // isOSContainerRuntimeRequired check if this pod requires to run with os container runtime.
 func isOSContainerRuntimeRequired(podConfig *kubeapi.PodSandboxConfig) bool {
 	// user require it
@@ -0,0 +1,336 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"k8s.io/frakti/pkg/runtime"
+	"k8s.io/frakti/pkg/util/alternativeruntime"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+func makeSandboxConfigWithHandler(handler string) *kubeapi.PodSandboxConfig {
+	config := &kubeapi.PodSandboxConfig{
+		Metadata: &kubeapi.PodSandboxMetadata{
+			Name:      "foo",
+			Namespace: "bar",
+			Uid:       "1",
+		},
+		Annotations: map[string]string{},
+	}
+	if handler != "" {
+		config.Annotations[RuntimeHandlerAnnotationKey] = handler
+	}
+	return config
+}
+
+// fakeRuntimeService stubs out just the calls ensureContainerRunning makes.
+type fakeRuntimeService struct {
+	runtime.RuntimeService
+	state   kubeapi.ContainerState
+	started bool
+}
+
+func (f *fakeRuntimeService) ServiceName() string {
+	return "fake runtime service"
+}
+
+func (f *fakeRuntimeService) ContainerStatus(containerID string) (*kubeapi.ContainerStatus, error) {
+	return &kubeapi.ContainerStatus{Id: containerID, State: f.state}, nil
+}
+
+func (f *fakeRuntimeService) StartContainer(containerID string) error {
+	f.started = true
+	return nil
+}
+
+func TestEnsureContainerRunning(t *testing.T) {
+	// An already running container is left alone.
+	service := &fakeRuntimeService{state: kubeapi.ContainerState_CONTAINER_RUNNING}
+	err := ensureContainerRunning(service, "c")
+	assert.NoError(t, err)
+	assert.False(t, service.started)
+
+	// A created container gets started.
+	service = &fakeRuntimeService{state: kubeapi.ContainerState_CONTAINER_CREATED}
+	err = ensureContainerRunning(service, "c")
+	assert.NoError(t, err)
+	assert.True(t, service.started)
+}
+
+func TestGetRuntimeServiceBySandboxHandler(t *testing.T) {
+	s := &FraktiManager{}
+
+	// An empty handler falls back to the default selection.
+	service, err := s.getRuntimeServiceBySandboxHandler(makeSandboxConfigWithHandler(""))
+	assert.NoError(t, err)
+	assert.Equal(t, s.hyperRuntimeService, service)
+
+	// The hyper handler is always supported.
+	service, err = s.getRuntimeServiceBySandboxHandler(makeSandboxConfigWithHandler(HyperRuntimeHandler))
+	assert.NoError(t, err)
+	assert.Equal(t, s.hyperRuntimeService, service)
+
+	// Handlers of disabled runtimes are rejected.
+	_, err = s.getRuntimeServiceBySandboxHandler(makeSandboxConfigWithHandler(UnikernelRuntimeHandler))
+	assert.Error(t, err)
+
+	// Unknown handlers are rejected instead of silently creating a
+	// default sandbox.
+	_, err = s.getRuntimeServiceBySandboxHandler(makeSandboxConfigWithHandler("kata"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported runtime handler")
+}
+
+// fakeMetadataUpdater is a runtime service that supports in-place
+// container metadata updates.
+type fakeMetadataUpdater struct {
+	fakeRuntimeService
+	labels      map[string]string
+	annotations map[string]string
+}
+
+func (f *fakeMetadataUpdater) UpdateContainerMetadata(containerID string, labels, annotations map[string]string) error {
+	f.labels = labels
+	f.annotations = annotations
+	return nil
+}
+
+func TestUpdateContainerMetadata(t *testing.T) {
+	// A runtime without the capability yields Unimplemented instead of
+	// pretending the update happened.
+	s := &FraktiManager{
+		hyperRuntimeService:           &fakeRuntimeService{},
+		cachedAlternativeRuntimeItems: alternativeruntime.NewAlternativeRuntimeSets(),
+	}
+	err := s.UpdateContainerMetadata("c", map[string]string{"app": "web"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, codes.Unimplemented, grpc.Code(err))
+
+	// A runtime implementing ContainerMetadataUpdater gets the update
+	// delegated to it.
+	updater := &fakeMetadataUpdater{}
+	s.hyperRuntimeService = updater
+	err = s.UpdateContainerMetadata("c", map[string]string{"app": "web"}, map[string]string{"note": "v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "web"}, updater.labels)
+	assert.Equal(t, map[string]string{"note": "v2"}, updater.annotations)
+}
+
+// fakeSandboxLifecycle stubs out the sandbox teardown race: its stop blocks
+// until released, so a test can hold a teardown in flight.
+type fakeSandboxLifecycle struct {
+	fakeRuntimeService
+	stopEntered chan struct{}
+	stopHold    chan struct{}
+	created     []string
+}
+
+func (f *fakeSandboxLifecycle) CreateContainer(podSandboxID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
+	f.created = append(f.created, podSandboxID)
+	return "c1", nil
+}
+
+func (f *fakeSandboxLifecycle) StopPodSandbox(podSandboxID string) error {
+	close(f.stopEntered)
+	<-f.stopHold
+	return nil
+}
+
+func TestCreateContainerStopSandboxRace(t *testing.T) {
+	f := &fakeSandboxLifecycle{
+		stopEntered: make(chan struct{}),
+		stopHold:    make(chan struct{}),
+	}
+	s := &FraktiManager{
+		hyperRuntimeService:           f,
+		cachedAlternativeRuntimeItems: alternativeruntime.NewAlternativeRuntimeSets(),
+	}
+	ctx := context.Background()
+
+	stopDone := make(chan error, 1)
+	go func() {
+		_, err := s.StopPodSandbox(ctx, &kubeapi.StopPodSandboxRequest{PodSandboxId: "p1"})
+		stopDone <- err
+	}()
+	// Once the runtime's stop has been entered, the teardown holds the
+	// sandbox lock; a concurrent create must not slip past it.
+	<-f.stopEntered
+
+	createDone := make(chan error, 1)
+	go func() {
+		_, err := s.CreateContainer(ctx, &kubeapi.CreateContainerRequest{
+			PodSandboxId: "p1",
+			Config:       &kubeapi.ContainerConfig{},
+		})
+		createDone <- err
+	}()
+
+	close(f.stopHold)
+	assert.NoError(t, <-stopDone)
+
+	// The create lost the race and is rejected instead of leaving an
+	// orphaned container in the dying pod.
+	err := <-createDone
+	assert.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, grpc.Code(err))
+	assert.Empty(t, f.created)
+
+	// Creates into other sandboxes are unaffected.
+	_, err = s.CreateContainer(ctx, &kubeapi.CreateContainerRequest{
+		PodSandboxId: "p2",
+		Config:       &kubeapi.ContainerConfig{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p2"}, f.created)
+}
+
+// fakeStatusService counts status fetches, so a test can tell a cache hit
+// from a runtime round trip.
+type fakeStatusService struct {
+	fakeRuntimeService
+	statusCalls int
+}
+
+func (f *fakeStatusService) ContainerStatus(containerID string) (*kubeapi.ContainerStatus, error) {
+	f.statusCalls++
+	return &kubeapi.ContainerStatus{Id: containerID, State: f.state}, nil
+}
+
+func (f *fakeStatusService) StopContainer(containerID string, timeout int64) error {
+	return nil
+}
+
+func TestStatusCacheInvalidation(t *testing.T) {
+	f := &fakeStatusService{}
+	s := &FraktiManager{
+		hyperRuntimeService:           f,
+		cachedAlternativeRuntimeItems: alternativeruntime.NewAlternativeRuntimeSets(),
+		statusCache:                   statusCache{ttl: time.Minute},
+	}
+	ctx := context.Background()
+	req := &kubeapi.ContainerStatusRequest{ContainerId: "c"}
+
+	// The second query within the TTL is served from cache.
+	_, err := s.ContainerStatus(ctx, req)
+	assert.NoError(t, err)
+	_, err = s.ContainerStatus(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, f.statusCalls)
+
+	// A mutation invalidates the entry; the next query hits the runtime
+	// again instead of reporting the pre-stop state.
+	_, err = s.StopContainer(ctx, &kubeapi.StopContainerRequest{ContainerId: "c"})
+	assert.NoError(t, err)
+	_, err = s.ContainerStatus(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.statusCalls)
+}
+
+func TestStatusCacheStaleFill(t *testing.T) {
+	c := statusCache{ttl: time.Minute}
+
+	// A fill that started before a mutation is dropped, so the cache can
+	// not serve pre-mutation data afterwards.
+	_, gen, ok := c.get("k")
+	assert.False(t, ok)
+	c.invalidate("k")
+	c.put("k", gen, "stale")
+	_, _, ok = c.get("k")
+	assert.False(t, ok)
+
+	// An undisturbed fill is stored and served.
+	_, gen, _ = c.get("k")
+	c.put("k", gen, "fresh")
+	v, _, ok := c.get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "fresh", v)
+
+	// A zero TTL disables the cache entirely.
+	off := statusCache{}
+	_, gen, _ = off.get("k")
+	off.put("k", gen, "v")
+	_, _, ok = off.get("k")
+	assert.False(t, ok)
+}
+
+func TestRuntimeAPIVersion(t *testing.T) {
+	// The reported CRI version must match the kubeapi package compiled in,
+	// not a hardcoded string that can go stale on a CRI bump.
+	assert.Equal(t, "v1alpha1", runtimeAPIVersion)
+}
+
+func TestValidationInterceptor(t *testing.T) {
+	s := &FraktiManager{
+		maxLabelMapCount: 2,
+		maxLabelMapSize:  64,
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/runtime.RuntimeService/RunPodSandbox"}
+	handled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return nil, nil
+	}
+
+	// A reasonably sized config passes through to the handler.
+	config := makeSandboxConfigWithHandler("")
+	config.Labels = map[string]string{"app": "web"}
+	req := &kubeapi.RunPodSandboxRequest{Config: config}
+	handled = false
+	_, err := s.validationInterceptor(context.Background(), req, info, handler)
+	assert.NoError(t, err)
+	assert.True(t, handled)
+
+	// Too many labels are rejected with InvalidArgument.
+	config.Labels = map[string]string{"a": "1", "b": "2", "c": "3"}
+	handled = false
+	_, err = s.validationInterceptor(context.Background(), req, info, handler)
+	assert.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, grpc.Code(err))
+	assert.False(t, handled)
+
+	// An oversized annotation map is rejected as well.
+	config.Labels = nil
+	config.Annotations = map[string]string{"note": strings.Repeat("x", 100)}
+	_, err = s.validationInterceptor(context.Background(), req, info, handler)
+	assert.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, grpc.Code(err))
+
+	// Container configs are validated the same way.
+	containerReq := &kubeapi.CreateContainerRequest{
+		Config: &kubeapi.ContainerConfig{
+			Labels: map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+	}
+	_, err = s.validationInterceptor(context.Background(), containerReq, info, handler)
+	assert.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, grpc.Code(err))
+
+	// Zero limits disable the checks.
+	s = &FraktiManager{}
+	handled = false
+	_, err = s.validationInterceptor(context.Background(), req, info, handler)
+	assert.NoError(t, err)
+	assert.True(t, handled)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"sync"
+)
+
+// sandboxLocks serializes container creates against the teardown of their
+// sandbox, closing the race where kubelet stops a sandbox while a create
+// into it is still in flight and the container ends up orphaned in a dying
+// pod. Creates share a sandbox's lock for reading, so they do not slow each
+// other down; a teardown takes it for writing, waiting out in-flight
+// creates, and leaves the sandbox marked so later creates fail fast. The
+// zero value is ready to use.
+type sandboxLocks struct {
+	sync.Mutex
+	locks map[string]*sandboxLock
+}
+
+type sandboxLock struct {
+	sync.RWMutex
+	// tearingDown is set once a stop or remove of the sandbox has begun
+	// and never cleared: CRI sandboxes are not resurrected, a new attempt
+	// gets a new ID.
+	tearingDown bool
+}
+
+func (s *sandboxLocks) get(podSandboxID string) *sandboxLock {
+	s.Lock()
+	defer s.Unlock()
+	if s.locks == nil {
+		s.locks = make(map[string]*sandboxLock)
+	}
+	l, ok := s.locks[podSandboxID]
+	if !ok {
+		l = &sandboxLock{}
+		s.locks[podSandboxID] = l
+	}
+	return l
+}
+
+// beginCreate waits for an in-flight teardown of the sandbox, then reports
+// whether a create may proceed. When it may, the returned release function
+// must be called once the create is done.
+func (s *sandboxLocks) beginCreate(podSandboxID string) (release func(), ok bool) {
+	l := s.get(podSandboxID)
+	l.RLock()
+	if l.tearingDown {
+		l.RUnlock()
+		return nil, false
+	}
+	return l.RUnlock, true
+}
+
+// beginTeardown waits for in-flight creates into the sandbox to finish and
+// marks it as being torn down. The returned release function must be called
+// once the teardown is done.
+func (s *sandboxLocks) beginTeardown(podSandboxID string) (release func()) {
+	l := s.get(podSandboxID)
+	l.Lock()
+	l.tearingDown = true
+	return l.Unlock
+}
+
+// forget drops the lock of a removed sandbox, so the map does not grow with
+// every sandbox the node ever ran.
+func (s *sandboxLocks) forget(podSandboxID string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.locks, podSandboxID)
+}
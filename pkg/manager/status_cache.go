@@ -0,0 +1,104 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+// statusCache holds recently fetched sandbox and container statuses for a
+// short TTL, so kubelet's back-to-back relists do not each hit hyperd for
+// every pod and container. Every mutation invalidates the affected entry.
+//
+// A fill races a concurrent mutation when the status was fetched before the
+// mutation but stored after its invalidation; the generation counter
+// rejects such stale fills: put only stores when no invalidation happened
+// since the corresponding get. A TTL of zero or less disables the cache
+// entirely.
+type statusCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	gen     uint64
+	entries map[string]statusCacheEntry
+}
+
+type statusCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// get returns the cached value for key when present and fresh. The
+// returned generation must be passed to the put that fills the entry.
+func (c *statusCache) get(key string) (value interface{}, gen uint64, ok bool) {
+	if c.ttl <= 0 {
+		return nil, 0, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	entry, found := c.entries[key]
+	if !found {
+		return nil, c.gen, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, c.gen, false
+	}
+	return entry.value, c.gen, true
+}
+
+// put stores value for key unless an invalidation happened since the get
+// that returned gen, in which case the fill is stale and dropped.
+func (c *statusCache) put(key string, gen uint64, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]statusCacheEntry)
+	}
+	c.entries[key] = statusCacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate drops the entry for key and fences off in-flight fills that
+// started before the mutation.
+func (c *statusCache) invalidate(key string) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	delete(c.entries, key)
+}
+
+// Cache keys are namespaced by kind, so a sandbox and a container sharing
+// an ID (different runtimes) cannot collide.
+func sandboxStatusCacheKey(podSandboxID string) string {
+	return "sandbox/" + podSandboxID
+}
+
+func containerStatusCacheKey(containerID string) string {
+	return "container/" + containerID
+}
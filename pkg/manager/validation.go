@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/v1alpha1/runtime"
+)
+
+const (
+	// DefaultMaxLabelMapCount is the default bound on the number of
+	// entries in one label or annotation map.
+	DefaultMaxLabelMapCount = 256
+	// DefaultMaxLabelMapSize is the default bound in bytes on the total
+	// size of one label or annotation map. It matches the total
+	// annotation size limit Kubernetes applies on API objects.
+	DefaultMaxLabelMapSize = 256 * 1024
+)
+
+// validationInterceptor rejects requests carrying oversized label or
+// annotation maps with InvalidArgument before they are copied into runtime
+// specs, so a misbehaving client cannot blow up frakti's or hyperd's memory.
+func (s *FraktiManager) validationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var labels, annotations map[string]string
+	switch r := req.(type) {
+	case *kubeapi.RunPodSandboxRequest:
+		labels = r.GetConfig().GetLabels()
+		annotations = r.GetConfig().GetAnnotations()
+	case *kubeapi.CreateContainerRequest:
+		labels = r.GetConfig().GetLabels()
+		annotations = r.GetConfig().GetAnnotations()
+	}
+
+	if err := s.validateLabelMap("labels", labels); err != nil {
+		glog.Errorf("%s rejected: %v", info.FullMethod, err)
+		return nil, err
+	}
+	if err := s.validateLabelMap("annotations", annotations); err != nil {
+		glog.Errorf("%s rejected: %v", info.FullMethod, err)
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// validateLabelMap bounds the number of entries and the total size of a
+// label or annotation map.
+func (s *FraktiManager) validateLabelMap(kind string, m map[string]string) error {
+	if s.maxLabelMapCount > 0 && len(m) > s.maxLabelMapCount {
+		return status.Errorf(codes.InvalidArgument, "too many %s: %d entries exceed the limit of %d", kind, len(m), s.maxLabelMapCount)
+	}
+
+	if s.maxLabelMapSize <= 0 {
+		return nil
+	}
+	size := 0
+	for k, v := range m {
+		size += len(k) + len(v)
+	}
+	if size > s.maxLabelMapSize {
+		return status.Errorf(codes.InvalidArgument, "%s too large: %d bytes exceed the limit of %d", kind, size, s.maxLabelMapSize)
+	}
+	return nil
+}